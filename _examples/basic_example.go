@@ -25,9 +25,7 @@ func main() {
 
 		log.Printf("[MAIN] - Found link %q -> %s", el.Text, link)
 
-		absURL := el.Request.GetAbsoluteURL(link)
-
-		err := h.Visit(absURL)
+		err := h.VisitAbsolute(el.Request.URL.String(), link)
 		if err != nil {
 			log.Println("[MAIN] - ", err)
 		}
@@ -30,9 +30,7 @@ func main() {
 
 		log.Printf("[MAIN] - Found link %q -> %s", el.Text, link)
 
-		absURL := el.Request.GetAbsoluteURL(link)
-
-		err := el.Request.Visit(absURL) // Use el.Request.Visit to preserve the depth context
+		err := el.Request.VisitRelative(link) // Use el.Request to preserve the depth context
 		if err != nil {
 			log.Println("[MAIN] - ", err)
 		}
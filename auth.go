@@ -0,0 +1,62 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// AuthChallengeCallback is a type for callbacks answering the challenge of a 401 Unauthorized
+// response, e.g. by refreshing an OAuth token. If ok is true, the request is retried once with the
+// returned headers set on it.
+type AuthChallengeCallback func(res *Response) (retryWith http.Header, ok bool)
+
+// AuthChallengeDo adds a callback to the Harvester that is called when a request is answered with
+// 401 Unauthorized. The request is retried once with the headers of the first callback returning
+// true, replacing the headers of the same name. If no callback answers the challenge, the 401
+// response is handled like any other response.
+func (h *Harvester) AuthChallengeDo(fn AuthChallengeCallback) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.authChallengeCallbacks = append(h.authChallengeCallbacks, fn)
+}
+
+// handleAuthChallenge calls the AuthChallengeDo callbacks for the 401 response with the body b,
+// returning the headers to retry the request with.
+func (h *Harvester) handleAuthChallenge(request *Request, res *http.Response, b []byte) (http.Header, bool) {
+	if len(h.authChallengeCallbacks) == 0 {
+		return nil, false
+	}
+
+	response := &Response{
+		StatusCode: res.StatusCode,
+		Headers:    &res.Header,
+		Request:    request,
+		Body:       bytes.NewReader(b),
+		content:    b,
+		hasher:     h.contentHasher,
+	}
+
+	for _, fn := range h.authChallengeCallbacks {
+		if header, ok := fn(response); ok {
+			return header, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_AuthChallengeDo(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	d := &recordingDebugger{}
+	h := newTestHarvester(WithIgnoreRobots(true), WithDebugger(d))
+	h.RequestDo(func(req *Request) {
+		req.Headers.Set("Authorization", "Bearer stale")
+	})
+
+	var challenges []string
+	h.AuthChallengeDo(func(res *Response) (http.Header, bool) {
+		challenges = append(challenges, res.Headers.Get("WWW-Authenticate"))
+		return http.Header{"Authorization": {"Bearer fresh"}}, true
+	})
+
+	var statusCodes []int
+	h.ResponseDo(func(res *Response) {
+		statusCodes = append(statusCodes, res.StatusCode)
+		assert.Equal(t, "Bearer fresh", res.Request.Headers.Get("Authorization"))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, []string{`Bearer error="invalid_token"`}, challenges)
+	assert.Equal(t, []int{http.StatusOK}, statusCodes)
+	assert.Equal(t, []EventType{
+		EventRequestQueued,
+		EventRequestStarted, EventResponseReceived,
+		EventAuthChallenge,
+		EventRequestStarted, EventResponseReceived,
+	}, d.types())
+}
+
+func TestHarvester_AuthChallengeDo_NotAnswered(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+	h.AuthChallengeDo(func(res *Response) (http.Header, bool) {
+		return nil, false
+	})
+
+	var statusCodes []int
+	h.ResponseDo(func(res *Response) {
+		statusCodes = append(statusCodes, res.StatusCode)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, []int{http.StatusUnauthorized}, statusCodes)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Backend is an interface for performing the exchange of a request, so that pages can be fetched by
+// other means than an http.Client, such as a headless browser rendering JavaScript. Robots checks,
+// filters, deduplication and callbacks are the same for every Backend. robots.txt files are fetched
+// with the Backend too, so it must return them unrendered, and file:// URLs are read from the file system.
+type Backend interface {
+	// Do performs the exchange of the request and returns its response. Only the StatusCode,
+	// Headers and Body of the response are used. The Body is closed if it is an io.ReadCloser.
+	Do(ctx context.Context, req *Request) (*Response, error)
+}
+
+// WithBackend is a functional option that sets the Backend performing the exchange of every request.
+// By default requests are sent with the http.Client of the Harvester.
+func WithBackend(backend Backend) Options {
+	return func(h *Harvester) {
+		h.backend = backend
+	}
+}
+
+// HTTPBackend is a Backend sending requests with an http.Client, e.g. for Backends that fall back to
+// plain HTTP requests for some pages.
+type HTTPBackend struct {
+	Client *http.Client
+}
+
+// NewHTTPBackend creates a new HTTPBackend sending requests with the given http.Client.
+func NewHTTPBackend(client *http.Client) *HTTPBackend {
+	return &HTTPBackend{Client: client}
+}
+
+// Do sends the request with the http.Client of the HTTPBackend. The Body of the response is the
+// unread http.Response body.
+func (b *HTTPBackend) Do(ctx context.Context, req *Request) (*Response, error) {
+	body := req.Body
+	if body == nil {
+		body = http.NoBody
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if req.Headers != nil {
+		httpReq.Header = req.Headers.Clone()
+	}
+
+	res, err := b.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		StatusCode: res.StatusCode,
+		Headers:    &res.Header,
+		Request:    req,
+		Body:       res.Body,
+	}, nil
+}
+
+// doBackend performs the exchange of the request with the Backend of the Harvester.
+func (h *Harvester) doBackend(req *http.Request, depth int) (*http.Response, error) {
+	res, err := h.backend.Do(req.Context(), &Request{
+		URL:       req.URL,
+		Headers:   &req.Header,
+		Host:      req.URL.Host,
+		Method:    req.Method,
+		Body:      req.Body,
+		Depth:     depth,
+		harvester: h,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	if res.Headers != nil {
+		headers = *res.Headers
+	}
+
+	var body io.ReadCloser = http.NoBody
+	switch b := res.Body.(type) {
+	case nil:
+	case io.ReadCloser:
+		body = b
+	default:
+		body = io.NopCloser(b)
+	}
+
+	return &http.Response{
+		Status:     strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode),
+		StatusCode: res.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     headers,
+		Body:       body,
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPBackend(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	closed := newTestServer()
+	closed.Close()
+
+	noRedirects := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		client      *http.Client
+		userAgent   string
+		status      int
+		contentType string
+		location    string
+		body        string
+		err         string
+	}{
+		{name: "OK", url: server.URL + "/", client: http.DefaultClient, status: http.StatusOK, contentType: "text/plain", body: string(helloBytes)},
+		{name: "NotFound", url: server.URL + "/404", client: http.DefaultClient, status: http.StatusNotFound, contentType: "text/plain", body: "404 page not found\n"},
+		{name: "ServerError", url: server.URL + "/error", client: http.DefaultClient, status: http.StatusInternalServerError, contentType: "text/plain", body: "Internal server error\n"},
+		{name: "RequestHeaders", url: server.URL + "/user_agent", client: http.DefaultClient, userAgent: "grawlr-test", status: http.StatusOK, contentType: "text/plain", body: "grawlr-test"},
+		{name: "FollowsRedirects", url: server.URL + "/redirect", client: http.DefaultClient, status: http.StatusOK, contentType: "text/plain", body: string(helloBytes)},
+		{name: "Redirect", url: server.URL + "/redirect", client: noRedirects, status: http.StatusSeeOther, contentType: "text/html", location: "/"},
+		{name: "ConnectionError", url: closed.URL + "/", client: http.DefaultClient, err: "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHarvester(WithBackend(NewHTTPBackend(tt.client)), WithIgnoreRobots(true))
+			if tt.userAgent != "" {
+				h.RequestDo(func(req *Request) {
+					req.Headers.Set("User-Agent", tt.userAgent)
+				})
+			}
+
+			var res *Response
+			var body []byte
+			h.ResponseDo(func(r *Response) {
+				res = r
+				body, _ = io.ReadAll(r.Body)
+			})
+
+			err := h.Visit(tt.url)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				assert.Nil(t, res)
+				return
+			}
+
+			if assert.NotNil(t, res) {
+				assert.Equal(t, tt.status, res.StatusCode)
+				assert.Equal(t, tt.contentType, res.ContentType())
+				assert.Equal(t, tt.location, res.Headers.Get("Location"))
+				if tt.body != "" {
+					assert.Equal(t, tt.body, string(body))
+				}
+			}
+		})
+	}
+}
+
+// backendFunc is a Backend calling the function.
+type backendFunc func(ctx context.Context, req *Request) (*Response, error)
+
+func (f backendFunc) Do(ctx context.Context, req *Request) (*Response, error) {
+	return f(ctx, req)
+}
+
+// renderingBackend is a fake Backend returning rendered pages.
+type renderingBackend struct {
+	pages map[string]string
+}
+
+func (b renderingBackend) Do(ctx context.Context, req *Request) (*Response, error) {
+	page, ok := b.pages[req.URL.Path]
+	if !ok {
+		return nil, errors.New("page not rendered")
+	}
+
+	headers := http.Header{"Content-Type": {"text/html"}}
+	return &Response{StatusCode: http.StatusOK, Headers: &headers, Body: strings.NewReader(page)}, nil
+}
+
+func TestHarvester_WithBackend(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithBackend(renderingBackend{pages: map[string]string{
+		"/robots.txt": "User-agent: *\nDisallow: /disallowed",
+		"/app":        `<div id="app"><a href="/app/page">Rendered</a><a href="/disallowed">Disallowed</a></div>`,
+		"/app/page":   `<div id="app"><a href="/app">Back</a></div>`,
+	}}))
+
+	var visited []string
+	h.ResponseDo(func(res *Response) {
+		visited = append(visited, res.Request.URL.Path+" "+res.ContentType())
+	})
+
+	var errs []error
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		errs = append(errs, el.Visit(el.Attribute("href")))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/app"))
+	assert.Equal(t, []string{"/app text/html", "/app/page text/html"}, visited)
+	assert.Len(t, errs, 3)
+	assert.ErrorContains(t, errors.Join(errs...), "disallowed by robots.txt")
+	assert.ErrorContains(t, errors.Join(errs...), "already been visited")
+
+	assert.ErrorContains(t, h.Visit(server.URL+"/missing"), "page not rendered")
+}
+
+// testBackends are the ways of exchanging requests the conformance tests run with. A nil Backend
+// sends requests with the client of the Harvester.
+var testBackends = []struct {
+	name    string
+	backend func(client *http.Client) Backend
+}{
+	{name: "Client", backend: func(*http.Client) Backend { return nil }},
+	{name: "HTTPBackend", backend: func(client *http.Client) Backend { return NewHTTPBackend(client) }},
+}
+
+// newBackendTestHarvester is newTestHarvester exchanging requests with the Backend built from its client,
+// recording the paths requested through the Backend.
+func newBackendTestHarvester(backend func(client *http.Client) Backend, paths *[]string, options ...Options) *Harvester {
+	h := newTestHarvester(options...)
+
+	if b := backend(h.Client); b != nil {
+		var lock sync.Mutex
+		h.backend = backendFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			lock.Lock()
+			*paths = append(*paths, req.URL.Path)
+			lock.Unlock()
+			return b.Do(ctx, req)
+		})
+	}
+
+	return h
+}
+
+func TestHarvester_BackendConformance(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Run("Filters", func(t *testing.T) {
+				var paths []string
+				h := newBackendTestHarvester(backend.backend, &paths, WithDisallowedURLs([]string{server.URL + "/faq"}))
+
+				assert.EqualError(t, h.Visit(server.URL+"/faq"), fmt.Sprintf("URL %s is forbidden", server.URL+"/faq"))
+				assert.NoError(t, h.Visit(server.URL+"/"))
+				if backend.name != "Client" {
+					assert.Equal(t, []string{"/robots.txt", "/"}, paths)
+				}
+			})
+
+			t.Run("Robots", func(t *testing.T) {
+				var paths []string
+				h := newBackendTestHarvester(backend.backend, &paths)
+
+				assert.ErrorContains(t, h.Visit(server.URL+"/disallowed"), "disallowed by robots.txt")
+				assert.NoError(t, h.Visit(server.URL+"/allowed"))
+				if backend.name != "Client" {
+					assert.Equal(t, []string{"/robots.txt", "/allowed"}, paths)
+				}
+			})
+
+			t.Run("Canceled", func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				var paths []string
+				h := newBackendTestHarvester(backend.backend, &paths, WithContext(ctx))
+
+				assert.ErrorIs(t, h.Visit(server.URL+"/"), context.Canceled)
+				assert.Empty(t, h.robotsMap)
+			})
+
+			t.Run("Deduplication", func(t *testing.T) {
+				var paths []string
+				h := newBackendTestHarvester(backend.backend, &paths, WithIgnoreRobots(true))
+
+				assert.NoError(t, h.Visit(server.URL+"/"))
+				assert.ErrorContains(t, h.Visit(server.URL+"/"), "already been visited")
+				if backend.name != "Client" {
+					assert.Equal(t, []string{"/"}, paths)
+				}
+			})
+
+			t.Run("Callbacks", func(t *testing.T) {
+				var paths []string
+				h := newBackendTestHarvester(backend.backend, &paths, WithIgnoreRobots(true), WithDepthLimit(2))
+
+				var calls []string
+				h.RequestDo(func(req *Request) {
+					req.Headers.Set("User-Agent", "grawlr-test")
+					calls = append(calls, "request "+req.URL.Path)
+				})
+				h.ResponseDo(func(res *Response) {
+					call := fmt.Sprintf("response %s %d", res.Request.URL.Path, res.StatusCode)
+					if res.Request.URL.Path == "/user_agent" {
+						body, _ := io.ReadAll(res.Body)
+						call += " " + string(body)
+					}
+					calls = append(calls, call)
+				})
+				h.StatusDo(http.StatusNotFound, func(res *Response) {
+					calls = append(calls, "status "+res.Request.URL.Path)
+				})
+				h.HtmlDo("a[href='/']", func(el *HtmlElement) {
+					calls = append(calls, "html "+el.Text)
+					assert.NoError(t, el.Visit(el.Attribute("href")))
+				})
+
+				assert.NoError(t, h.Visit(server.URL+"/faq"))
+				assert.NoError(t, h.Visit(server.URL+"/user_agent"))
+				assert.NoError(t, h.Visit(server.URL+"/404"))
+				assert.Equal(t, []string{
+					"request /faq",
+					"response /faq 200",
+					"html Home",
+					"request /",
+					"response / 200",
+					"request /user_agent",
+					"response /user_agent 200 grawlr-test",
+					"request /404",
+					"response /404 404",
+					"status /404",
+				}, calls)
+				if backend.name != "Client" {
+					assert.Equal(t, []string{"/faq", "/", "/user_agent", "/404"}, paths)
+				}
+			})
+		})
+	}
+}
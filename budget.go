@@ -0,0 +1,208 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"sync"
+)
+
+var (
+	// ErrTotalBytesExceeded is returned when the download budget of the crawl set with WithMaxTotalBytes is used up.
+	ErrTotalBytesExceeded = func(limit int64) error {
+		return fmt.Errorf("download budget of %d bytes is used up", limit)
+	}
+	// ErrHostBytesExceeded is returned when the download budget of a host set with WithMaxBytesPerHost is used up.
+	ErrHostBytesExceeded = func(host string, limit int64) error {
+		return fmt.Errorf("download budget of %d bytes for host %s is used up", limit, host)
+	}
+)
+
+// WithMaxTotalBytes is a functional option that stops the crawl after n bytes of response bodies have
+// been read. The budget is enforced while bodies are read, so the response that uses it up is cut short
+// and marked as Truncated, and every later fetch fails with ErrTotalBytesExceeded. There is no limit per
+// response, so a single large response can use up the whole budget. The budget used is reported in
+// Stats as BudgetUsed.
+func WithMaxTotalBytes(n int64) Options {
+	return func(h *Harvester) {
+		h.budgetState().total = n
+	}
+}
+
+// WithMaxBytesPerHost is a functional option that stops fetching from a host after n bytes of its
+// response bodies have been read. The budget is enforced while bodies are read, so the response that
+// uses it up is cut short and marked as Truncated, and every later fetch from the host fails with
+// ErrHostBytesExceeded. The budget used by each host is reported in Stats as BudgetUsedByHost.
+func WithMaxBytesPerHost(n int64) Options {
+	return func(h *Harvester) {
+		h.budgetState().perHost = n
+	}
+}
+
+// byteBudget is the download budget of a Harvester, in total and per host.
+type byteBudget struct {
+	total     int64
+	perHost   int64
+	used      int64
+	usedHosts map[string]int64
+	lock      sync.Mutex
+}
+
+// budgetState returns the download budget of the Harvester, creating it if needed.
+func (h *Harvester) budgetState() *byteBudget {
+	if h.budget == nil {
+		h.budget = &byteBudget{usedHosts: make(map[string]int64)}
+	}
+
+	return h.budget
+}
+
+// check returns an error if the budget of the crawl or of the host is used up.
+func (b *byteBudget) check(host string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.exceeded(host)
+}
+
+// exceeded returns an error if the budget of the crawl or of the host is used up. The lock must be held.
+func (b *byteBudget) exceeded(host string) error {
+	if b.total > 0 && b.used >= b.total {
+		return ErrTotalBytesExceeded(b.total)
+	}
+	if b.perHost > 0 && b.usedHosts[host] >= b.perHost {
+		return ErrHostBytesExceeded(host, b.perHost)
+	}
+
+	return nil
+}
+
+// consume uses n bytes of the budget of the crawl and of the host, returning the number of bytes
+// that fit into the budget and an error if not all of them do.
+func (b *byteBudget) consume(host string, n int) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	allowed := int64(n)
+	if b.total > 0 {
+		allowed = min(allowed, max(b.total-b.used, 0))
+	}
+	if b.perHost > 0 {
+		allowed = min(allowed, max(b.perHost-b.usedHosts[host], 0))
+	}
+
+	b.used += allowed
+	b.usedHosts[host] += allowed
+
+	if allowed < int64(n) {
+		return int(allowed), b.exceeded(host)
+	}
+
+	return n, nil
+}
+
+// hostExceeded returns ErrHostBytesExceeded if the budget of the host is used up, regardless of the
+// budget of the crawl.
+func (b *byteBudget) hostExceeded(host string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.perHost > 0 && b.usedHosts[host] >= b.perHost {
+		return ErrHostBytesExceeded(host, b.perHost)
+	}
+
+	return nil
+}
+
+// usage returns the number of bytes used of the budget of the crawl and of each host.
+func (b *byteBudget) usage() (int64, map[string]int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.used, maps.Clone(b.usedHosts)
+}
+
+// restore sets the bytes used of the budget of the crawl and of each host, e.g. to the usage saved
+// with Harvester.SaveState.
+func (b *byteBudget) restore(used int64, usedHosts map[string]int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.used = used
+	b.usedHosts = make(map[string]int64, len(usedHosts))
+	maps.Copy(b.usedHosts, usedHosts)
+}
+
+// reader returns a reader of the response body of a request to the host using the budget.
+func (b *byteBudget) reader(host string, r io.Reader) *budgetReader {
+	return &budgetReader{budget: b, host: host, r: r}
+}
+
+// budgetReader reads a response body until the download budget is used up.
+type budgetReader struct {
+	budget   *byteBudget
+	host     string
+	r        io.Reader
+	exceeded error
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	if r.exceeded != nil {
+		return 0, r.exceeded
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		var budgetErr error
+		if n, budgetErr = r.budget.consume(r.host, n); budgetErr != nil {
+			r.exceeded = budgetErr
+			return n, budgetErr
+		}
+	}
+
+	return n, err
+}
+
+// checkByteBudget returns an error if the download budget of the crawl or of the host of the URL is used up.
+func (h *Harvester) checkByteBudget(parsedURL *url.URL, depth int) error {
+	if err := h.budget.check(parsedURL.Host); err != nil {
+		h.stats.skippedBudget.Add(1)
+		h.debug(EventFilteredOut, parsedURL.String(), depth, 0, err)
+		h.notifyHostDropped(parsedURL.Host)
+		return err
+	}
+
+	return nil
+}
+
+// notifyHostDropped delivers WebhookHostDropped with the webhook of the Harvester, if any, when the
+// download budget of the host is used up. The webhook delivers it once per host.
+func (h *Harvester) notifyHostDropped(host string) {
+	if h.webhook == nil {
+		return
+	}
+
+	if err := h.budget.hostExceeded(host); err != nil {
+		h.webhook.hostDropped(h, host, err)
+	}
+}
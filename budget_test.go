@@ -0,0 +1,109 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newBudgetTestServer returns a server responding with a body of 10000 bytes to every request.
+func newBudgetTestServer() *httptest.Server {
+	body := bytes.Repeat([]byte("x"), 10000)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(body)
+	}))
+}
+
+func TestHarvester_WithMaxBytesPerHost(t *testing.T) {
+	serverA := newBudgetTestServer()
+	defer serverA.Close()
+	serverB := newBudgetTestServer()
+	defer serverB.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithMaxBytesPerHost(15000))
+
+	sizes := make(map[string]int)
+	truncated := make(map[string]bool)
+	h.ResponseDo(func(res *Response) {
+		sizes[res.Request.URL.String()] = len(res.content)
+		truncated[res.Request.URL.String()] = res.Truncated
+	})
+
+	assert.NoError(t, h.Visit(serverA.URL+"/1"))
+	assert.NoError(t, h.Visit(serverA.URL+"/2"))
+	assert.EqualError(t, h.Visit(serverA.URL+"/3"), ErrHostBytesExceeded(strings.TrimPrefix(serverA.URL, "http://"), 15000).Error())
+	assert.NoError(t, h.Visit(serverB.URL+"/1"))
+
+	assert.Equal(t, map[string]int{
+		serverA.URL + "/1": 10000,
+		serverA.URL + "/2": 5000,
+		serverB.URL + "/1": 10000,
+	}, sizes)
+	assert.Equal(t, map[string]bool{
+		serverA.URL + "/1": false,
+		serverA.URL + "/2": true,
+		serverB.URL + "/1": false,
+	}, truncated)
+
+	stats := h.Stats()
+	assert.Equal(t, int64(25000), stats.BytesDownloaded)
+	assert.Equal(t, int64(25000), stats.BudgetUsed)
+	assert.Equal(t, map[string]int64{
+		strings.TrimPrefix(serverA.URL, "http://"): 15000,
+		strings.TrimPrefix(serverB.URL, "http://"): 10000,
+	}, stats.BudgetUsedByHost)
+	assert.Nil(t, stats.Hosts, "the budget used by host does not need WithHostStats")
+	assert.Equal(t, int64(1), stats.TruncatedBodies)
+	assert.Equal(t, int64(1), stats.SkippedBudget)
+}
+
+func TestHarvester_WithMaxTotalBytes(t *testing.T) {
+	serverA := newBudgetTestServer()
+	defer serverA.Close()
+	serverB := newBudgetTestServer()
+	defer serverB.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithMaxTotalBytes(25000))
+
+	var sizes []int
+	h.ResponseDo(func(res *Response) {
+		sizes = append(sizes, len(res.content))
+	})
+
+	assert.NoError(t, h.Visit(serverA.URL+"/1"))
+	assert.NoError(t, h.Visit(serverB.URL+"/1"))
+	assert.NoError(t, h.Visit(serverA.URL+"/2"))
+	assert.EqualError(t, h.Visit(serverB.URL+"/2"), ErrTotalBytesExceeded(25000).Error())
+	assert.EqualError(t, h.Visit(serverA.URL+"/3"), ErrTotalBytesExceeded(25000).Error())
+
+	assert.Equal(t, []int{10000, 10000, 5000}, sizes)
+
+	stats := h.Stats()
+	assert.Equal(t, int64(25000), stats.BytesDownloaded)
+	assert.Equal(t, int64(25000), stats.BudgetUsed)
+	assert.Equal(t, int64(1), stats.TruncatedBodies)
+	assert.Equal(t, int64(2), stats.SkippedBudget)
+
+	assert.Zero(t, newTestHarvester().Stats().BudgetUsed)
+	assert.Nil(t, newTestHarvester().Stats().BudgetUsedByHost)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	// minPooledBufferSize is the initial capacity of the buffers of a bufferPool.
+	minPooledBufferSize = 32 << 10
+	// maxPooledBufferSize is the capacity above which a buffer is not put back into a bufferPool,
+	// so that a few large responses do not pin their memory for the rest of the crawl.
+	maxPooledBufferSize = 4 << 20
+)
+
+// WithBufferPool is a functional option that reads response bodies into buffers reused across
+// requests, reducing the allocations of large crawls. A buffer is reused once the callbacks of its
+// response have returned, so a Response must not be used after its callbacks return, e.g. from a
+// goroutine started by a callback. The body of a Response used later reads as empty. Responses
+// returned by GraphQL and the responses of HtmlDoWithTimeout callbacks are copied out of the pool.
+func WithBufferPool(enabled bool) Options {
+	return func(h *Harvester) {
+		if enabled {
+			h.bufferPool = newBufferPool()
+		} else {
+			h.bufferPool = nil
+		}
+	}
+}
+
+// bufferPool is a pool of buffers response bodies are read into.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+// newBufferPool creates a new bufferPool.
+func newBufferPool() *bufferPool {
+	return &bufferPool{
+		pool: sync.Pool{
+			New: func() any {
+				b := make([]byte, 0, minPooledBufferSize)
+				return &b
+			},
+		},
+	}
+}
+
+// readAll reads r until EOF like io.ReadAll, into a buffer of the pool. A nil pool allocates a new buffer.
+func (p *bufferPool) readAll(r io.Reader) ([]byte, error) {
+	if p == nil {
+		return io.ReadAll(r)
+	}
+
+	b := (*p.pool.Get().(*[]byte))[:0]
+	for {
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return b, err
+		}
+
+		if len(b) == cap(b) {
+			// Add more capacity, letting append pick how much.
+			b = append(b, 0)[:len(b)]
+		}
+	}
+}
+
+// put returns a buffer read with readAll to the pool. The buffer must not be used afterwards.
+func (p *bufferPool) put(b []byte) {
+	if p == nil || b == nil || cap(b) > maxPooledBufferSize {
+		return
+	}
+
+	b = b[:0]
+	p.pool.Put(&b)
+}
+
+// release returns the body of the response to the buffer pool it was read into, if any.
+// The body of the response reads as empty afterwards.
+func (r *Response) release() {
+	if r.pool == nil {
+		return
+	}
+
+	r.pool.put(r.content)
+	r.pool = nil
+	r.content = nil
+	r.Body = bytes.NewReader(nil)
+}
+
+// detach copies the body of the response out of the buffer pool it was read into, if any,
+// so that the response can be used after its callbacks have returned.
+func (r *Response) detach() {
+	if r.pool == nil {
+		return
+	}
+
+	content := bytes.Clone(r.content)
+	r.pool.put(r.content)
+	r.pool = nil
+	r.content = content
+	r.Body = bytes.NewReader(content)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferPool_ReadAll(t *testing.T) {
+	p := newBufferPool()
+	data := strings.Repeat("grawlr", 20000)
+
+	b, err := p.readAll(iotest.HalfReader(strings.NewReader(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, string(b))
+
+	p.put(b)
+	b, err = p.readAll(strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+
+	_, err = p.readAll(iotest.ErrReader(io.ErrUnexpectedEOF))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	var nilPool *bufferPool
+	b, err = nilPool.readAll(strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	nilPool.put(b)
+}
+
+func TestHarvester_WithBufferPool(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithBufferPool(true))
+
+	var retained []*Response
+	var bodies []string
+	h.ResponseDo(func(res *Response) {
+		b, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(b))
+		retained = append(retained, res)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.NotEmpty(t, bodies)
+	for _, body := range bodies {
+		assert.NotEmpty(t, body)
+	}
+
+	// A response used after its callbacks have returned reads as empty instead of reading a reused buffer.
+	for _, res := range retained {
+		b, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.Empty(t, b)
+	}
+}
+
+func TestHarvester_WithBufferPool_GraphQL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"hello":"world"}}`))
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithBufferPool(true))
+
+	res, err := h.GraphQL(server.URL, "{ hello }", nil)
+	assert.NoError(t, err)
+
+	// Reading another body must not overwrite the body of the returned response.
+	h.bufferPool.put(bytes.Repeat([]byte{'x'}, 64))
+	_, err = h.GraphQL(server.URL, "{ hello world }", nil)
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"data":{"hello":"world"}}`, string(b))
+}
+
+func BenchmarkHarvester_BufferPool(b *testing.B) {
+	body := bytes.Repeat([]byte("grawlr "), 40000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	for _, enabled := range []bool{false, true} {
+		name := "unpooled"
+		if enabled {
+			name = "pooled"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			h := newTestHarvester(WithIgnoreRobots(true), WithAllowRevisit(true), WithBufferPool(enabled))
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for range b.N {
+				if err := h.Visit(server.URL + "/"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
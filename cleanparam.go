@@ -0,0 +1,112 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// cleanParam is a Clean-param directive of a robots.txt, listing query parameters that do not change
+// the content of the pages whose path matches the path pattern.
+type cleanParam struct {
+	params []string
+	path   *regexp.Regexp
+}
+
+// WithRespectCleanParam is a functional option that removes the query parameters listed in the
+// Clean-param directives of the robots.txt of a host, such as session IDs, from the URLs of the host
+// when deduplicating visits, so that URLs only differing in those parameters are fetched once.
+// The URLs are fetched as they are. The directives are read with the robots.txt of the host, so they
+// are not used when robots.txt is ignored.
+func WithRespectCleanParam(enabled bool) Options {
+	return func(h *Harvester) {
+		h.respectCleanParam = enabled
+	}
+}
+
+// parseCleanParams parses the Clean-param directives of a robots.txt, which apply to every user
+// agent wherever they appear. A directive lists parameters separated by & and an optional path
+// prefix, in which * matches any sequence of characters, e.g. "Clean-param: sid&ref /forum/".
+func parseCleanParams(body []byte) []cleanParam {
+	var directives []cleanParam
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "clean-param") {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		directive := cleanParam{params: strings.Split(fields[0], "&")}
+		if len(fields) > 1 {
+			pattern := strings.ReplaceAll(regexp.QuoteMeta(fields[1]), `\*`, ".*")
+			directive.path = regexp.MustCompile("^" + pattern)
+		}
+		directives = append(directives, directive)
+	}
+
+	return directives
+}
+
+// cleanURL returns a copy of the URL without the query parameters the Clean-param directives of
+// its host list for its path, or the URL itself if there are none.
+func (h *Harvester) cleanURL(u *url.URL) *url.URL {
+	if !h.respectCleanParam || u.RawQuery == "" {
+		return u
+	}
+
+	h.mu.RLock()
+	directives := h.cleanParams[u.Host]
+	h.mu.RUnlock()
+
+	var params []string
+	for _, d := range directives {
+		if d.path == nil || d.path.MatchString(u.EscapedPath()) {
+			params = append(params, d.params...)
+		}
+	}
+	if len(params) == 0 {
+		return u
+	}
+
+	// Keep the order of the remaining parameters, url.Values would sort them.
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !slices.Contains(params, name) {
+			kept = append(kept, pair)
+		}
+	}
+
+	c := *u
+	c.RawQuery = strings.Join(kept, "&")
+	c.ForceQuery = false
+	return &c
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCleanParams(t *testing.T) {
+	directives := parseCleanParams([]byte(`User-agent: *
+Disallow: /private
+clean-param: sid&ref /forum/*.php # session parameters
+Clean-param: utm_source
+Clean-param:
+`))
+
+	if assert.Len(t, directives, 2) {
+		assert.Equal(t, []string{"sid", "ref"}, directives[0].params)
+		assert.True(t, directives[0].path.MatchString("/forum/index.php"))
+		assert.True(t, directives[0].path.MatchString("/forum/sub/thread.php?x"))
+		assert.False(t, directives[0].path.MatchString("/news/forum/index.php"))
+		assert.Equal(t, []string{"utm_source"}, directives[1].params)
+		assert.Nil(t, directives[1].path)
+	}
+}
+
+func TestHarvester_WithRespectCleanParam(t *testing.T) {
+	var fetched []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nClean-param: sid&ref /forum/\n\nClean-param: utm_source\n"))
+			return
+		}
+		fetched = append(fetched, r.URL.RequestURI())
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithRespectCleanParam(true))
+
+	assert.NoError(t, h.Visit(server.URL+"/forum/topic?id=1&sid=a"))
+	assert.ErrorContains(t, h.Visit(server.URL+"/forum/topic?sid=b&id=1&ref=home"), "already been visited")
+	assert.NoError(t, h.Visit(server.URL+"/forum/topic?id=2&sid=a"))
+	assert.NoError(t, h.Visit(server.URL+"/news?sid=a"))
+	assert.NoError(t, h.Visit(server.URL+"/news?sid=b"))
+	assert.NoError(t, h.Visit(server.URL+"/news?utm_source=feed"))
+	assert.ErrorContains(t, h.Visit(server.URL+"/news?utm_source=mail"), "already been visited")
+
+	// The URLs are fetched with their parameters.
+	assert.Equal(t, []string{
+		"/forum/topic?id=1&sid=a",
+		"/forum/topic?id=2&sid=a",
+		"/news?sid=a",
+		"/news?sid=b",
+		"/news?utm_source=feed",
+	}, fetched)
+
+	t.Run("Disabled", func(t *testing.T) {
+		fetched = nil
+		h := newTestHarvester()
+
+		assert.NoError(t, h.Visit(server.URL+"/forum/topic?id=1&sid=a"))
+		assert.NoError(t, h.Visit(server.URL+"/forum/topic?id=1&sid=b"))
+		assert.Len(t, fetched, 2)
+	})
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ConfigSnapshot is a snapshot of the effective configuration of a Harvester, returned by
+// Harvester.Config to check which options took effect, e.g. when a crawl misbehaves. It can be
+// marshaled, and String formats it for logs. Credentials are redacted: proxy URLs have their password
+// replaced, and only the user name of the proxy credentials is included. Functions, such as the
+// WithDelayFunc function, are reported by whether they are set.
+type ConfigSnapshot struct {
+	AllowedURLs               []string
+	DisallowedURLs            []string
+	Scope                     ScopeConfig
+	URLTemplates              []string
+	DepthLimit                int
+	AllowRevisit              bool
+	IgnoreRobots              bool
+	RobotsAgents              []string
+	DisallowOnRobotsRateLimit bool
+	RespectCleanParam         bool
+	Store                     string
+	Backend                   string
+	Transport                 string
+	Timeout                   time.Duration
+	Proxies                   []string
+	ProxyFunc                 bool
+	ProxyUser                 string
+	LocalAddrs                []string
+	StickyLocalAddrs          bool
+	DialContext               bool
+	RandomHeaderOrder         bool
+	Cookies                   bool
+	RefererPolicy             string
+	DelayFunc                 bool
+	InitialDelay              time.Duration
+	MaxConcurrency            int
+	MaxInFlightBytes          int64
+	MaxTotalBytes             int64
+	MaxBytesPerHost           int64
+	MaxDuration               time.Duration
+	MaxResponseTime           time.Duration
+	SlowRequestThreshold      time.Duration
+	HeadProbe                 bool
+	Preflight                 bool
+	StreamingLinks            bool
+	FollowHeaderLinks         bool
+	FollowFrames              bool
+	CollapseWWW               bool
+	TrimURLWhitespace         bool
+	ResumableDownloads        bool
+	HTTPTrace                 bool
+	BufferPool                bool
+	HostStats                 bool
+	LinkGraph                 bool
+	CheckExternalLinks        bool
+	HAR                       bool
+	Debugger                  string
+	Instrumentation           bool
+	Middlewares               map[MiddlewareKind]int
+}
+
+// ScopeConfig is the CrawlScope of a ConfigSnapshot, with the denied path patterns as strings.
+type ScopeConfig struct {
+	AllowedSchemes      []string
+	AllowedDomains      []string
+	IncludeSubdomains   bool
+	AllowedPathPrefixes []string
+	DeniedPathPatterns  []string
+}
+
+// Config returns a snapshot of the effective configuration of the Harvester.
+func (h *Harvester) Config() ConfigSnapshot {
+	h.mu.RLock()
+	allowed, disallowed, depthLimit, delayFunc := h.AllowedURLs, h.DisallowedURLs, h.DepthLimit, h.delayFunc
+	middlewares := map[MiddlewareKind]int{
+		MiddlewareRequest:  len(h.requestMiddlewares),
+		MiddlewareResponse: len(h.responseMiddlewares),
+		MiddlewareStatus:   len(h.statusMiddlewares),
+		MiddlewareHtml:     len(h.htmlMiddlewares),
+	}
+	h.mu.RUnlock()
+
+	c := ConfigSnapshot{
+		AllowedURLs:               allowed,
+		DisallowedURLs:            disallowed,
+		DepthLimit:                depthLimit,
+		AllowRevisit:              h.AllowRevisit,
+		IgnoreRobots:              h.ignoreRobots,
+		RobotsAgents:              h.robotsAgents,
+		DisallowOnRobotsRateLimit: h.robotsRateLimitDeny,
+		RespectCleanParam:         h.respectCleanParam,
+		Store:                     typeName(h.store),
+		Backend:                   typeName(h.backend),
+		ProxyFunc:                 h.proxyFunc != nil,
+		LocalAddrs:                h.localAddrs,
+		StickyLocalAddrs:          h.stickyLocalAddrs,
+		DialContext:               h.dialContext != nil,
+		RandomHeaderOrder:         h.randomHeaderOrder,
+		RefererPolicy:             h.refererPolicy,
+		DelayFunc:                 delayFunc != nil,
+		MaxConcurrency:            h.concurrency.maxConcurrency(),
+		MaxDuration:               h.maxDuration,
+		MaxResponseTime:           h.maxResponseTime,
+		HeadProbe:                 h.headProbe != nil && h.headProbe.fn != nil,
+		Preflight:                 h.headProbe != nil && h.headProbe.preflight,
+		StreamingLinks:            h.streamingLinks,
+		FollowHeaderLinks:         h.followHeaderLinks,
+		FollowFrames:              h.followFrames,
+		CollapseWWW:               h.collapseWWW,
+		TrimURLWhitespace:         h.trimURLWhitespace,
+		ResumableDownloads:        h.resumableDownloads,
+		HTTPTrace:                 h.httpTrace,
+		BufferPool:                h.bufferPool != nil,
+		HostStats:                 h.hostStats,
+		LinkGraph:                 h.graph != nil,
+		CheckExternalLinks:        h.checkExternalLinks,
+		HAR:                       h.har != nil,
+		Debugger:                  typeName(h.debugger),
+		Instrumentation:           h.hooks != nil,
+		Middlewares:               middlewares,
+	}
+
+	c.Scope = ScopeConfig{
+		AllowedSchemes:      h.scope.AllowedSchemes,
+		AllowedDomains:      h.scope.AllowedDomains,
+		IncludeSubdomains:   h.scope.IncludeSubdomains,
+		AllowedPathPrefixes: h.scope.AllowedPathPrefixes,
+	}
+	for _, pattern := range h.scope.DeniedPathPatterns {
+		c.Scope.DeniedPathPatterns = append(c.Scope.DeniedPathPatterns, pattern.String())
+	}
+
+	for _, template := range h.urlTemplates {
+		c.URLTemplates = append(c.URLTemplates, "/"+strings.Join(template, "/"))
+	}
+
+	if h.Client != nil {
+		c.Transport = typeName(h.Client.Transport)
+		c.Timeout = h.Client.Timeout
+		c.Cookies = h.Client.Jar != nil
+	}
+
+	switch {
+	case h.proxyPool != nil:
+		for _, p := range h.proxyPool.proxies {
+			c.Proxies = append(c.Proxies, p.url.Redacted())
+		}
+	case h.proxyURL != nil:
+		c.Proxies = []string{h.proxyURL.Redacted()}
+	}
+	if h.proxyUser != nil {
+		c.ProxyUser = h.proxyUser.Username()
+	}
+
+	if h.initialDelay != nil {
+		c.InitialDelay = h.initialDelay.max
+	}
+
+	if h.inFlightBytes != nil {
+		c.MaxInFlightBytes = h.inFlightBytes.limit
+	}
+
+	if h.budget != nil {
+		c.MaxTotalBytes = h.budget.total
+		c.MaxBytesPerHost = h.budget.perHost
+	}
+
+	if h.slowRequest != nil {
+		c.SlowRequestThreshold = h.slowRequest.threshold
+	}
+
+	return c
+}
+
+// String returns the settings of the snapshot that are not zero or empty, one "Name: value" line per setting
+// in the order of the fields, e.g. "DepthLimit: 3".
+func (c ConfigSnapshot) String() string {
+	var b strings.Builder
+
+	v := reflect.ValueOf(c)
+	for i := range v.NumField() {
+		field := v.Field(i)
+		if field.IsZero() || (field.Kind() == reflect.Slice || field.Kind() == reflect.Map) && field.Len() == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %+v\n", v.Type().Field(i).Name, field.Interface())
+	}
+
+	return b.String()
+}
+
+// typeName returns the name of the dynamic type of v, or an empty string if v is nil.
+func typeName(v any) string {
+	if v == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%T", v)
+}
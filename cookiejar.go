@@ -0,0 +1,203 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookieStorer is an interface for stores that can persist the cookies of a PersistentJar.
+// The InMemoryStore implements it and saves the cookies with Harvester.SaveState.
+type CookieStorer interface {
+	// SaveCookies stores the encoded cookies, replacing the stored cookies.
+	SaveCookies(data []byte) error
+	// LoadCookies returns the encoded cookies, nil if none are stored.
+	LoadCookies() ([]byte, error)
+}
+
+// PersistentJar is an http.CookieJar saving its cookies to a CookieStorer whenever they change and
+// loading them when it is created, so that sessions survive restarts of the crawler. The cookies are
+// kept in a standard cookiejar.Jar and loaded by setting them again for the URL they were received
+// from, so the domain and public suffix rules of the standard jar apply as when they were received.
+type PersistentJar struct {
+	jar     *cookiejar.Jar
+	store   CookieStorer
+	cookies map[string]persistentCookie
+	logger  *slog.Logger
+	lock    sync.Mutex
+}
+
+// persistentCookie is the stored form of a cookie and the URL it was received from.
+type persistentCookie struct {
+	URL      string        `json:"url"`
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Domain   string        `json:"domain,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Expires  time.Time     `json:"expires,omitempty"`
+	Secure   bool          `json:"secure,omitempty"`
+	HttpOnly bool          `json:"http_only,omitempty"`
+	SameSite http.SameSite `json:"same_site,omitempty"`
+}
+
+// WithPersistentCookies is a functional option that enables cookies with a PersistentJar saving them
+// to the store of the Harvester, which must implement CookieStorer. The jar uses the public suffix
+// list of golang.org/x/net/publicsuffix.
+func WithPersistentCookies(enabled bool) Options {
+	return func(h *Harvester) {
+		h.persistentCookies = enabled
+	}
+}
+
+// NewPersistentJar creates a new PersistentJar with the cookies of the store, pruning the expired
+// cookies. The options are passed to cookiejar.New.
+func NewPersistentJar(store CookieStorer, options *cookiejar.Options) (*PersistentJar, error) {
+	jar, err := cookiejar.New(options)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PersistentJar{
+		jar:     jar,
+		store:   store,
+		cookies: make(map[string]persistentCookie),
+		logger:  slog.Default(),
+	}
+
+	data, err := store.LoadCookies()
+	if err != nil || data == nil {
+		return p, err
+	}
+
+	var stored []persistentCookie
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, c := range stored {
+		u, err := url.Parse(c.URL)
+		if err != nil || !c.Expires.IsZero() && !c.Expires.After(now) {
+			continue
+		}
+
+		p.jar.SetCookies(u, []*http.Cookie{c.cookie()})
+		p.cookies[c.key(u)] = c
+	}
+
+	return p, nil
+}
+
+// SetCookies stores the cookies received from the URL in the jar and saves the cookies of the jar.
+func (p *PersistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	p.jar.SetCookies(u, cookies)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	for _, cookie := range cookies {
+		c := persistentCookie{
+			URL:      u.String(),
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SameSite: cookie.SameSite,
+		}
+		// A relative Max-Age is stored as an absolute expiry time.
+		if cookie.MaxAge > 0 {
+			c.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+
+		if cookie.MaxAge < 0 || !c.Expires.IsZero() && !c.Expires.After(now) {
+			delete(p.cookies, c.key(u))
+			continue
+		}
+		p.cookies[c.key(u)] = c
+	}
+
+	p.save()
+}
+
+// Cookies returns the cookies to send in a request to the URL.
+func (p *PersistentJar) Cookies(u *url.URL) []*http.Cookie {
+	return p.jar.Cookies(u)
+}
+
+// save writes the cookies of the jar to the store. Must be called with the lock held.
+func (p *PersistentJar) save() {
+	stored := make([]persistentCookie, 0, len(p.cookies))
+	for _, c := range p.cookies {
+		stored = append(stored, c)
+	}
+
+	data, err := json.Marshal(stored)
+	if err == nil {
+		err = p.store.SaveCookies(data)
+	}
+	if err != nil {
+		p.logger.Warn("error saving cookies", slog.Any("error", err))
+	}
+}
+
+// cookie returns the stored cookie as an http.Cookie.
+func (c persistentCookie) cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		SameSite: c.SameSite,
+	}
+}
+
+// key identifies the cookie by the host it was received from, its domain, path and name.
+func (c persistentCookie) key(u *url.URL) string {
+	return u.Hostname() + ";" + c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+// newPersistentJar creates a PersistentJar over the store of the Harvester for WithPersistentCookies.
+func (h *Harvester) newPersistentJar() http.CookieJar {
+	store, ok := h.store.(CookieStorer)
+	if !ok {
+		h.logger.Warn("cookies not persisted, the store does not implement CookieStorer")
+		return nil
+	}
+
+	jar, err := NewPersistentJar(store, &cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		h.logger.Warn("error loading cookies", slog.Any("error", err))
+		return nil
+	}
+	jar.logger = h.logger
+
+	return jar
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+)
+
+// WithCookieJar is a functional option that sets the cookie jar of a copy of the client of the
+// Harvester, shared by every request including robots.txt requests.
+func WithCookieJar(jar http.CookieJar) Options {
+	return func(h *Harvester) {
+		h.cookieJar = jar
+	}
+}
+
+// WithCookies is a functional option that enables cookies with an in-memory cookie jar, unless a
+// jar is set with WithCookieJar or the client set with WithClient has a jar of its own.
+func WithCookies(enabled bool) Options {
+	return func(h *Harvester) {
+		h.cookies = enabled
+	}
+}
+
+// applyCookieJar sets the cookie jar of the Harvester on a copy of its client.
+func (h *Harvester) applyCookieJar() {
+	jar := h.cookieJar
+	if jar == nil && h.persistentCookies {
+		jar = h.newPersistentJar()
+	}
+	if jar == nil && h.cookies && h.Client.Jar == nil {
+		// cookiejar.New never returns an error.
+		jar, _ = cookiejar.New(nil)
+	}
+
+	if jar == nil {
+		return
+	}
+
+	client := *h.Client
+	client.Jar = jar
+	h.Client = &client
+}
+
+// SetCookies stores the cookies for the URL in the cookie jar of the Harvester, e.g. to inject the
+// session cookie of a login. The cookies are not stored if the Harvester has no cookie jar.
+func (h *Harvester) SetCookies(u string, cookies []*http.Cookie) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		h.logger.Warn("error parsing cookie URL", slog.String("url", u), slog.Any("error", err))
+		return
+	}
+
+	if h.Client.Jar == nil {
+		h.logger.Warn("cookies not set, the Harvester has no cookie jar", slog.String("url", u))
+		return
+	}
+
+	h.Client.Jar.SetCookies(parsedURL, cookies)
+}
+
+// Cookies returns the cookies the cookie jar of the Harvester sends to the URL, nil if the
+// Harvester has no cookie jar.
+func (h *Harvester) Cookies(u string) []*http.Cookie {
+	parsedURL, err := url.Parse(u)
+	if err != nil || h.Client.Jar == nil {
+		return nil
+	}
+
+	return h.Client.Jar.Cookies(parsedURL)
+}
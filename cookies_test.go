@@ -0,0 +1,165 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/publicsuffix"
+)
+
+func newTestSessionServer(robotsCookies *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			cookie, _ := r.Cookie("session")
+			if cookie != nil {
+				*robotsCookies = append(*robotsCookies, cookie.Value)
+			}
+			w.WriteHeader(http.StatusNotFound)
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			w.Write(helloBytes)
+		case "/account":
+			if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write(helloBytes)
+		}
+	}))
+}
+
+func TestHarvester_WithCookies(t *testing.T) {
+	var robotsCookies []string
+	server := newTestSessionServer(&robotsCookies)
+	defer server.Close()
+
+	statusCodes := func(h *Harvester) *[]int {
+		codes := &[]int{}
+		h.ResponseDo(func(res *Response) {
+			*codes = append(*codes, res.StatusCode)
+		})
+		return codes
+	}
+
+	t.Run("Without a cookie jar", func(t *testing.T) {
+		h := newTestHarvester()
+		codes := statusCodes(h)
+
+		assert.NoError(t, h.Visit(server.URL+"/login"))
+		assert.NoError(t, h.Visit(server.URL+"/account"))
+		assert.Equal(t, []int{http.StatusOK, http.StatusUnauthorized}, *codes)
+	})
+
+	t.Run("With cookies", func(t *testing.T) {
+		h := newTestHarvester(WithCookies(true))
+		codes := statusCodes(h)
+
+		assert.NoError(t, h.Visit(server.URL+"/login"))
+		assert.NoError(t, h.Visit(server.URL+"/account"))
+		assert.Equal(t, []int{http.StatusOK, http.StatusOK}, *codes)
+		assert.Len(t, h.Cookies(server.URL), 1)
+		assert.Equal(t, "abc", h.Cookies(server.URL)[0].Value)
+	})
+
+	t.Run("With cookie jar", func(t *testing.T) {
+		robotsCookies = nil
+		jar, _ := cookiejar.New(nil)
+		h := newTestHarvester(WithCookieJar(jar))
+		codes := statusCodes(h)
+
+		h.SetCookies(server.URL, []*http.Cookie{{Name: "session", Value: "abc"}})
+
+		assert.NoError(t, h.Visit(server.URL+"/account"))
+		assert.Equal(t, []int{http.StatusOK}, *codes)
+		assert.Equal(t, []string{"abc"}, robotsCookies, "robots.txt requests share the jar")
+		assert.Same(t, jar, h.Client.Jar)
+	})
+}
+
+func TestHarvester_WithPersistentCookies(t *testing.T) {
+	var robotsCookies []string
+	server := newTestSessionServer(&robotsCookies)
+	defer server.Close()
+
+	store := NewInMemoryStore()
+	h := newTestHarvester(WithStore(store), WithPersistentCookies(true))
+	assert.NoError(t, h.Visit(server.URL+"/login"))
+
+	// A new Harvester over the same store sends the cookie without logging in.
+	h = newTestHarvester(WithStore(NewInMemoryStore()), WithPersistentCookies(true))
+	var statusCode int
+	h.ResponseDo(func(res *Response) {
+		statusCode = res.StatusCode
+	})
+	assert.NoError(t, h.Visit(server.URL+"/account"))
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+
+	h = newTestHarvester(WithStore(store), WithPersistentCookies(true))
+	h.ResponseDo(func(res *Response) {
+		statusCode = res.StatusCode
+	})
+	assert.NoError(t, h.Visit(server.URL+"/account"))
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	// The cookies are saved and restored with the state of the Harvester.
+	var buf bytes.Buffer
+	assert.NoError(t, h.SaveState(&buf))
+
+	restored := NewInMemoryStore()
+	h = newTestHarvester(WithStore(restored))
+	assert.NoError(t, h.LoadState(&buf))
+	h = newTestHarvester(WithStore(restored), WithPersistentCookies(true))
+	assert.Len(t, h.Cookies(server.URL), 1)
+}
+
+func TestPersistentJar(t *testing.T) {
+	store := NewInMemoryStore()
+	store.SaveCookies([]byte(`[
+		{"url": "https://example.co.uk/", "name": "session", "value": "abc", "expires": "2999-01-01T00:00:00Z"},
+		{"url": "https://example.co.uk/", "name": "expired", "value": "old", "expires": "2000-01-01T00:00:00Z"},
+		{"url": "https://example.co.uk/", "name": "tracking", "value": "all", "domain": "co.uk"}
+	]`))
+
+	jar, err := NewPersistentJar(store, &cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	assert.NoError(t, err)
+
+	u, _ := url.Parse("https://example.co.uk/")
+	cookies := jar.Cookies(u)
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, "session", cookies[0].Name)
+
+	other, _ := url.Parse("https://other.co.uk/")
+	assert.Empty(t, jar.Cookies(other), "cookies for a public suffix are rejected")
+
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "", MaxAge: -1},
+		{Name: "theme", Value: "dark", MaxAge: 3600},
+	})
+
+	data, err := store.LoadCookies()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "expired")
+	assert.NotContains(t, string(data), `"session"`)
+	assert.Contains(t, string(data), `"theme"`)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"time"
+)
+
+// hostGate serializes the requests to a host and spaces them by its Crawl-delay.
+type hostGate struct {
+	slot chan struct{}
+	last time.Time
+}
+
+// crawlDelay returns the Crawl-delay of the robots.txt group matching the user agents of the
+// Harvester for the host, or 0 if robots.txt is ignored or has no Crawl-delay for them.
+func (h *Harvester) crawlDelay(host string) time.Duration {
+	if h.ignoreRobots {
+		return 0
+	}
+
+	h.mu.RLock()
+	robot, ok := h.robotsMap[host]
+	h.mu.RUnlock()
+
+	if !ok {
+		return 0
+	}
+
+	return robot.FindGroup(robotsAgent(robot, h.robotsAgents)).CrawlDelay
+}
+
+// enterCrawlDelay waits until no other request to the host is running and its Crawl-delay has passed
+// since the previous request to it ended, if its robots.txt has a Crawl-delay. The returned function
+// must be called when the request ends.
+func (h *Harvester) enterCrawlDelay(ctx context.Context, host string) (func(), error) {
+	delay := h.crawlDelay(host)
+	if delay <= 0 {
+		return func() {}, nil
+	}
+
+	h.mu.Lock()
+	gate, ok := h.hostGates[host]
+	if !ok {
+		gate = &hostGate{slot: make(chan struct{}, 1)}
+		h.hostGates[host] = gate
+	}
+	h.mu.Unlock()
+
+	select {
+	case gate.slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	release := func() {
+		gate.last = time.Now()
+		<-gate.slot
+	}
+
+	if wait := time.Until(gate.last.Add(delay)); wait > 0 {
+		if err := h.wait(wait); err != nil {
+			<-gate.slot
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
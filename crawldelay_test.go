@@ -0,0 +1,100 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_CrawlDelay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the Crawl-delay")
+	}
+
+	var (
+		running    atomic.Int32
+		maxRunning atomic.Int32
+		lock       sync.Mutex
+		starts     []time.Time
+		ends       []time.Time
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nCrawl-delay: 2\n"))
+			return
+		}
+
+		n := running.Add(1)
+		defer running.Add(-1)
+		if n > maxRunning.Load() {
+			maxRunning.Store(n)
+		}
+
+		lock.Lock()
+		starts = append(starts, time.Now())
+		lock.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+		w.Write(helloBytes)
+
+		lock.Lock()
+		ends = append(ends, time.Now())
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	h := newTestHarvester()
+
+	var wg sync.WaitGroup
+	for _, path := range []string{"/a", "/b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, h.Visit(server.URL+path))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), maxRunning.Load())
+	if assert.Len(t, starts, 2) {
+		assert.GreaterOrEqual(t, starts[1].Sub(ends[0]), 2*time.Second-100*time.Millisecond)
+	}
+}
+
+func TestHarvester_CrawlDelay_IgnoreRobots(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nCrawl-delay: 2\n"))
+			return
+		}
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	start := time.Now()
+	assert.NoError(t, h.Visit(server.URL+"/a"))
+	assert.NoError(t, h.Visit(server.URL+"/b"))
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Column is a column of a CSV export. The value of the column is computed with the Value
+// function if set, otherwise it is the trimmed text of the first element matching the Selector.
+type Column struct {
+	Name     string
+	Selector string
+	Value    func(res *Response) string
+}
+
+// CSVExporter writes one CSV row per exported response. It is safe to use from concurrent callbacks.
+//
+//	exporter := grawlr.NewCSVExporter(f, columns)
+//	h.ResponseDo(func(res *grawlr.Response) {
+//		exporter.Export(res)
+//	})
+type CSVExporter struct {
+	// FlushEachRow flushes the underlying writer after every row, so that a crash loses at most
+	// the row being written.
+	FlushEachRow bool
+
+	w           *csv.Writer
+	columns     []Column
+	wroteHeader bool
+	mu          sync.Mutex
+}
+
+// NewCSVExporter creates a new CSVExporter writing the given columns to w.
+// The header row is written before the first row.
+func NewCSVExporter(w io.Writer, columns []Column) *CSVExporter {
+	return &CSVExporter{
+		w:       csv.NewWriter(w),
+		columns: columns,
+	}
+}
+
+// Export writes a row with the column values of the response.
+func (e *CSVExporter) Export(res *Response) error {
+	row := e.row(res)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	if err := e.w.Write(row); err != nil {
+		return err
+	}
+
+	if e.FlushEachRow {
+		e.w.Flush()
+	}
+
+	return e.w.Error()
+}
+
+// Write writes a row with the column values of the response the item was emitted from,
+// so that a CSVExporter can be used as a Sink.
+func (e *CSVExporter) Write(item Item) error {
+	return e.Export(item.Response)
+}
+
+// Close flushes the exporter, so that a CSVExporter can be used as a Sink. It does not close the underlying writer.
+func (e *CSVExporter) Close() error {
+	return e.Flush()
+}
+
+// Flush writes the header if no rows were exported and flushes any buffered rows to the underlying writer.
+func (e *CSVExporter) Flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *CSVExporter) writeHeader() error {
+	if e.wroteHeader {
+		return nil
+	}
+	e.wroteHeader = true
+
+	header := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		header[i] = c.Name
+	}
+
+	return e.w.Write(header)
+}
+
+// row computes the column values of the response, parsing the body only if a column uses a selector.
+func (e *CSVExporter) row(res *Response) []string {
+	var doc *goquery.Document
+
+	row := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		if c.Value != nil {
+			row[i] = c.Value(res)
+			continue
+		}
+
+		if doc == nil {
+			var err error
+			doc, err = goquery.NewDocumentFromReader(bytes.NewReader(res.content))
+			if err != nil {
+				continue
+			}
+		}
+
+		row[i] = strings.TrimSpace(doc.Find(c.Selector).First().Text())
+	}
+
+	return row
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVExporter(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	exporter := NewCSVExporter(&buf, []Column{
+		{Name: "path", Value: func(res *Response) string { return res.Request.URL.Path }},
+		{Name: "status", Value: func(res *Response) string { return strconv.Itoa(res.StatusCode) }},
+		{Name: "title", Selector: "title"},
+		{Name: "heading", Selector: "h1"},
+		{Name: "first_link", Selector: "li a"},
+	})
+
+	h := newTestHarvester(WithDepthLimit(2))
+	h.ResponseDo(func(res *Response) {
+		assert.NoError(t, exporter.Export(res))
+	})
+	h.HtmlDo(`a[href="/"]`, func(el *HtmlElement) {
+		el.Request.Visit(el.Request.GetAbsoluteURL(el.Attribute("href")))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+	assert.NoError(t, exporter.Flush())
+
+	golden, err := os.ReadFile("testdata/csv_export.golden")
+	assert.NoError(t, err)
+	assert.Equal(t, string(golden), buf.String())
+}
+
+func TestCSVExporter_Quoting(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := NewCSVExporter(&buf, []Column{
+		{Name: "value", Value: func(*Response) string { return `say "hi", world` }},
+	})
+	exporter.FlushEachRow = true
+
+	assert.NoError(t, exporter.Export(&Response{}))
+	assert.Equal(t, "value\n\"say \"\"hi\"\", world\"\n", buf.String())
+}
+
+func TestCSVExporter_Concurrent(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := NewCSVExporter(&buf, []Column{
+		{Name: "value", Value: func(*Response) string { return "row" }},
+	})
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, exporter.Export(&Response{}))
+		}()
+	}
+	wg.Wait()
+
+	assert.NoError(t, exporter.Flush())
+	assert.Equal(t, 51, bytes.Count(buf.Bytes(), []byte("\n")))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("value\n")))
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMaxDurationElapsed is returned for a URL that is not visited because the maximum duration of
+	// the crawl has elapsed.
+	ErrMaxDurationElapsed = func(u string) error {
+		return fmt.Errorf("URL %s was not visited: the maximum crawl duration has elapsed", u)
+	}
+	// ErrCrawlDeadline is returned by Wait when the crawl was cut short by the maximum duration of the
+	// crawl, with the number of URLs that were not visited.
+	ErrCrawlDeadline = func(d time.Duration, remaining int64) error {
+		return fmt.Errorf("crawl stopped after the maximum duration of %s: %d URLs were not visited", d, remaining)
+	}
+)
+
+// WithMaxDuration is a functional option that limits the duration of the crawl, counted from the
+// first Visit of the Harvester like Stats.Elapsed, so that it includes the time of a crawl resumed
+// with LoadState. When the duration has elapsed, the Harvester stops accepting new URLs, which fail
+// with ErrMaxDurationElapsed and are counted in Stats.SkippedDeadline, while the requests already
+// sent finish normally. Use Wait to wait for them and learn whether the crawl was cut short.
+func WithMaxDuration(d time.Duration) Options {
+	return func(h *Harvester) {
+		h.maxDuration = d
+	}
+}
+
+// visitTracker counts the running Visits of a Harvester for Wait.
+type visitTracker struct {
+	running int
+	cond    *sync.Cond
+}
+
+func newVisitTracker() *visitTracker {
+	return &visitTracker{
+		cond: sync.NewCond(&sync.Mutex{}),
+	}
+}
+
+// track records the start of a Visit and returns a function recording its end.
+func (t *visitTracker) track() func() {
+	t.cond.L.Lock()
+	t.running++
+	t.cond.L.Unlock()
+
+	return func() {
+		t.cond.L.Lock()
+		t.running--
+		if t.running == 0 {
+			t.cond.Broadcast()
+		}
+		t.cond.L.Unlock()
+	}
+}
+
+// wait blocks until no Visit is running.
+func (t *visitTracker) wait() {
+	t.cond.L.Lock()
+	for t.running > 0 {
+		t.cond.Wait()
+	}
+	t.cond.L.Unlock()
+}
+
+// Wait blocks until the Visits running in other goroutines have returned, and returns the crawl
+// counters. The error is ErrCrawlDeadline if URLs were not visited because the maximum duration set
+// with WithMaxDuration elapsed. Wait should be called after the goroutines have called Visit, as
+// Visits started later are not waited for. Wait delivers WebhookFinished if WithWebhook is set.
+func (h *Harvester) Wait() (Stats, error) {
+	h.visits.wait()
+
+	stats := h.Stats()
+	if h.webhook != nil {
+		h.webhook.notify(WebhookPayload{Event: WebhookFinished, Stats: stats})
+	}
+	if stats.SkippedDeadline > 0 {
+		return stats, ErrCrawlDeadline(h.maxDuration, stats.SkippedDeadline)
+	}
+	return stats, nil
+}
+
+// checkDeadline returns ErrMaxDurationElapsed if the maximum duration of the crawl has elapsed.
+func (h *Harvester) checkDeadline(u *url.URL, depth int) error {
+	if h.maxDuration <= 0 || h.stats.elapsed() < h.maxDuration {
+		return nil
+	}
+
+	h.stats.skippedDeadline.Add(1)
+	err := ErrMaxDurationElapsed(u.String())
+	h.debug(EventFilteredOut, u.String(), depth, 0, err)
+	return err
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMaxDuration(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			time.Sleep(40 * time.Millisecond)
+			w.Write(helloBytes)
+			return
+		}
+
+		var links strings.Builder
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(&links, `<a href="/page/%d">page</a>`, i)
+		}
+		w.Write([]byte("<html><body>" + links.String() + "</body></html>"))
+	}))
+	defer ts.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithMaxDuration(100*time.Millisecond))
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		el.Visit(el.Attribute("href"))
+	})
+
+	var visited int
+	h.ResponseDo(func(res *Response) {
+		visited++
+	})
+
+	assert.NoError(t, h.Visit(ts.URL))
+
+	stats, err := h.Wait()
+	assert.EqualError(t, err, fmt.Sprintf(
+		"crawl stopped after the maximum duration of 100ms: %d URLs were not visited", stats.SkippedDeadline,
+	))
+	assert.Greater(t, stats.SkippedDeadline, int64(0))
+	assert.Equal(t, int64(11), stats.RequestsAttempted+stats.SkippedDeadline)
+	assert.Equal(t, int(stats.RequestsAttempted), visited, "requests sent before the deadline finish")
+
+	assert.EqualError(t, h.Visit(ts.URL+"/late"), fmt.Sprintf(
+		"URL %s/late was not visited: the maximum crawl duration has elapsed", ts.URL,
+	))
+}
+
+func TestHarvester_Wait(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write(helloBytes)
+	}))
+	defer ts.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	started := make(chan struct{}, 3)
+	h.RequestDo(func(req *Request) {
+		started <- struct{}{}
+	})
+
+	for i := 0; i < 3; i++ {
+		go h.Visit(fmt.Sprintf("%s/%d", ts.URL, i))
+	}
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+
+	stats, err := h.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.RequestsSucceeded)
+	assert.Equal(t, int64(0), stats.InFlight)
+}
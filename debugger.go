@@ -0,0 +1,129 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType is the type of a crawl lifecycle event emitted to a Debugger.
+type EventType string
+
+const (
+	// EventRequestQueued is emitted when a URL is passed to the Harvester for fetching.
+	EventRequestQueued EventType = "request_queued"
+	// EventRequestStarted is emitted right before a request is sent.
+	EventRequestStarted EventType = "request_started"
+	// EventResponseReceived is emitted when a response and its body have been received.
+	EventResponseReceived EventType = "response_received"
+	// EventRobotsDenied is emitted when robots.txt disallows a URL.
+	EventRobotsDenied EventType = "robots_denied"
+	// EventFilteredOut is emitted when a URL is filtered out by the URL filters,
+	// the depth limit or a BeforeVisit callback.
+	EventFilteredOut EventType = "filtered_out"
+	// EventVisitedSkip is emitted when a URL is skipped because it has already been visited.
+	EventVisitedSkip EventType = "visited_skip"
+	// EventCallbackError is emitted when the callbacks of a response could not be run,
+	// for example because the response body could not be parsed, and when a middleware panics,
+	// naming the middleware in the Middleware field of the event.
+	EventCallbackError EventType = "callback_error"
+	// EventAuthChallenge is emitted when a request is retried with the headers returned by an
+	// AuthChallengeDo callback for a 401 Unauthorized response.
+	EventAuthChallenge EventType = "auth_challenge"
+)
+
+// DebugEvent is a crawl lifecycle event emitted to a Debugger.
+type DebugEvent struct {
+	// Type is the type of the event.
+	Type EventType
+	// URL is the URL the event relates to.
+	URL string
+	// Depth is the depth of the request the event relates to.
+	Depth int
+	// Time is the time the event was emitted.
+	Time time.Time
+	// StatusCode is the status code of the response, 0 if there is none.
+	StatusCode int
+	// Err is the error related to the event, if any.
+	Err error
+	// Middleware is the name of the middleware the event relates to, if any.
+	Middleware string
+}
+
+// Debugger is an interface for receiving the crawl lifecycle events of a Harvester.
+// Can be set with the WithDebugger functional option.
+type Debugger interface {
+	// Event is called for every crawl lifecycle event.
+	Event(e DebugEvent)
+}
+
+// LogDebugger is a Debugger that writes human-readable event lines to an io.Writer.
+type LogDebugger struct {
+	w    io.Writer
+	lock *sync.Mutex
+}
+
+// NewLogDebugger creates a new LogDebugger writing to the given io.Writer.
+func NewLogDebugger(w io.Writer) *LogDebugger {
+	return &LogDebugger{
+		w:    w,
+		lock: &sync.Mutex{},
+	}
+}
+
+// Event writes the event as a single line.
+func (d *LogDebugger) Event(e DebugEvent) {
+	line := fmt.Sprintf("[grawlr] %s %-17s depth=%d url=%s", e.Time.Format(time.RFC3339Nano), e.Type, e.Depth, e.URL)
+	if e.StatusCode != 0 {
+		line += fmt.Sprintf(" status=%d", e.StatusCode)
+	}
+	if e.Middleware != "" {
+		line += fmt.Sprintf(" middleware=%s", e.Middleware)
+	}
+	if e.Err != nil {
+		line += fmt.Sprintf(" error=%q", e.Err)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	fmt.Fprintln(d.w, line)
+}
+
+// debug emits an event to the Debugger of the Harvester, if one is set.
+func (h *Harvester) debug(t EventType, u string, depth, statusCode int, err error) {
+	h.debugMiddleware(t, "", u, depth, statusCode, err)
+}
+
+// debugMiddleware emits an event related to the named middleware to the Debugger of the Harvester, if one is set.
+func (h *Harvester) debugMiddleware(t EventType, middleware, u string, depth, statusCode int, err error) {
+	if h.debugger == nil {
+		return
+	}
+
+	h.debugger.Event(DebugEvent{
+		Type:       t,
+		URL:        u,
+		Depth:      depth,
+		Time:       time.Now(),
+		StatusCode: statusCode,
+		Err:        err,
+		Middleware: middleware,
+	})
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingDebugger struct {
+	events []DebugEvent
+}
+
+func (d *recordingDebugger) Event(e DebugEvent) {
+	d.events = append(d.events, e)
+}
+
+func (d *recordingDebugger) types() []EventType {
+	types := make([]EventType, 0, len(d.events))
+	for _, e := range d.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestDebugger_Events(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	d := &recordingDebugger{}
+	h := newTestHarvester(WithDebugger(d), WithDisallowedURLs([]string{server.URL + "/faq"}))
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, []EventType{EventRequestQueued, EventRequestStarted, EventResponseReceived}, d.types())
+	assert.Equal(t, server.URL+"/", d.events[2].URL)
+	assert.Equal(t, 200, d.events[2].StatusCode)
+	assert.False(t, d.events[2].Time.Before(d.events[0].Time))
+
+	d.events = nil
+	h.Visit(server.URL + "/")
+	h.Visit(server.URL + "/disallowed")
+	h.Visit(server.URL + "/faq")
+	assert.Equal(t, []EventType{
+		EventRequestQueued, EventVisitedSkip,
+		EventRequestQueued, EventRobotsDenied,
+		EventRequestQueued, EventFilteredOut,
+	}, d.types())
+}
+
+func TestLogDebugger(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	h := newTestHarvester(WithDebugger(NewLogDebugger(&buf)))
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "request_queued")
+	assert.Contains(t, lines[2], "response_received")
+	assert.Contains(t, lines[2], "url="+server.URL+"/")
+	assert.Contains(t, lines[2], "status=200")
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// DelayFunc computes the delay to wait before sending the given request.
+type DelayFunc func(req *Request) time.Duration
+
+// WithInitialDelay is a functional option that delays the first request to each host, usually its
+// robots.txt request, by a random duration up to the given maximum. This staggers the start of
+// Harvesters launched at the same time, such as the shards of a distributed crawl.
+func WithInitialDelay(maxDelay time.Duration) Options {
+	return func(h *Harvester) {
+		h.initialDelay = &initialDelay{
+			max:     maxDelay,
+			started: make(map[string]struct{}),
+		}
+	}
+}
+
+// initialDelay is the random delay of the first request to each host.
+type initialDelay struct {
+	max     time.Duration
+	started map[string]struct{}
+	lock    sync.Mutex
+}
+
+// next returns the delay of the next request to the host, a random duration up to
+// the maximum for the first request and 0 for the following requests.
+func (d *initialDelay) next(host string) time.Duration {
+	if d == nil || d.max <= 0 {
+		return 0
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, ok := d.started[host]; ok {
+		return 0
+	}
+	d.started[host] = struct{}{}
+
+	return rand.N(d.max)
+}
+
+// throttle blocks before the given request is sent for the longest delay of the
+// configured delay sources, or until the Harvester's context is done.
+func (h *Harvester) throttle(req *Request) error {
+	var d time.Duration
+
+	h.mu.RLock()
+	delayFunc := h.delayFunc
+	h.mu.RUnlock()
+
+	if delayFunc != nil {
+		d = max(d, delayFunc(req))
+	}
+
+	d = max(d, h.initialDelay.next(req.Host))
+
+	if d <= 0 {
+		return nil
+	}
+
+	return h.wait(d)
+}
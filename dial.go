@@ -0,0 +1,104 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DialFunc is a type for functions that dial a network connection, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithDialContext is a functional option that dials every connection of the Harvester, including
+// the connections of robots.txt requests, with the given function, e.g. to guard against dialing
+// private addresses, to cache DNS lookups or to connect to a unix socket. The transport of the
+// client is cloned. The function is the outermost dialing layer: it can call Dial with the context
+// it receives to dial with the dialing features of the Harvester, such as WithLocalAddrs.
+func WithDialContext(fn DialFunc) Options {
+	return func(h *Harvester) {
+		h.dialContext = fn
+	}
+}
+
+// dialerContextKey is the context key of the dial function of the Harvester passed to a WithDialContext function.
+type dialerContextKey struct{}
+
+// defaultDialer is the dialer of http.DefaultTransport.
+var defaultDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// Dial dials the address with the dialing features of the Harvester, such as WithLocalAddrs, when
+// called with the context passed to a WithDialContext function. With any other context, it dials
+// like http.DefaultTransport.
+func Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial, ok := ctx.Value(dialerContextKey{}).(DialFunc); ok {
+		return dial(ctx, network, addr)
+	}
+
+	return defaultDialer.DialContext(ctx, network, addr)
+}
+
+// applyDialer sets the dialing features of the Harvester on a clone of the transport of its client.
+// Connections are dialed by the WithDialContext function, then by the local address binding of
+// WithLocalAddrs, then by the dialer of the transport.
+func (h *Harvester) applyDialer() {
+	if h.dialContext == nil && h.localAddrs == nil {
+		return
+	}
+
+	var transport *http.Transport
+	switch t := h.Client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		h.logger.Warn("dialer not set, the transport of the client is not an *http.Transport",
+			slog.String("transport", fmt.Sprintf("%T", t)),
+		)
+		return
+	}
+
+	dial := DialFunc(defaultDialer.DialContext)
+	if transport.DialContext != nil {
+		dial = transport.DialContext
+	}
+
+	if h.localAddrs != nil {
+		dial = h.localAddrDialer()
+		h.httpTrace = true
+	}
+
+	if outer := h.dialContext; outer != nil {
+		inner := dial
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return outer(context.WithValue(ctx, dialerContextKey{}, inner), network, addr)
+		}
+	}
+
+	transport.DialContext = dial
+
+	client := *h.Client
+	client.Transport = transport
+	h.Client = &client
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDialContext(t *testing.T) {
+	var lock sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.Host+r.URL.Path)
+		lock.Unlock()
+
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Write(helloBytes)
+	}))
+	defer ts.Close()
+
+	var dialed []string
+	redirect := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		lock.Lock()
+		dialed = append(dialed, addr)
+		lock.Unlock()
+		return Dial(ctx, network, ts.Listener.Addr().String())
+	}
+
+	t.Run("Redirects every host", func(t *testing.T) {
+		paths, dialed = nil, nil
+		h := newTestHarvester(WithDialContext(redirect))
+
+		var body string
+		h.ResponseDo(func(res *Response) {
+			b, _ := io.ReadAll(res.Body)
+			body = string(b)
+		})
+
+		assert.NoError(t, h.Visit("http://grawlr.invalid/"))
+		assert.Equal(t, string(helloBytes), body)
+		assert.Equal(t, []string{"grawlr.invalid/robots.txt", "grawlr.invalid/"}, paths)
+		assert.Contains(t, dialed, "grawlr.invalid:80")
+
+		assert.Error(t, h.Visit("http://grawlr.invalid/private"))
+		assert.Len(t, paths, 2)
+	})
+
+	t.Run("Composes with local addresses", func(t *testing.T) {
+		paths, dialed = nil, nil
+		h := newTestHarvester(WithDialContext(redirect), WithLocalAddrs([]string{"127.0.0.1"}))
+
+		var trace *Trace
+		h.ResponseDo(func(res *Response) {
+			trace = res.Trace
+		})
+
+		assert.NoError(t, h.Visit("http://grawlr.invalid/"))
+		if assert.NotNil(t, trace) {
+			host, _, _ := net.SplitHostPort(trace.LocalAddr)
+			assert.Equal(t, "127.0.0.1", host)
+		}
+	})
+
+	t.Run("Dial errors fail the request", func(t *testing.T) {
+		errBlocked := errors.New("blocked")
+		h := newTestHarvester(
+			WithIgnoreRobots(true),
+			WithDialContext(func(context.Context, string, string) (net.Conn, error) {
+				return nil, errBlocked
+			}),
+		)
+
+		assert.ErrorIs(t, h.Visit("http://grawlr.invalid/"), errBlocked)
+	})
+
+	t.Run("Dial outside a hook", func(t *testing.T) {
+		conn, err := Dial(context.Background(), "tcp", ts.Listener.Addr().String())
+		assert.NoError(t, err)
+		conn.Close()
+	})
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+// Element is an interface for the HTML elements passed to Html callbacks, so that scraping logic can
+// be tested with fake elements. HtmlElement implements it through the adapter returned by
+// HtmlElement.Element, as its Text, Request and Response fields cannot double as methods.
+type Element interface {
+	// Text returns the raw text of the element.
+	Text() string
+	// TrimmedText returns the text of the element with its whitespace collapsed.
+	TrimmedText() string
+	// Attribute returns the value of the attribute with the given key.
+	Attribute(key string) string
+	// ChildText returns the trimmed text of the descendants matching the given GoQuery selector.
+	ChildText(selector string) string
+	// ChildAttr returns the value of the attribute of the first descendant matching the given GoQuery selector.
+	ChildAttr(selector, key string) string
+	// Request returns the request of the page of the element.
+	Request() *Request
+	// Response returns the response of the page of the element.
+	Response() *Response
+	// Visit resolves the given link against the page of the element and visits it.
+	Visit(link string) error
+}
+
+// ElementCallback is a type for Html callbacks that receive an Element.
+type ElementCallback func(el Element)
+
+// htmlElementAdapter adapts an HtmlElement to the Element interface.
+type htmlElementAdapter struct {
+	*HtmlElement
+}
+
+// Element returns the element as an Element.
+func (e *HtmlElement) Element() Element {
+	return htmlElementAdapter{e}
+}
+
+// Text returns the raw text of the element.
+func (a htmlElementAdapter) Text() string {
+	return a.HtmlElement.Text
+}
+
+// Request returns the request of the page of the element.
+func (a htmlElementAdapter) Request() *Request {
+	return a.HtmlElement.Request
+}
+
+// Response returns the response of the page of the element.
+func (a htmlElementAdapter) Response() *Response {
+	return a.HtmlElement.Response
+}
+
+// ElementDo adds a Html middleware to the Harvester like HtmlDo, passing the matching elements
+// to the callback as an Element.
+func (h *Harvester) ElementDo(gqSelector string, fn ElementCallback) {
+	h.HtmlDo(gqSelector, func(el *HtmlElement) {
+		fn(el.Element())
+	})
+}
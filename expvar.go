@@ -0,0 +1,56 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"expvar"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// expvarStats are the crawl counters published with expvar by the WithExpvar functional option,
+// by their prefix. The counters of a prefix are rebound to the last Harvester using it, as
+// expvar does not allow publishing a name twice.
+var expvarStats sync.Map
+
+// WithExpvar is a functional option that publishes the crawl counters of the Harvester as an expvar
+// variable named prefix, served as JSON by the /debug/vars handler of the expvar package. If another
+// Harvester already publishes the same prefix, the variable is rebound to this Harvester. If the name is
+// already used by another expvar variable, a warning is logged and the counters are not published.
+func WithExpvar(prefix string) Options {
+	return func(h *Harvester) {
+		published, loaded := expvarStats.LoadOrStore(prefix, &atomic.Pointer[stats]{})
+		current := published.(*atomic.Pointer[stats])
+
+		if !loaded {
+			if expvar.Get(prefix) != nil {
+				expvarStats.Delete(prefix)
+				h.logger.Warn("expvar variable already exists", slog.String("name", prefix))
+				return
+			}
+
+			expvar.Publish(prefix, expvar.Func(func() any {
+				if s := current.Load(); s != nil {
+					return s.snapshot()
+				}
+				return Stats{}
+			}))
+		}
+
+		current.Store(h.stats)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_Expvar(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	vars := httptest.NewServer(expvar.Handler())
+	defer vars.Close()
+
+	published := func() Stats {
+		res, err := http.Get(vars.URL)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		var body map[string]json.RawMessage
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+
+		var s Stats
+		assert.NoError(t, json.Unmarshal(body["grawlr_test"], &s))
+		return s
+	}
+
+	h := newTestHarvester(WithExpvar("grawlr_test"))
+	assert.Equal(t, int64(0), published().RequestsAttempted)
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+
+	s := published()
+	assert.Equal(t, int64(2), s.RequestsAttempted)
+	assert.Equal(t, int64(1), s.ResponsesByClass["4xx"])
+	assert.Equal(t, int64(len(helloBytes)+len("404 page not found\n")), s.BytesDownloaded)
+
+	// A second Harvester with the same prefix takes over the variable instead of panicking.
+	h = newTestHarvester(WithExpvar("grawlr_test"))
+	assert.Equal(t, int64(0), published().RequestsAttempted)
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, int64(1), published().RequestsAttempted)
+
+	if expvar.Get("grawlr_taken") == nil {
+		expvar.NewInt("grawlr_taken")
+	}
+	assert.NotPanics(t, func() { newTestHarvester(WithExpvar("grawlr_taken")) })
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// fileScheme is the scheme of URLs of local files, which are read from the file system.
+const fileScheme = "file"
+
+// isFileURL reports whether the URL points to a local file.
+func isFileURL(u *url.URL) bool {
+	return u.Scheme == fileScheme
+}
+
+// fileResponse synthesizes an http.Response for a file:// request from the file it points to,
+// or from the index.html of a directory. The Content-Type is set from the file extension, or
+// sniffed from the content if the extension is unknown. Missing files respond with 404 Not Found.
+func fileResponse(req *http.Request) (*http.Response, error) {
+	name := filepath.FromSlash(req.URL.Path)
+
+	info, err := os.Stat(name)
+	if err == nil && info.IsDir() {
+		name = filepath.Join(name, "index.html")
+	}
+
+	status := http.StatusOK
+	headers := http.Header{}
+
+	b, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+		b = nil
+	case errors.Is(err, fs.ErrPermission):
+		status = http.StatusForbidden
+		b = nil
+	case err != nil:
+		return nil, err
+	default:
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(b)
+		}
+		headers.Set("Content-Type", contentType)
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          io.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}, nil
+}
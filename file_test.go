@@ -0,0 +1,88 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_FileURLs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":      `<a href="about.html">About</a> <a href="docs/">Docs</a> <a href="missing.html">Missing</a>`,
+		"about.html":      `<a href="private/secret.html">Secret</a> <a href="index.html">Home</a>`,
+		"docs/index.html": `<link rel="stylesheet" href="../style.css"><a href="../about.html">About</a>`,
+		"style.css":       `body {}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	root := "file://" + filepath.ToSlash(dir)
+	h := newTestHarvester(WithDisallowedURLs([]string{root + "/private"}))
+
+	visited := make(map[string]int)
+	contentTypes := make(map[string]string)
+	h.ResponseDo(func(res *Response) {
+		visited[res.Request.URL.String()] = res.StatusCode
+		contentTypes[res.Request.URL.String()] = res.ContentType()
+	})
+	h.HtmlDo("a[href], link[href]", func(el *HtmlElement) {
+		el.Visit(el.Attribute("href"))
+	})
+
+	assert.NoError(t, h.Visit(root+"/index.html"))
+
+	assert.Equal(t, map[string]int{
+		root + "/index.html":   http.StatusOK,
+		root + "/about.html":   http.StatusOK,
+		root + "/docs/":        http.StatusOK,
+		root + "/style.css":    http.StatusOK,
+		root + "/missing.html": http.StatusNotFound,
+	}, visited)
+	assert.Equal(t, "text/html", contentTypes[root+"/docs/"])
+	assert.Equal(t, "text/css", contentTypes[root+"/style.css"])
+}
+
+func TestHarvester_FileURLsFromWebPages(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("secret"), 0o600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="file://` + filepath.ToSlash(path) + `">Secret</a>`))
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	var errs []error
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		errs = append(errs, el.Visit(el.Attribute("href")))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "forbidden", "web pages cannot link to local files")
+}
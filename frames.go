@@ -0,0 +1,66 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html/atom"
+)
+
+// frameSelector selects the elements whose src attribute is followed with WithFollowFrames.
+const frameSelector = "iframe[src], frame[src], embed[src]"
+
+// WithFollowFrames is a functional option that follows the src of the <iframe>, <frame> and <embed>
+// elements of every page, whose URLs are hidden from a[href] link discovery. The framed URLs are
+// followed after the HtmlDo callbacks of the page as links of the page, so the filters and the depth
+// limit apply to them.
+func WithFollowFrames(enabled bool) Options {
+	return func(h *Harvester) {
+		h.followFrames = enabled
+	}
+}
+
+// isFrameAtom reports whether the element is followed with WithFollowFrames.
+func isFrameAtom(a atom.Atom) bool {
+	return a == atom.Iframe || a == atom.Frame || a == atom.Embed
+}
+
+// followFrameSources visits the src of the frame elements of the document of the response.
+func (h *Harvester) followFrameSources(doc *goquery.Document, res *Response) {
+	doc.Find(frameSelector).Each(func(_ int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		h.followFrameSource(res.Request, src)
+	})
+}
+
+// followFrameSource visits the src of a frame element found on the page of the request.
+func (h *Harvester) followFrameSource(r *Request, src string) {
+	absURL := r.GetAbsoluteURL(strings.TrimSpace(src))
+	if absURL == "" {
+		return
+	}
+
+	if err := r.follow(absURL, "", false); err != nil {
+		h.logger.Debug("error following frame",
+			slog.String("url", r.URL.String()),
+			slog.String("link", absURL),
+			slog.Any("error", err),
+		)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_WithFollowFrames(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>
+			<iframe src="/content"></iframe>
+			<embed src="/report.pdf" type="application/pdf">
+			<iframe src="/private/ads"></iframe>
+			<iframe srcdoc="<p>Inline</p>"></iframe>
+		</body></html>`))
+	})
+	mux.HandleFunc("/frameset", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><frameset><frame src="menu"><frame src="/deep"></frameset></html>`))
+	})
+	mux.HandleFunc("/content", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><iframe src="/frameset"></iframe></body></html>`))
+	})
+	for _, path := range []string{"/report.pdf", "/private/ads", "/menu", "/deep"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(helloBytes)
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, streaming := range []bool{false, true} {
+		h := newTestHarvester(
+			WithIgnoreRobots(true),
+			WithFollowFrames(true),
+			WithStreamingLinks(streaming),
+			WithDisallowedURLs([]string{server.URL + "/private"}),
+			WithDepthLimit(3),
+		)
+
+		depths := make(map[string]int)
+		h.ResponseDo(func(res *Response) {
+			depths[res.Request.URL.Path] = res.Request.Depth
+		})
+
+		// The frames of /frameset exceed the depth limit.
+		assert.NoError(t, h.Visit(server.URL+"/"))
+		assert.Equal(t, map[string]int{
+			"/":           0,
+			"/content":    1,
+			"/report.pdf": 1,
+			"/frameset":   2,
+		}, depths, "streaming: %t", streaming)
+
+		clear(depths)
+		assert.NoError(t, h.Visit(server.URL+"/frameset?top"))
+		assert.Equal(t, map[string]int{
+			"/frameset": 0,
+			"/menu":     1,
+			"/deep":     1,
+		}, depths, "streaming: %t", streaming)
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		h := newTestHarvester(WithIgnoreRobots(true))
+
+		requests := 0
+		h.ResponseDo(func(res *Response) {
+			requests++
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/"))
+		assert.Equal(t, 1, requests)
+	})
+}
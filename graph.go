@@ -0,0 +1,154 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"sync"
+)
+
+// defaultLinkGraphLimit is the default maximum number of edges stored in a link graph.
+const defaultLinkGraphLimit = 100_000
+
+// Edge is a link from one crawled page to another.
+type Edge struct {
+	// From is the URL of the page the link was found on, after redirects.
+	From string `json:"from"`
+	// To is the resolved URL the link points to.
+	To string `json:"to"`
+	// AnchorText is the text of the link element, empty if the link was not followed from an element.
+	AnchorText string `json:"anchor_text,omitempty"`
+	// NoFollow reports whether the link element has rel="nofollow".
+	NoFollow bool `json:"nofollow,omitempty"`
+}
+
+// LinkGraph is a directed graph of the links between crawled pages, recorded when the
+// WithLinkGraph functional option is enabled. Edges are recorded every time a link is
+// followed with Request.Visit or HtmlElement.Visit. Duplicate edges are ignored, and edges
+// discovered after the limit has been reached are dropped to keep memory bounded.
+type LinkGraph struct {
+	edges    []Edge
+	seen     map[[2]string]struct{}
+	outcomes map[string]linkOutcome
+	limit    int
+	dropped  int
+	lock     *sync.RWMutex
+}
+
+func newLinkGraph(limit int) *LinkGraph {
+	return &LinkGraph{
+		edges:    make([]Edge, 0),
+		seen:     make(map[[2]string]struct{}),
+		outcomes: make(map[string]linkOutcome),
+		limit:    limit,
+		lock:     &sync.RWMutex{},
+	}
+}
+
+// addEdge records the edge unless an edge between the same pages is already recorded.
+func (g *LinkGraph) addEdge(e Edge) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	key := [2]string{e.From, e.To}
+	if _, ok := g.seen[key]; ok {
+		return
+	}
+
+	if len(g.edges) >= g.limit {
+		g.dropped++
+		return
+	}
+
+	g.seen[key] = struct{}{}
+	g.edges = append(g.edges, e)
+}
+
+// Len returns the number of edges in the graph.
+func (g *LinkGraph) Len() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return len(g.edges)
+}
+
+// Dropped returns the number of edges dropped because the graph was full.
+func (g *LinkGraph) Dropped() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return g.dropped
+}
+
+// Edges returns a copy of the edges in the graph in the order they were recorded.
+func (g *LinkGraph) Edges() []Edge {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return append([]Edge(nil), g.edges...)
+}
+
+// All returns an iterator over a snapshot of the edges in the graph in the order they were recorded.
+func (g *LinkGraph) All() iter.Seq[Edge] {
+	edges := g.Edges()
+
+	return func(yield func(Edge) bool) {
+		for _, e := range edges {
+			if !yield(e) {
+				return
+			}
+		}
+	}
+}
+
+// Adjacency returns the graph as a map of page URLs to the URLs they link to.
+func (g *LinkGraph) Adjacency() map[string][]string {
+	adjacency := make(map[string][]string)
+	for e := range g.All() {
+		adjacency[e.From] = append(adjacency[e.From], e.To)
+	}
+
+	return adjacency
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. Nofollow links are drawn dashed.
+func (g *LinkGraph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph grawlr {"); err != nil {
+		return err
+	}
+
+	for e := range g.All() {
+		attrs := fmt.Sprintf("label=%q", e.AnchorText)
+		if e.NoFollow {
+			attrs += ", style=dashed"
+		}
+
+		if _, err := fmt.Fprintf(w, "\t%q -> %q [%s];\n", e.From, e.To, attrs); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// WriteJSON writes the edges of the graph as a JSON array.
+func (g *LinkGraph) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(g.Edges())
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// graphQLRequest is the JSON body of a GraphQL request.
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+// GraphQL posts the query with the variables to the GraphQL endpoint as JSON and returns the response
+// after the callbacks have run, with its body readable from the start. The request goes through the same checks and callbacks as Visit.
+// Requests are deduplicated by the endpoint and the body, so the same query with different variables,
+// e.g. the cursor of the next page, is sent again.
+func (h *Harvester) GraphQL(endpoint, query string, variables map[string]any) (*Response, error) {
+	data, err := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Accept", "application/json")
+
+	res, err := h.fetchWithBody(endpoint, http.MethodPost, &requestBody{data: data, header: header}, 0, inheritDepthLimit, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The callbacks may have read the body, return it from the start.
+	res.detach()
+	res.Body = bytes.NewReader(res.content)
+
+	return res, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package grawlrotel provides OpenTelemetry tracing for a grawlr Harvester.
+//
+// Each fetch is recorded as a "grawlr.fetch" span with child spans for the
+// robots.txt check, the request, the body read and the callbacks.
+//
+// The package is a module of its own, so that the crawler does not depend on
+// OpenTelemetry:
+//
+//	go get github.com/HRemonen/Grawlr/grawlrotel
+package grawlrotel
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	grawlr "github.com/HRemonen/Grawlr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer used by the hooks.
+const instrumentationName = "github.com/HRemonen/Grawlr/grawlrotel"
+
+// Option is a type for functional options that can be used to configure the Hooks.
+type Option func(h *Hooks)
+
+// Hooks is a grawlr.FetchHooks implementation that records each fetch as an OpenTelemetry span.
+type Hooks struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates new Hooks recording spans with a tracer from the given TracerProvider.
+// If the TracerProvider is nil, the global TracerProvider is used.
+func New(tp trace.TracerProvider, options ...Option) *Hooks {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	h := &Hooks{
+		tracer:     tp.Tracer(instrumentationName),
+		propagator: otel.GetTextMapPropagator(),
+	}
+
+	for _, option := range options {
+		option(h)
+	}
+
+	return h
+}
+
+// WithPropagator is a functional option that sets the propagator used to inject trace
+// headers into outgoing requests. Defaults to the global TextMapPropagator.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(h *Hooks) {
+		h.propagator = p
+	}
+}
+
+// WithTracerProvider is a grawlr functional option that instruments the Harvester with
+// spans from the given TracerProvider.
+func WithTracerProvider(tp trace.TracerProvider, options ...Option) grawlr.Options {
+	return grawlr.WithInstrumentation(New(tp, options...))
+}
+
+// StartFetch implements grawlr.FetchHooks.
+func (h *Hooks) StartFetch(ctx context.Context, u *url.URL, depth int) (context.Context, grawlr.FetchSpan) {
+	ctx, span := h.tracer.Start(ctx, "grawlr.fetch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("url.full", u.String()),
+			attribute.String("server.address", u.Host),
+			attribute.Int("grawlr.depth", depth),
+		),
+	)
+
+	return ctx, &fetchSpan{hooks: h, span: span}
+}
+
+// fetchSpan is a grawlr.FetchSpan backed by an OpenTelemetry span.
+type fetchSpan struct {
+	hooks *Hooks
+	span  trace.Span
+}
+
+func (s *fetchSpan) StartPhase(ctx context.Context, phase grawlr.FetchPhase) (context.Context, func(err error)) {
+	ctx, span := s.hooks.tracer.Start(ctx, "grawlr."+string(phase))
+
+	return ctx, func(err error) {
+		recordError(span, err)
+		span.End()
+	}
+}
+
+func (s *fetchSpan) Inject(ctx context.Context, header http.Header) {
+	s.hooks.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+func (s *fetchSpan) End(statusCode int, err error) {
+	if statusCode != 0 {
+		s.span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	}
+
+	recordError(s.span, err)
+	s.span.End()
+}
+
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlrotel
+
+import (
+	"net/http"
+	"testing"
+
+	grawlr "github.com/HRemonen/Grawlr"
+	"github.com/HRemonen/Grawlr/testutil/grawlrtesting"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestHooks_Spans(t *testing.T) {
+	var traceparent string
+	handlers := grawlrtesting.StandardHandlers()
+	handlers["/"] = func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.Write([]byte("<html><body>Hello</body></html>"))
+	}
+
+	server := grawlrtesting.NewTestServer(handlers)
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	h := grawlr.NewHarvester(
+		WithTracerProvider(tp, WithPropagator(propagation.TraceContext{})),
+	)
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+
+	spans := exporter.GetSpans()
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+
+	// Spans are exported as they end, so the parent span is the last one.
+	assert.Equal(t, []string{"grawlr.robots", "grawlr.request", "grawlr.body", "grawlr.callbacks", "grawlr.fetch"}, names)
+
+	fetch := spans[len(spans)-1]
+	for _, span := range spans[:len(spans)-1] {
+		assert.Equal(t, fetch.SpanContext.SpanID(), span.Parent.SpanID())
+	}
+
+	assert.Contains(t, fetch.Attributes, attribute.String("url.full", server.URL+"/"))
+	assert.Contains(t, fetch.Attributes, attribute.Int("grawlr.depth", 0))
+	assert.Contains(t, fetch.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+
+	assert.NotEmpty(t, traceparent)
+	assert.Contains(t, traceparent, fetch.SpanContext.TraceID().String())
+
+	exporter.Reset()
+
+	assert.Error(t, h.Visit(server.URL+"/disallowed"))
+
+	spans = exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultHARMaxBodySize is the default number of response body bytes recorded per HAR entry.
+const defaultHARMaxBodySize = 1 << 20
+
+// HARRecorder writes the HTTP exchanges of a Harvester as an HTTP Archive (HAR) 1.2 file. The entries are
+// written as the exchanges complete, so a crawl that crashes leaves a file with all entries written so far,
+// missing only the closing brackets that Close writes. It is safe for concurrent use.
+//
+//	rec := grawlr.NewHARRecorder(f)
+//	h := grawlr.NewHarvester(grawlr.WithHAR(rec))
+//	err := h.Visit("https://example.com")
+//	err = errors.Join(err, rec.Close())
+type HARRecorder struct {
+	// MaxBodySize is the maximum number of response body bytes recorded per entry, defaults to 1 MiB.
+	MaxBodySize int
+	// RedactHeaders are the names of the request and response headers whose values are replaced
+	// with "REDACTED", defaults to Authorization, Cookie, Set-Cookie and Proxy-Authorization.
+	RedactHeaders []string
+
+	w       io.Writer
+	entries int
+	closed  bool
+	lock    *sync.Mutex
+}
+
+// NewHARRecorder creates a new HARRecorder writing to w.
+func NewHARRecorder(w io.Writer) *HARRecorder {
+	return &HARRecorder{
+		MaxBodySize:   defaultHARMaxBodySize,
+		RedactHeaders: []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"},
+		w:             w,
+		lock:          &sync.Mutex{},
+	}
+}
+
+// WithHAR is a functional option that records every HTTP exchange of the Harvester with the HARRecorder.
+func WithHAR(rec *HARRecorder) Options {
+	return func(h *Harvester) {
+		h.har = rec
+	}
+}
+
+// Close completes the HAR file. It does not close the underlying writer.
+func (r *HARRecorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	if err := r.writeHeader(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(r.w, "\n]}}\n")
+	return err
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	Error       string         `json:"_error,omitempty"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+type harEntry struct {
+	StartedDateTime string         `json:"startedDateTime"`
+	Time            float64        `json:"time"`
+	Request         harRequest     `json:"request"`
+	Response        harResponse    `json:"response"`
+	Cache           map[string]any `json:"cache"`
+	Timings         harTimings     `json:"timings"`
+}
+
+// record writes an entry for an HTTP exchange that started at start, with the read body b.
+// The response is nil if the request failed without a response.
+func (r *HARRecorder) record(req *http.Request, res *http.Response, start time.Time, b []byte, err error) {
+	elapsed := time.Since(start)
+
+	entry := harEntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Time:            milliseconds(elapsed),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     r.headers(req.Header),
+			QueryString: queryString(req),
+			HeadersSize: -1,
+			BodySize:    max(int(req.ContentLength), 0),
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Cache:   map[string]any{},
+		Timings: harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: milliseconds(elapsed)},
+	}
+
+	if t := traceOf(req); t != nil {
+		entry.Timings = harTimings{
+			Blocked: -1,
+			DNS:     milliseconds(t.DNSDuration),
+			Connect: milliseconds(t.ConnectDuration),
+			SSL:     milliseconds(t.TLSDuration),
+			Wait:    milliseconds(t.TimeToFirstByte - t.DNSDuration - t.ConnectDuration),
+			Receive: milliseconds(t.TotalDuration - t.TimeToFirstByte),
+		}
+		entry.Timings.Wait = max(entry.Timings.Wait, 0)
+		entry.Timings.Receive = max(entry.Timings.Receive, 0)
+	}
+
+	if res != nil {
+		entry.Response.Status = res.StatusCode
+		entry.Response.StatusText = http.StatusText(res.StatusCode)
+		entry.Response.HTTPVersion = res.Proto
+		entry.Response.Headers = r.headers(res.Header)
+		entry.Response.RedirectURL = res.Header.Get("Location")
+		entry.Response.BodySize = len(b)
+		entry.Response.Content = r.content(res.Header.Get("Content-Type"), b)
+	}
+
+	if err != nil {
+		entry.Response.Error = err.Error()
+	}
+
+	data, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	if err := r.writeHeader(); err != nil {
+		return
+	}
+
+	separator := ",\n"
+	if r.entries == 0 {
+		separator = "\n"
+	}
+	r.entries++
+
+	io.WriteString(r.w, separator)
+	r.w.Write(data)
+}
+
+// writeHeader writes the beginning of the HAR file before the first entry.
+func (r *HARRecorder) writeHeader() error {
+	if r.entries > 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(r.w, `{"log": {"version": "1.2", "creator": {"name": "Grawlr", "version": "1.0"}, "pages": [], "entries": [`)
+	return err
+}
+
+func (r *HARRecorder) headers(header http.Header) []harNameValue {
+	headers := make([]harNameValue, 0, len(header))
+	for name, values := range header {
+		redact := slices.ContainsFunc(r.RedactHeaders, func(h string) bool {
+			return strings.EqualFold(h, name)
+		})
+
+		for _, value := range values {
+			if redact {
+				value = "REDACTED"
+			}
+			headers = append(headers, harNameValue{Name: name, Value: value})
+		}
+	}
+
+	slices.SortFunc(headers, func(a, b harNameValue) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return headers
+}
+
+func (r *HARRecorder) content(mimeType string, b []byte) harContent {
+	content := harContent{Size: len(b), MimeType: mimeType}
+
+	if len(b) > r.MaxBodySize {
+		b = b[:r.MaxBodySize]
+		content.Comment = "truncated"
+	}
+
+	if utf8.Valid(b) {
+		content.Text = string(b)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(b)
+		content.Encoding = "base64"
+	}
+
+	return content
+}
+
+func queryString(req *http.Request) []harNameValue {
+	query := []harNameValue{}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, harNameValue{Name: name, Value: value})
+		}
+	}
+
+	slices.SortFunc(query, func(a, b harNameValue) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return query
+}
+
+// milliseconds returns the duration in milliseconds, as used by the HAR format.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHARRecorder(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	closed := httptest.NewServer(nil)
+	closed.Close()
+
+	var buf bytes.Buffer
+	rec := NewHARRecorder(&buf)
+	rec.MaxBodySize = 16
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithHAR(rec), WithHTTPTrace(true))
+	h.RequestDo(func(req *Request) {
+		req.Headers.Set("Authorization", "Bearer secret")
+		req.Headers.Set("X-Test", "visible")
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq?q=1"))
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+	assert.Error(t, h.Visit(closed.URL+"/"))
+
+	// A crawl that crashes before Close leaves the entries written so far.
+	var partial map[string]any
+	assert.NoError(t, json.Unmarshal(append(bytes.Clone(buf.Bytes()), "]}}"...), &partial))
+
+	assert.NoError(t, rec.Close())
+
+	var har struct {
+		Log struct {
+			Version string `json:"version"`
+			Creator struct {
+				Name string `json:"name"`
+			} `json:"creator"`
+			Pages   []any `json:"pages"`
+			Entries []struct {
+				StartedDateTime string  `json:"startedDateTime"`
+				Time            float64 `json:"time"`
+				Request         struct {
+					Method      string         `json:"method"`
+					URL         string         `json:"url"`
+					Headers     []harNameValue `json:"headers"`
+					QueryString []harNameValue `json:"queryString"`
+				} `json:"request"`
+				Response struct {
+					Status  int            `json:"status"`
+					Headers []harNameValue `json:"headers"`
+					Content harContent     `json:"content"`
+					Error   string         `json:"_error"`
+				} `json:"response"`
+				Cache   map[string]any `json:"cache"`
+				Timings harTimings     `json:"timings"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &har))
+
+	assert.Equal(t, "1.2", har.Log.Version)
+	assert.Equal(t, "Grawlr", har.Log.Creator.Name)
+	assert.NotNil(t, har.Log.Pages)
+	assert.Len(t, har.Log.Entries, 3)
+
+	faq := har.Log.Entries[0]
+	assert.NotEmpty(t, faq.StartedDateTime)
+	assert.Greater(t, faq.Time, 0.0)
+	assert.Equal(t, "GET", faq.Request.Method)
+	assert.Equal(t, server.URL+"/faq?q=1", faq.Request.URL)
+	assert.Contains(t, faq.Request.Headers, harNameValue{Name: "Authorization", Value: "REDACTED"})
+	assert.Contains(t, faq.Request.Headers, harNameValue{Name: "X-Test", Value: "visible"})
+	assert.Equal(t, []harNameValue{{Name: "q", Value: "1"}}, faq.Request.QueryString)
+	assert.Equal(t, 200, faq.Response.Status)
+	assert.Equal(t, "text/html; charset=utf-8", faq.Response.Content.MimeType)
+	assert.Len(t, faq.Response.Content.Text, 16)
+	assert.Equal(t, "truncated", faq.Response.Content.Comment)
+	assert.Greater(t, faq.Response.Content.Size, 16)
+	assert.NotNil(t, faq.Cache)
+	assert.GreaterOrEqual(t, faq.Timings.Wait, 0.0)
+	assert.GreaterOrEqual(t, faq.Timings.Receive, 0.0)
+
+	assert.Equal(t, 404, har.Log.Entries[1].Response.Status)
+
+	failed := har.Log.Entries[2]
+	assert.Equal(t, 0, failed.Response.Status)
+	assert.NotEmpty(t, failed.Response.Error)
+}
+
+func TestHARRecorder_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewHARRecorder(&buf)
+	assert.NoError(t, rec.Close())
+	assert.NoError(t, rec.Close())
+
+	var har map[string]map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &har))
+	assert.Empty(t, har["log"]["entries"])
+}
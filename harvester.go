@@ -20,11 +20,14 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/temoto/robotstxt"
@@ -43,6 +46,19 @@ var (
 	ErrVisitedURL = func(u string) error {
 		return fmt.Errorf("URL %s has already been visited", u)
 	}
+	// ErrURLTemplateMismatch is returned when a followed URL does not match any URL template.
+	ErrURLTemplateMismatch = func(u string) error {
+		return fmt.Errorf("URL %s does not match any URL template", u)
+	}
+	// ErrVetoedURL is returned when a BeforeVisit callback vetoes visiting a URL.
+	ErrVetoedURL = func(u string, err error) error {
+		return fmt.Errorf("URL %s was vetoed: %w", u, err)
+	}
+	// ErrUnsupportedTransport is returned for every request when an option that configures the transport
+	// of the client is used with a client whose transport is not an *http.Transport.
+	ErrUnsupportedTransport = func(option string, rt http.RoundTripper) error {
+		return fmt.Errorf("%s requires an *http.Transport, the transport of the client is %T", option, rt)
+	}
 	// ErrDepthLimitExceeded is returned when the maximum depth limit is exceeded.
 	ErrDepthLimitExceeded = func(depth, limit int) error {
 		return fmt.Errorf("depth limit exceeded: %d > %d", depth, limit)
@@ -58,23 +74,64 @@ type ReqMiddleware func(req *Request)
 // ResMiddleware is a type for response middlewares that can be used to modify a Response after it is fetched.
 type ResMiddleware func(res *Response)
 
+// statusMiddleware is a response middleware that is only applied to responses
+// with a status code within the inclusive range [lo, hi].
+type statusMiddleware struct {
+	name     string
+	lo, hi   int
+	function ResMiddleware
+}
+
+// VisitCallback is a type for callbacks that approve a URL before it is requested.
+// A non-nil error skips visiting the URL.
+type VisitCallback func(u *url.URL) error
+
+// FilteredCallback is a type for callbacks that are notified when a URL is filtered out.
+type FilteredCallback func(u *url.URL, err error)
+
+// SlowRequestCallback is a type for callbacks that are notified of requests exceeding the slow request threshold.
+type SlowRequestCallback func(req *Request, elapsed time.Duration)
+
+// slowRequest is the configuration for detecting slow requests.
+type slowRequest struct {
+	threshold time.Duration
+	callback  SlowRequestCallback
+}
+
 type (
 	HtmlCallback   func(el *HtmlElement)
 	HtmlMiddleware struct {
+		Name     string
+		Priority int
 		Selector string
 		Function HtmlCallback
 	}
 )
 
+// HtmlCallbackWithContext is a type for Html callbacks that receive a context, which is canceled
+// when the callback times out.
+type HtmlCallbackWithContext func(ctx context.Context, el *HtmlElement)
+
 // Harvester is a Harvester that uses an http.Client to fetch web pages.
 type Harvester struct {
 	// Client is the http.Client used to fetch web pages.
 	Client *http.Client
 	// AllowedURLs is a list of URLs that are allowed to be fetched. Can be set with the WithAllowedURLs functional option.
+	//
+	// Deprecated: Accessing the field while the Harvester is crawling is a data race. Use WithAllowedURLs,
+	// SetAllowedURLs, AddAllowedURL and RemoveAllowedURL to change the allowed URLs and Config to read them.
 	AllowedURLs []string
 	// DisallowedURLs is a list of URLs that are disallowed to be fetched. Can be set with the WithDisallowedURLs functional option.
+	//
+	// Deprecated: Accessing the field while the Harvester is crawling is a data race. Use WithDisallowedURLs,
+	// SetDisallowedURLs, AddDisallowedURL and RemoveDisallowedURL to change the disallowed URLs and Config to read them.
 	DisallowedURLs []string
+	// scope is the CrawlScope of the URLs to fetch, combined with AllowedURLs and DisallowedURLs. Can be set with the WithScope functional option.
+	scope CrawlScope
 	// DepthLimit is the maximum depth of links to follow. If set to 0, all links are followed. Can be set with the WithDepthLimit functional option.
+	//
+	// Deprecated: Accessing the field while the Harvester is crawling is a data race. Use WithDepthLimit and
+	// SetDepthLimit to change the depth limit and Config to read it.
 	DepthLimit int
 	// AllowRevisit is a flag that determines whether to allow revisiting URLs. If set to true, URLs can be revisited even if they have already been visited. Defaults to false.
 	AllowRevisit bool
@@ -82,17 +139,155 @@ type Harvester struct {
 	Context context.Context
 	// store is a Storer that is used to cache visited URLs.
 	store Storer
+	// stats holds the crawl counters of the Harvester. Can be read with the Stats method.
+	stats *stats
+	// slowRequest is the configuration for detecting slow requests, nil if disabled. Can be set with the WithSlowRequestThreshold functional option.
+	slowRequest *slowRequest
+	// stubs is a list of fake responses returned for matching URLs instead of sending a request. Can be set with the WithStub functional option.
+	stubs []*stub
+	// bodyRetry is the configuration for retrying responses by their body content, nil if disabled. Can be set with the WithRetryOnBody functional option.
+	bodyRetry *bodyRetry
+	// delayFunc computes the delay before each request, nil if disabled. Can be set with the WithDelayFunc functional option.
+	delayFunc DelayFunc
+	// concurrency limits the number of requests sent at the same time. Can be set with the WithMaxConcurrency functional option.
+	concurrency *concurrencyLimiter
+	// initialDelay is the random delay of the first request to each host. Can be set with the WithInitialDelay functional option.
+	initialDelay *initialDelay
+	// progress reports the crawl counters periodically, nil if disabled. Can be set with the WithProgress functional option.
+	progress *progress
+	// inFlightBytes bounds the response body bytes held by running fetches, nil if disabled. Can be set with the WithMaxInFlightBytes functional option.
+	inFlightBytes *byteLimiter
+	// hostStats is a flag that determines whether the per-host statistics are included in the Stats snapshot. Can be set with the WithHostStats functional option.
+	hostStats bool
+	// har records the HTTP exchanges as an HTTP Archive, nil if disabled. Can be set with the WithHAR functional option.
+	har *HARRecorder
+	// visitedStatusCodes reports whether a response status code marks its URL as visited, nil for all but 5xx. Can be set with the WithVisitedStatusCodes functional option.
+	visitedStatusCodes func(code int) bool
+	// proxy returns the proxy of each request, nil to use the proxy of the client. Can be set with the WithProxy functional option.
+	proxy ProxyFunc
+	// transport is the http.RoundTripper set on a copy of the client. Can be set with the WithTransport functional option.
+	transport http.RoundTripper
+	// streamingLinks is a flag that determines whether the links of every page are followed while tokenizing its body. Can be set with the WithStreamingLinks functional option.
+	streamingLinks bool
+	// cookieJar is the cookie jar set on a copy of the client. Can be set with the WithCookieJar functional option.
+	cookieJar http.CookieJar
+	// cookies is a flag that determines whether an in-memory cookie jar is used if none is set. Can be set with the WithCookies functional option.
+	cookies bool
+	// persistentCookies is a flag that determines whether cookies are saved to the store. Can be set with the WithPersistentCookies functional option.
+	persistentCookies bool
+	// headProbe decides from a HEAD request whether to fetch each URL. Can be set with the WithHeadProbe and WithPreflight functional options.
+	headProbe *headProbe
+	// urlTemplates is a list of path templates that followed URLs must match. Can be set with the WithURLTemplate functional option.
+	urlTemplates []urlTemplate
+	// backend performs the exchange of every request, nil to use the client. Can be set with the WithBackend functional option.
+	backend Backend
+	// followHeaderLinks is a flag that determines whether the preload and prefetch links of Link headers are followed. Can be set with the WithFollowHeaderLinks functional option.
+	followHeaderLinks bool
+	// followFrames is a flag that determines whether the src of iframe, frame and embed elements is followed. Can be set with the WithFollowFrames functional option.
+	followFrames bool
+	// proxyPool is the ProxyPool the proxy of each request is picked from. Can be set with the WithProxyPool functional option.
+	proxyPool *ProxyPool
+	// proxyURL is the URL of the proxy set with the WithProxy functional option.
+	proxyURL *url.URL
+	// proxyFunc chooses the proxy of each request, taking precedence over proxy. Can be set with the WithProxyFunc functional option.
+	proxyFunc ProxyFunc
+	// proxyUser is the credentials sent to proxies without credentials in their URL. Can be set with the WithProxyCredentials functional option.
+	proxyUser *url.Userinfo
+	// overrideClient sends the requests with a ProxyURL if the Harvester has no proxy options, nil if the client handles them.
+	overrideClient *overrideClient
+	// logger is the structured logger used for internal warnings. Can be set with the WithLogger functional option.
+	logger *slog.Logger
+	// debugger receives the crawl lifecycle events, nil if disabled. Can be set with the WithDebugger functional option.
+	debugger Debugger
+	// hooks are the FetchHooks used to instrument each fetch, nil if disabled. Can be set with the WithInstrumentation functional option.
+	hooks FetchHooks
+	// graph is the link graph recorded during the crawl, nil if disabled. Can be enabled with the WithLinkGraph functional option.
+	graph *LinkGraph
 	// requestMiddlewares is a list of request middlewares that are applied to each request. Can be set with the RequestDo functional option.
-	requestMiddlewares []ReqMiddleware
+	requestMiddlewares []requestMiddleware
 	// responseMiddlewares is a list of response middlewares that are applied to each response. Can be set with the ResponseDo functional option.
-	responseMiddlewares []ResMiddleware
+	responseMiddlewares []responseMiddleware
+	// statusMiddlewares is a list of response middlewares that are applied to responses with a matching status code. Can be set with the StatusDo and StatusRangeDo functions.
+	statusMiddlewares []statusMiddleware
+	// metricsCallbacks is a list of callbacks that receive a FetchMetric for each completed HTTP exchange. Can be set with the MetricsDo function.
+	metricsCallbacks []MetricsCallback
+	// webhook delivers the lifecycle events of the crawl, nil if disabled. Can be set with the WithWebhook functional option.
+	webhook *WebhookNotifier
+	// beforeVisitCallbacks is a list of callbacks that approve each URL before it is requested. Can be set with the BeforeVisit function.
+	beforeVisitCallbacks []VisitCallback
+	// robotsDisallowedCallbacks is a list of callbacks that are notified when robots.txt disallows a URL. Can be set with the OnRobotsDisallowed function.
+	robotsDisallowedCallbacks []func(u string)
+	// forbiddenURLCallbacks is a list of callbacks that are notified when a URL is forbidden by the URL filters. Can be set with the OnForbiddenURL function.
+	forbiddenURLCallbacks []func(u string)
+	// revisitCallbacks is a list of callbacks that are notified when a visited URL is fetched again. Can be set with the OnRevisit function.
+	revisitCallbacks []func(u string, visitCount int)
+	// authChallengeCallbacks is a list of callbacks that may answer the challenge of a 401 Unauthorized response. Can be set with the AuthChallengeDo function.
+	authChallengeCallbacks []AuthChallengeCallback
+	// firstResponseCallbacks is a list of callbacks that are called with the first successful response. Can be set with the OnFirstResponse function.
+	firstResponseCallbacks []ResMiddleware
+	// firstResponse makes sure the firstResponseCallbacks are called once.
+	firstResponse sync.Once
+	// duplicateCallbacks is a list of callbacks that are notified when a URL redirects to an already visited URL. Can be set with the OnDuplicate function.
+	duplicateCallbacks []func(u, finalURL string)
+	// filteredCallbacks is a list of callbacks that are notified when a URL is filtered out. Can be set with the OnFiltered function.
+	filteredCallbacks []FilteredCallback
 	// htmlMiddlewares is a list of scrape middlewares that are applied to each Html HtmlElement. Can be set with the HtmlDo functional option.
 	htmlMiddlewares []HtmlMiddleware
+	// middlewareSeq is the number of middlewares added, used to generate the names of unnamed middlewares.
+	middlewareSeq int
+	// sinks receive the items emitted with Response.Emit. Can be added with the AddSink method.
+	sinks []Sink
+	// contentHasher is the function used to hash response bodies. Can be set with the WithContentHasher functional option.
+	contentHasher ContentHasher
+	// httpTrace is a flag that determines whether the network timings of each request are recorded. Can be set with the WithHTTPTrace functional option.
+	httpTrace bool
+	// collapseWWW is a flag that determines whether www. and non-www. hosts are treated as the same host when deduplicating visits. Can be set with the WithCollapseWWW functional option.
+	collapseWWW bool
+	// checkExternalLinks is a flag that determines whether the broken link report checks link targets that were not crawled. Can be set with the WithCheckExternalLinks functional option.
+	checkExternalLinks bool
+	// resumableDownloads is a flag that determines whether failed body reads are resumed with Range requests. Can be set with the WithResumableDownloads functional option.
+	resumableDownloads bool
+	// trimURLWhitespace is a flag that determines whether whitespace is trimmed from href attribute values. Can be set with the WithTrimURLWhitespace functional option.
+	trimURLWhitespace bool
+	// refererPolicy is the policy that controls the Referer header sent when following a link. Can be set with the WithRefererPolicy functional option.
+	refererPolicy string
 	// ignoreRobots is a flag that determines whether robots.txt should be ignored, defaults to false. Can be set with the WithIgnoreRobots functional option.
 	ignoreRobots bool
 	// robotsMap is a map of hostnames to robotstxt.RobotsData, which is used to cache robots.txt files.
 	robotsMap map[string]*robotstxt.RobotsData
-	// mu is a mutex used to synchronize access to the robotsMap.
+	// robotsBackoffs is a map of hostnames to the retry state of robots.txt files that responded with 429 Too Many Requests.
+	robotsBackoffs map[string]*robotsBackoff
+	// robotsRateLimitDeny is a flag that determines whether a host is disallowed instead of allowed while its robots.txt is rate limited. Can be set with the WithDisallowOnRobotsRateLimit functional option.
+	robotsRateLimitDeny bool
+	// robotsAgents is the list of user agents robots.txt groups are matched against, most specific first. Can be set with the WithRobotsAgentChain functional option.
+	robotsAgents []string
+	// bufferPool is the pool of buffers response bodies are read into, nil to allocate a new buffer for each body. Can be set with the WithBufferPool functional option.
+	bufferPool *bufferPool
+	// budget is the download budget of the crawl and of each host. Can be set with the WithMaxTotalBytes and WithMaxBytesPerHost functional options.
+	budget *byteBudget
+	// maxResponseTime is the maximum time to read a response body, 0 for no limit. Can be set with the WithMaxResponseTime functional option.
+	maxResponseTime time.Duration
+	// maxDuration is the maximum duration of the crawl, 0 for no limit. Can be set with the WithMaxDuration functional option.
+	maxDuration time.Duration
+	// visits tracks the running Visits for the Wait method.
+	visits *visitTracker
+	// respectCleanParam is a flag that determines whether the query parameters listed in robots.txt Clean-param directives are ignored when deduplicating visits. Can be set with the WithRespectCleanParam functional option.
+	respectCleanParam bool
+	// cleanParams is a map of hostnames to the Clean-param directives of their robots.txt, cached with the robotsMap.
+	cleanParams map[string][]cleanParam
+	// dialContext is the function dialing every connection. Can be set with the WithDialContext functional option.
+	dialContext DialFunc
+	// randomHeaderOrder writes the headers of requests in a random order. Can be set with the WithRandomHeaderOrder functional option.
+	randomHeaderOrder bool
+	// localAddrs is the list of local IP addresses connections are bound to. Can be set with the WithLocalAddrs functional option.
+	localAddrs []string
+	// stickyLocalAddrs is a flag that determines whether every connection to a host is bound to the same local address. Can be set with the WithStickyLocalAddrs functional option.
+	stickyLocalAddrs bool
+	// hostGates is a map of hostnames to the gates serializing the requests to hosts with a robots.txt Crawl-delay.
+	hostGates map[string]*hostGate
+	// parents is a map of crawled URLs to the URL of the page they were found on.
+	parents map[string]string
+	// mu is a mutex used to synchronize access to the robotsMap, the parents map and the middlewares.
 	mu sync.RWMutex
 }
 
@@ -106,11 +301,22 @@ func NewHarvester(options ...Options) *Harvester {
 		AllowRevisit:        false,
 		Context:             context.Background(),
 		store:               NewInMemoryStore(),
-		requestMiddlewares:  make([]ReqMiddleware, 0, 4),
-		responseMiddlewares: make([]ResMiddleware, 0, 4),
+		stats:               newStats(),
+		concurrency:         newConcurrencyLimiter(),
+		visits:              newVisitTracker(),
+		requestMiddlewares:  make([]requestMiddleware, 0, 4),
+		responseMiddlewares: make([]responseMiddleware, 0, 4),
+		statusMiddlewares:   make([]statusMiddleware, 0, 4),
 		htmlMiddlewares:     make([]HtmlMiddleware, 0, 4),
+		refererPolicy:       RefererPolicyStrictOriginWhenCrossOrigin,
+		logger:              slog.Default(),
+		contentHasher:       FNVContentHasher,
 		ignoreRobots:        false,
 		robotsMap:           make(map[string]*robotstxt.RobotsData),
+		robotsBackoffs:      make(map[string]*robotsBackoff),
+		hostGates:           make(map[string]*hostGate),
+		cleanParams:         make(map[string][]cleanParam),
+		parents:             make(map[string]string),
 		mu:                  sync.RWMutex{},
 	}
 
@@ -118,9 +324,47 @@ func NewHarvester(options ...Options) *Harvester {
 		option(h)
 	}
 
+	h.applyTransport()
+	h.applyCookieJar()
+	h.applyProxy()
+	h.applyDialer()
+	h.applyHeaderOrder()
+
 	return h
 }
 
+// applyTransport sets the transport of the Harvester on a copy of its client.
+func (h *Harvester) applyTransport() {
+	if h.transport == nil {
+		return
+	}
+
+	client := *h.Client
+	client.Transport = h.transport
+	h.Client = &client
+}
+
+// failTransport makes every request of the Harvester fail with the error, for options that cannot
+// be applied to its transport and must not be ignored, such as a proxy hiding the address of the crawler.
+func (h *Harvester) failTransport(err error) {
+	h.logger.Error("transport not configured", slog.Any("error", err))
+
+	client := *h.Client
+	client.Transport = errTransport{err: err}
+	h.Client = &client
+}
+
+// errTransport is an http.RoundTripper failing every request with its error.
+type errTransport struct {
+	err error
+}
+
+// RoundTrip fails the request with the error of the transport.
+func (t errTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	closeRequestBody(req)
+	return nil, t.err
+}
+
 // Clone returns a new Harvester with the same options as the original
 // except for the middleware functions.
 func (h *Harvester) Clone() *Harvester {
@@ -129,15 +373,72 @@ func (h *Harvester) Clone() *Harvester {
 		Client:              h.Client,
 		AllowedURLs:         h.AllowedURLs,
 		DisallowedURLs:      h.DisallowedURLs,
+		scope:               h.scope,
 		DepthLimit:          h.DepthLimit,
 		AllowRevisit:        h.AllowRevisit,
 		Context:             h.Context,
 		store:               h.store,
-		requestMiddlewares:  make([]ReqMiddleware, 0, 4),
-		responseMiddlewares: make([]ResMiddleware, 0, 4),
+		stats:               newStats(),
+		visits:              newVisitTracker(),
+		graph:               h.graph,
+		bodyRetry:           h.bodyRetry,
+		delayFunc:           h.delayFunc,
+		concurrency:         h.concurrency,
+		initialDelay:        h.initialDelay,
+		progress:            h.progress.clone(),
+		inFlightBytes:       h.inFlightBytes,
+		hostStats:           h.hostStats,
+		har:                 h.har,
+		visitedStatusCodes:  h.visitedStatusCodes,
+		proxy:               h.proxy,
+		transport:           h.transport,
+		streamingLinks:      h.streamingLinks,
+		cookieJar:           h.cookieJar,
+		cookies:             h.cookies,
+		persistentCookies:   h.persistentCookies,
+		headProbe:           h.headProbe,
+		urlTemplates:        h.urlTemplates,
+		backend:             h.backend,
+		followHeaderLinks:   h.followHeaderLinks,
+		followFrames:        h.followFrames,
+		proxyPool:           h.proxyPool,
+		proxyUser:           h.proxyUser,
+		proxyURL:            h.proxyURL,
+		proxyFunc:           h.proxyFunc,
+		overrideClient:      h.overrideClient,
+		stubs:               h.stubs,
+		slowRequest:         h.slowRequest,
+		hooks:               h.hooks,
+		debugger:            h.debugger,
+		logger:              h.logger,
+		requestMiddlewares:  make([]requestMiddleware, 0, 4),
+		responseMiddlewares: make([]responseMiddleware, 0, 4),
+		statusMiddlewares:   make([]statusMiddleware, 0, 4),
 		htmlMiddlewares:     make([]HtmlMiddleware, 0, 4),
+		trimURLWhitespace:   h.trimURLWhitespace,
+		resumableDownloads:  h.resumableDownloads,
+		checkExternalLinks:  h.checkExternalLinks,
+		collapseWWW:         h.collapseWWW,
+		httpTrace:           h.httpTrace,
+		contentHasher:       h.contentHasher,
+		refererPolicy:       h.refererPolicy,
 		ignoreRobots:        h.ignoreRobots,
 		robotsMap:           h.robotsMap,
+		robotsBackoffs:      h.robotsBackoffs,
+		robotsRateLimitDeny: h.robotsRateLimitDeny,
+		robotsAgents:        h.robotsAgents,
+		hostGates:           h.hostGates,
+		cleanParams:         h.cleanParams,
+		respectCleanParam:   h.respectCleanParam,
+		localAddrs:          h.localAddrs,
+		dialContext:         h.dialContext,
+		randomHeaderOrder:   h.randomHeaderOrder,
+		stickyLocalAddrs:    h.stickyLocalAddrs,
+		bufferPool:          h.bufferPool,
+		budget:              h.budget,
+		maxDuration:         h.maxDuration,
+		maxResponseTime:     h.maxResponseTime,
+		parents:             make(map[string]string),
 		mu:                  sync.RWMutex{},
 	}
 
@@ -158,6 +459,15 @@ func WithAllowRevisit(allow bool) Options {
 	}
 }
 
+// WithTransport is a functional option that sets the http.RoundTripper of the client of the Harvester,
+// used for every request including robots.txt requests. The client is copied, so the client set with
+// WithClient or http.DefaultClient is not modified and keeps its timeout and redirect policy.
+func WithTransport(rt http.RoundTripper) Options {
+	return func(h *Harvester) {
+		h.transport = rt
+	}
+}
+
 // WithAllowedURLs is a functional option that sets the allowed URLs for the Harvester.
 func WithAllowedURLs(urls []string) Options {
 	return func(h *Harvester) {
@@ -172,6 +482,25 @@ func WithDisallowedURLs(urls []string) Options {
 	}
 }
 
+// WithAllowedURLValues is a functional option that sets the allowed URLs for the Harvester from parsed URLs.
+func WithAllowedURLValues(urls []*url.URL) Options {
+	return WithAllowedURLs(urlStrings(urls))
+}
+
+// WithDisallowedURLValues is a functional option that sets the disallowed URLs for the Harvester from parsed URLs.
+func WithDisallowedURLValues(urls []*url.URL) Options {
+	return WithDisallowedURLs(urlStrings(urls))
+}
+
+// urlStrings returns the string representations of the given URLs.
+func urlStrings(urls []*url.URL) []string {
+	s := make([]string, 0, len(urls))
+	for _, u := range urls {
+		s = append(s, u.String())
+	}
+	return s
+}
+
 // WithDepthLimit is a functional option that sets the maximum depth for the Harvester.
 func WithDepthLimit(depth int) Options {
 	return func(h *Harvester) {
@@ -201,22 +530,439 @@ func WithIgnoreRobots(ignore bool) Options {
 	}
 }
 
-// RequestDo is a functional option that adds a request middleware to the Harvester.
-// Triggers the given ReqMiddleware for each request before it is fetched.
-func (h *Harvester) RequestDo(mw ReqMiddleware) {
+// WithDisallowOnRobotsRateLimit is a functional option that disallows all URLs of a host while its
+// robots.txt responds with 429 Too Many Requests. By default the host is allowed while robots.txt is
+// retried with exponential backoff, respecting the Retry-After header.
+func WithDisallowOnRobotsRateLimit(disallow bool) Options {
+	return func(h *Harvester) {
+		h.robotsRateLimitDeny = disallow
+	}
+}
+
+// WithRobotsAgentChain is a functional option that sets the user agents robots.txt rules are matched
+// against, most specific first, e.g. "GrawlrBot/1.0", "Grawlr", "*". The rules of the group of the first
+// agent with a group of its own are used, falling back to the rules for all agents (User-agent: *).
+// An agent matches a group whose name is a prefix of it, case-insensitively. The default chain is "Grawlr".
+func WithRobotsAgentChain(agents []string) Options {
+	return func(h *Harvester) {
+		h.robotsAgents = agents
+	}
+}
+
+// SetAllowedURLs replaces the allowed URLs of the Harvester.
+// It is safe to call while the Harvester is crawling.
+func (h *Harvester) SetAllowedURLs(urls []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.AllowedURLs = slices.Clone(urls)
+}
+
+// AddAllowedURL appends a URL to the allowed URLs of the Harvester.
+// It is safe to call while the Harvester is crawling.
+func (h *Harvester) AddAllowedURL(u string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.AllowedURLs = slices.Concat(h.AllowedURLs, []string{u})
+}
+
+// RemoveAllowedURL removes a URL from the allowed URLs of the Harvester, reporting whether it was found.
+// It is safe to call while the Harvester is crawling.
+func (h *Harvester) RemoveAllowedURL(u string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var removed bool
+	h.AllowedURLs, removed = withoutURL(h.AllowedURLs, u)
+	return removed
+}
+
+// SetDisallowedURLs replaces the disallowed URLs of the Harvester.
+// It is safe to call while the Harvester is crawling.
+func (h *Harvester) SetDisallowedURLs(urls []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.DisallowedURLs = slices.Clone(urls)
+}
+
+// AddDisallowedURL appends a URL to the disallowed URLs of the Harvester.
+// It is safe to call while the Harvester is crawling.
+func (h *Harvester) AddDisallowedURL(u string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.DisallowedURLs = slices.Concat(h.DisallowedURLs, []string{u})
+}
+
+// RemoveDisallowedURL removes a URL from the disallowed URLs of the Harvester, reporting whether it was found.
+// It is safe to call while the Harvester is crawling.
+func (h *Harvester) RemoveDisallowedURL(u string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var removed bool
+	h.DisallowedURLs, removed = withoutURL(h.DisallowedURLs, u)
+	return removed
+}
+
+// withoutURL returns a copy of the URLs without u, or the URLs themselves if they do not contain u.
+// Like the other methods changing the URL filter lists, it copies the slice rather than modifying it,
+// as isURLAllowed and Config use the slices after releasing the lock and clones share them.
+func withoutURL(urls []string, u string) ([]string, bool) {
+	if !slices.Contains(urls, u) {
+		return urls, false
+	}
+
+	return slices.DeleteFunc(slices.Clone(urls), func(v string) bool { return v == u }), true
+}
+
+// WithLinkGraph is a functional option that enables recording the links between crawled pages.
+// The recorded graph can be accessed with the Graph method. The graph holds up to 100 000 edges
+// by default, see WithLinkGraphLimit.
+func WithLinkGraph(enabled bool) Options {
+	return func(h *Harvester) {
+		if !enabled {
+			h.graph = nil
+			return
+		}
+		h.graph = newLinkGraph(defaultLinkGraphLimit)
+	}
+}
+
+// WithLinkGraphLimit is a functional option that enables recording the links between crawled pages
+// with the given maximum number of edges. Edges discovered after the limit has been reached are dropped.
+func WithLinkGraphLimit(limit int) Options {
+	return func(h *Harvester) {
+		h.graph = newLinkGraph(limit)
+	}
+}
+
+// WithCheckExternalLinks is a functional option that makes BrokenLinkReport check link targets that were
+// not crawled, such as external links filtered out by the allowed URLs, with a HEAD request.
+func WithCheckExternalLinks(enabled bool) Options {
+	return func(h *Harvester) {
+		h.checkExternalLinks = enabled
+	}
+}
+
+// WithContentHasher is a functional option that sets the function used to hash response bodies
+// for Response.ContentHash. Defaults to FNVContentHasher, a fast non-cryptographic hash. With a
+// 64-bit hash, collisions become likely only around billions of distinct bodies; use a
+// cryptographic hash such as SHA-256 when a collision must never make two bodies look identical.
+func WithContentHasher(fn ContentHasher) Options {
+	return func(h *Harvester) {
+		h.contentHasher = fn
+	}
+}
+
+// WithHTTPTrace is a functional option that records the low-level network timings of each request,
+// such as DNS, connect, TLS and time to first byte, into Response.Trace and FetchMetric.Trace.
+func WithHTTPTrace(enabled bool) Options {
+	return func(h *Harvester) {
+		h.httpTrace = enabled
+	}
+}
+
+// WithCollapseWWW is a functional option that treats a host with a leading "www." and the same host
+// without it as the same host when deduplicating visits, so that a page is only crawled once even if
+// it is linked from both hosts. The AllowedURLs and DisallowedURLs prefixes are matched against the
+// URL as is, so both hosts need to be listed to allow or disallow them.
+func WithCollapseWWW(enabled bool) Options {
+	return func(h *Harvester) {
+		h.collapseWWW = enabled
+	}
+}
+
+// WithResumableDownloads is a functional option that resumes a response body read that fails
+// partway by requesting the remaining bytes with a Range header, if the server supports byte ranges.
+func WithResumableDownloads(enabled bool) Options {
+	return func(h *Harvester) {
+		h.resumableDownloads = enabled
+	}
+}
+
+// WithTrimURLWhitespace is a functional option that trims leading and trailing whitespace from
+// the href attribute values of the elements passed to the Html middlewares.
+func WithTrimURLWhitespace(enabled bool) Options {
+	return func(h *Harvester) {
+		h.trimURLWhitespace = enabled
+	}
+}
+
+// WithRefererPolicy is a functional option that sets the policy controlling the Referer header
+// sent when following a link found on a page, such as "no-referrer", "origin", "same-origin" or
+// "strict-origin-when-cross-origin". See the RefererPolicy constants for the supported values.
+// Defaults to "strict-origin-when-cross-origin".
+func WithRefererPolicy(policy string) Options {
+	return func(h *Harvester) {
+		h.refererPolicy = policy
+	}
+}
+
+// WithInstrumentation is a functional option that sets the FetchHooks used to instrument each fetch.
+// See the FetchHooks interface in instrumentation.go for more information.
+func WithInstrumentation(hooks FetchHooks) Options {
+	return func(h *Harvester) {
+		h.hooks = hooks
+	}
+}
+
+// WithLogger is a functional option that sets the structured logger used for internal warnings,
+// such as response body close and parse failures. Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Options {
+	return func(h *Harvester) {
+		h.logger = logger
+	}
+}
+
+// WithDebugger is a functional option that sets the Debugger receiving the crawl lifecycle events.
+// See the Debugger interface in debugger.go for more information.
+func WithDebugger(d Debugger) Options {
+	return func(h *Harvester) {
+		h.debugger = d
+	}
+}
+
+// WithSlowRequestThreshold is a functional option that calls the given callback for every request
+// that takes longer than the threshold, including reading the response body. The request itself is
+// not affected. Failed requests, such as requests that time out, are reported as well.
+func WithSlowRequestThreshold(d time.Duration, fn SlowRequestCallback) Options {
+	return func(h *Harvester) {
+		h.slowRequest = &slowRequest{
+			threshold: d,
+			callback:  fn,
+		}
+	}
+}
+
+// WithStub is a functional option that makes the Harvester return a fake response with the given
+// status, body and headers for a URL instead of sending a request. The URL is matched exactly or,
+// if no exact match exists, as a pattern with the syntax of path.Match, e.g. "https://example.com/*".
+// Stubbed responses flow through the normal middleware pipeline. Stubbed URLs are not checked
+// against robots.txt.
+func WithStub(u string, status int, body []byte, headers http.Header) Options {
+	return func(h *Harvester) {
+		h.stubs = append(h.stubs, &stub{
+			pattern: u,
+			status:  status,
+			body:    body,
+			headers: headers,
+		})
+	}
+}
+
+// WithRetryOnBody is a functional option that retries a request after the given delay when
+// the response body matches the given pattern, up to maxRetries times. This is useful for
+// interstitial pages, such as "Please wait..." challenges, that resolve on a retry.
+func WithRetryOnBody(pattern *regexp.Regexp, maxRetries int, delay time.Duration) Options {
+	return func(h *Harvester) {
+		h.bodyRetry = &bodyRetry{
+			pattern:    pattern,
+			maxRetries: maxRetries,
+			delay:      delay,
+		}
+	}
+}
+
+// WithDelayFunc is a functional option that sets a function computing the delay to wait before
+// each request, e.g. based on the host, path or depth of the request. When several delay sources
+// apply to a request, the longest delay is used.
+func WithDelayFunc(fn DelayFunc) Options {
+	return func(h *Harvester) {
+		h.delayFunc = fn
+	}
+}
+
+// WithProgress is a functional option that calls the callback with the crawl counters every interval
+// while the Harvester is crawling. Reporting starts with the first Visit and stops when the last
+// running Visit returns, with a final call reflecting the end state.
+func WithProgress(interval time.Duration, fn ProgressCallback) Options {
+	return func(h *Harvester) {
+		h.progress = newProgress(interval, fn)
+	}
+}
+
+// WithMaxInFlightBytes is a functional option that bounds the memory used by response bodies.
+// A fetch, started with Visit or followed from a page, waits before sending its request while the
+// bodies held by running fetches sum to n bytes or more. A body is held from its first read until the
+// callbacks of its response have returned, or until they follow a link from the page, so that a
+// callback visiting a link does not wait for the bytes of its own page. Clones of the Harvester
+// share the limit.
+//
+// The limit is checked before a request is sent, not while its body is read, so a single body can
+// take the held bytes past n. The Harvester has no per-response body size limit; WithMaxTotalBytes
+// and WithMaxBytesPerHost truncate the bodies once a budget is used up.
+func WithMaxInFlightBytes(n int64) Options {
+	return func(h *Harvester) {
+		h.inFlightBytes = newByteLimiter(n)
+	}
+}
+
+// WithHostStats is a functional option that includes the per-host statistics in the Stats snapshot.
+// It is disabled by default, as a crawl across many hosts makes the snapshot large. The per-host
+// statistics are always available with the HostStats method.
+func WithHostStats(include bool) Options {
+	return func(h *Harvester) {
+		h.hostStats = include
+	}
+}
+
+// WithVisitedStatusCodes is a functional option that sets the function deciding which response status
+// codes mark a URL as visited. URLs with other responses can be visited again, e.g. to retry a temporary
+// server error later. By default every status code except 5xx marks a URL as visited.
+func WithVisitedStatusCodes(fn func(code int) bool) Options {
+	return func(h *Harvester) {
+		h.visitedStatusCodes = fn
+	}
+}
+
+// Seed appends the given URLs to the allowed URLs of the Harvester and returns the Harvester
+// for chaining, e.g. h.Seed(urls).Deny(blocked).Visit(start).
+func (h *Harvester) Seed(urls []string) *Harvester {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	h.requestMiddlewares = append(h.requestMiddlewares, mw)
+	h.AllowedURLs = slices.Concat(h.AllowedURLs, urls)
+
+	return h
+}
+
+// Deny appends the given URLs to the disallowed URLs of the Harvester and returns the Harvester for chaining.
+func (h *Harvester) Deny(urls []string) *Harvester {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.DisallowedURLs = slices.Concat(h.DisallowedURLs, urls)
+
+	return h
+}
+
+// RequestDo is a functional option that adds a request middleware to the Harvester.
+// Triggers the given ReqMiddleware for each request before it is fetched.
+func (h *Harvester) RequestDo(mw ReqMiddleware) {
+	h.RequestDoNamed("", mw)
 }
 
 // ResponseDo is a functional option that adds a response middleware to the Harvester.
 // Triggers the given ResMiddleware for each response after a request.
 func (h *Harvester) ResponseDo(mw ResMiddleware) {
+	h.ResponseDoNamed("", mw)
+}
+
+// StatusDo adds a response middleware to the Harvester that is only triggered for
+// responses with the given status code. Status middlewares run after the ResponseDo middlewares.
+func (h *Harvester) StatusDo(code int, mw ResMiddleware) {
+	h.StatusRangeDo(code, code, mw)
+}
+
+// StatusRangeDo adds a response middleware to the Harvester that is only triggered for
+// responses with a status code between lo and hi, inclusive. Status middlewares run after
+// the ResponseDo middlewares.
+func (h *Harvester) StatusRangeDo(lo, hi int, mw ResMiddleware) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.statusMiddlewares = append(h.statusMiddlewares, statusMiddleware{
+		name:     h.middlewareName("", MiddlewareStatus),
+		lo:       lo,
+		hi:       hi,
+		function: mw,
+	})
+}
+
+// OnStatus adds a callback to the Harvester that is only called for responses with the given status
+// code, like StatusDo. Status callbacks run after the ResponseDo middlewares, in the order they were added.
+func (h *Harvester) OnStatus(code int, fn func(res *Response)) {
+	h.StatusDo(code, fn)
+}
+
+// OnStatusClass adds a callback to the Harvester that is only called for responses of the given status
+// class, e.g. 4 for the 4xx responses, like StatusRangeDo. Status callbacks run after the ResponseDo
+// middlewares, in the order they were added.
+func (h *Harvester) OnStatusClass(class int, fn func(res *Response)) {
+	h.StatusRangeDo(class*100, class*100+99, fn)
+}
+
+// MetricsDo adds a callback to the Harvester that receives a FetchMetric for each completed
+// HTTP exchange, including failed ones. See FetchMetric for when to use MetricsDo over Stats
+// or a Debugger.
+func (h *Harvester) MetricsDo(fn MetricsCallback) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.metricsCallbacks = append(h.metricsCallbacks, fn)
+}
+
+// BeforeVisit adds a callback to the Harvester that approves each URL after the filters have passed
+// but before the request is built. A non-nil error returned by the callback skips visiting the URL,
+// and the skip is reported to the OnFiltered callbacks.
+func (h *Harvester) BeforeVisit(fn VisitCallback) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.beforeVisitCallbacks = append(h.beforeVisitCallbacks, fn)
+}
+
+// OnFiltered adds a callback to the Harvester that is notified when a URL is filtered out
+// by the allowed and disallowed URLs or the URL templates, vetoed by a BeforeVisit callback or rejected
+// by the HEAD probe.
+func (h *Harvester) OnFiltered(fn FilteredCallback) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.filteredCallbacks = append(h.filteredCallbacks, fn)
+}
+
+// OnRobotsDisallowed adds a callback to the Harvester that is notified with the URL
+// whenever robots.txt disallows fetching a URL.
+func (h *Harvester) OnRobotsDisallowed(fn func(u string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.robotsDisallowedCallbacks = append(h.robotsDisallowedCallbacks, fn)
+}
+
+// OnForbiddenURL adds a callback to the Harvester that is notified with the URL
+// whenever the allowed and disallowed URLs forbid fetching a URL.
+func (h *Harvester) OnForbiddenURL(fn func(u string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.forbiddenURLCallbacks = append(h.forbiddenURLCallbacks, fn)
+}
+
+// OnRevisit adds a callback to the Harvester that is notified when an already visited URL is
+// fetched again because AllowRevisit is enabled. The callback receives the URL and the number
+// of times it has been visited so far.
+func (h *Harvester) OnRevisit(fn func(u string, visitCount int)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.revisitCallbacks = append(h.revisitCallbacks, fn)
+}
+
+// OnDuplicate adds a callback to the Harvester that is notified with the requested URL and the final
+// URL when a request is redirected to a URL that was already visited. The Html middlewares are not
+// run for such a response, so the links of the final page are not followed again.
+func (h *Harvester) OnDuplicate(fn func(u, finalURL string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.duplicateCallbacks = append(h.duplicateCallbacks, fn)
+}
+
+// OnFirstResponse adds a callback to the Harvester that is called once, with the first successful
+// (2xx) response of the crawl, before its ResponseDo middlewares. It is meant for reading context used
+// by the whole crawl, such as a CSRF token. When pages are fetched concurrently, the first response is
+// the first one to complete, not the response of the first Visit, and other successful responses wait
+// for the callbacks to return before their own middlewares run.
+func (h *Harvester) OnFirstResponse(fn ResMiddleware) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	h.responseMiddlewares = append(h.responseMiddlewares, mw)
+	h.firstResponseCallbacks = append(h.firstResponseCallbacks, fn)
 }
 
 // HtmlDo is a functional option that adds a Html middleware to the Harvester.
@@ -224,42 +970,231 @@ func (h *Harvester) ResponseDo(mw ResMiddleware) {
 //
 // SEE GoQuery documentation for more information on selectors: https://pkg.go.dev/github.com/PuerkitoBio/goquery
 func (h *Harvester) HtmlDo(gqSelector string, fn HtmlCallback) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.HtmlDoNamed("", gqSelector, fn)
+}
+
+// HtmlDoWithTimeout adds a Html middleware to the Harvester like HtmlDo, running the callback
+// with a context that is canceled after the given timeout. If the callback does not return in time,
+// a warning is logged and the crawl moves on without waiting for it. The callback should return
+// when the context is done, as it keeps running otherwise. With WithBufferPool, the body of the
+// response is copied out of the pool, as the callback can outlive the callbacks of the response.
+func (h *Harvester) HtmlDoWithTimeout(gqSelector string, timeout time.Duration, fn HtmlCallbackWithContext) {
+	h.HtmlDo(gqSelector, func(el *HtmlElement) {
+		ctx, cancel := context.WithTimeout(h.Context, timeout)
+		defer cancel()
+
+		el.Response.detach()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fn(ctx, el)
+		}()
 
-	h.htmlMiddlewares = append(h.htmlMiddlewares, HtmlMiddleware{
-		Selector: gqSelector,
-		Function: fn,
+		select {
+		case <-done:
+		case <-ctx.Done():
+			h.logger.Warn("html callback timed out",
+				slog.String("selector", gqSelector),
+				slog.String("url", el.Request.URL.String()),
+				slog.Duration("timeout", timeout),
+			)
+		}
 	})
 }
 
+// Graph returns the recorded link graph.
+// Returns nil if the link graph is not enabled with the WithLinkGraph functional option.
+func (h *Harvester) Graph() *LinkGraph {
+	return h.graph
+}
+
+// DepthOf returns the depth at which the given URL was visited and true,
+// or false if the URL has not been visited.
+func (h *Harvester) DepthOf(u string) (int, bool) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return 0, false
+	}
+
+	return h.store.VisitDepth(h.storeKey(parsedURL))
+}
+
+// ParentOf returns the URL of the page the given URL was first found on and true,
+// or false if the URL was not crawled from another page.
+func (h *Harvester) ParentOf(u string) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	parent, ok := h.parents[u]
+	return parent, ok
+}
+
+// CrawlTree returns a copy of the crawl tree as a map of crawled URLs to the URL
+// of the page they were first found on.
+func (h *Harvester) CrawlTree() map[string]string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	tree := make(map[string]string, len(h.parents))
+	for u, parent := range h.parents {
+		tree[u] = parent
+	}
+
+	return tree
+}
+
+// Stats returns a snapshot of the crawl counters of the Harvester.
+// It is safe to call while the Harvester is crawling.
+func (h *Harvester) Stats() Stats {
+	s := h.stats.snapshot()
+	if h.hostStats {
+		s.Hosts = h.stats.hostSnapshot()
+	}
+	if h.budget != nil {
+		s.BudgetUsed, s.BudgetUsedByHost = h.budget.usage()
+	}
+
+	return s
+}
+
 // Visit requests the web page at the given URL if it is allowed to be fetched.
 // It returns a Response with the response data or an error if the request fails.
 func (h *Harvester) Visit(u string) error {
-	return h.fetch(u, http.MethodGet, 0)
+	return h.fetch(u, http.MethodGet, 0, inheritDepthLimit, nil)
 }
 
-func (h *Harvester) fetch(u, method string, depth int) error {
-	parsedURL, err := url.Parse(u)
+// VisitAbsolute resolves the given href against the given base URL and visits it like Visit.
+// Empty hrefs and hrefs that resolve to an empty URL, such as fragment-only links, are ignored.
+func (h *Harvester) VisitAbsolute(baseURL, href string) error {
+	if strings.TrimSpace(href) == "" {
+		return nil
+	}
+
+	base, err := url.Parse(baseURL)
 	if err != nil {
 		return err
 	}
 
-	if err := h.checkRobots(parsedURL); err != nil {
-		return err
+	absURL := (&Request{URL: base, harvester: h}).GetAbsoluteURL(href)
+	if absURL == "" {
+		return nil
 	}
 
-	if err := h.checkFilters(parsedURL); err != nil {
-		return err
+	return h.Visit(absURL)
+}
+
+// VisitWithDepth requests the web page at the given URL like Visit, but uses the given depth
+// budget instead of the DepthLimit of the Harvester for the whole subtree crawled from the page.
+// A depth budget of 0 or less means no depth limit for the subtree.
+func (h *Harvester) VisitWithDepth(u string, depthBudget int) error {
+	return h.fetch(u, http.MethodGet, 0, max(depthBudget, 0), nil)
+}
+
+// inheritDepthLimit is the depth limit of a fetch that uses the DepthLimit of the Harvester.
+// Any other depth limit, tracked on the Request, applies to the whole subtree crawled from
+// the request and takes precedence over the DepthLimit of the Harvester.
+const inheritDepthLimit = -1
+
+// requestBody is the body and the headers of a request that sends data, such as a GraphQL query.
+type requestBody struct {
+	data   []byte
+	header http.Header
+}
+
+func (h *Harvester) fetch(u, method string, depth, depthLimit int, referrer *url.URL) error {
+	res, err := h.fetchWithBody(u, method, nil, depth, depthLimit, referrer)
+	if res != nil {
+		res.release()
 	}
+	return err
+}
 
-	if err := h.checkDepth(depth); err != nil {
-		return err
+// fetchWithBody fetches the URL sending the given body, nil for none, and returns the response
+// after the callbacks have run.
+func (h *Harvester) fetchWithBody(u, method string, reqBody *requestBody, depth, depthLimit int, referrer *url.URL) (_ *Response, err error) {
+	h.stats.start()
+
+	if referrer == nil {
+		defer h.visits.track()()
+		defer h.trackProgress()()
 	}
 
-	req, err := http.NewRequestWithContext(h.Context, method, parsedURL.String(), http.NoBody)
+	parsedURL, err := url.Parse(u)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	h.debug(EventRequestQueued, parsedURL.String(), depth, 0, nil)
+
+	ctx, span := h.startFetch(parsedURL, depth)
+
+	statusCode := 0
+	defer func() {
+		span.End(statusCode, err)
+	}()
+
+	if err := h.checkDeadline(parsedURL, depth); err != nil {
+		return nil, err
+	}
+
+	if err := h.checkByteBudget(parsedURL, depth); err != nil {
+		return nil, err
+	}
+
+	_, endPhase := span.StartPhase(ctx, PhaseRobots)
+	err = h.checkRobots(parsedURL, depth)
+	endPhase(err)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key depends on the Clean-param directives of the robots.txt of the host.
+	key := h.requestKey(parsedURL, reqBody)
+
+	if err := h.checkFilters(parsedURL, key, depth, referrer); err != nil {
+		return nil, err
+	}
+
+	if err := h.checkDepth(parsedURL, depth, depthLimit); err != nil {
+		return nil, err
+	}
+
+	if err := h.checkBeforeVisit(parsedURL, depth); err != nil {
+		return nil, err
+	}
+
+	if err := h.checkHeadProbe(ctx, parsedURL, method, key, depth, referrer); err != nil {
+		return nil, err
+	}
+
+	if referrer != nil {
+		h.recordParent(parsedURL.String(), referrer.String())
+	}
+
+	// The bytes of the body are held from the first read until the callbacks have returned.
+	hold := h.inFlightBytes.hold()
+	defer hold.release()
+	ctx = withByteHold(ctx, hold)
+
+	var data io.Reader = http.NoBody
+	if reqBody != nil {
+		data = bytes.NewReader(reqBody.data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, parsedURL.String(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if reqBody != nil {
+		for name, values := range reqBody.header {
+			req.Header[name] = values
+		}
+	}
+
+	if referer := refererFor(h.refererPolicy, referrer, req.URL); referer != "" {
+		req.Header.Set("Referer", referer)
 	}
 
 	request := &Request{
@@ -269,37 +1204,101 @@ func (h *Harvester) fetch(u, method string, depth int) error {
 		Method:    req.Method,
 		Body:      req.Body,
 		Depth:     depth,
+		Referrer:  referrer,
+		maxDepth:  depthLimit,
 		harvester: h,
+		inFlight:  hold,
 	}
 
 	h.handleRequestDo(request)
 
-	res, err := h.Client.Do(req)
+	if request.ProxyURL != nil {
+		req = withProxyOverride(req, request.ProxyURL)
+	}
+
+	if h.inFlightBytes != nil {
+		if err := h.inFlightBytes.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := h.throttle(request); err != nil {
+		return nil, err
+	}
+
+	if h.httpTrace {
+		req = withTrace(req)
+	}
+
+	start := time.Now()
+	res, b, truncated, err := h.do(req, key, depth, span)
+	h.checkSlowRequest(request, start)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	h.store.Visit(req.URL.String())
+	if res.StatusCode == http.StatusUnauthorized {
+		if header, ok := h.handleAuthChallenge(request, res, b); ok {
+			h.debug(EventAuthChallenge, req.URL.String(), depth, res.StatusCode, nil)
 
-	defer func() {
-		if err := res.Body.Close(); err != nil {
-			log.Printf("error closing response body: %v for request of: %v", err, req.URL)
+			if req, err = h.retryRequest(ctx, req); err != nil {
+				return nil, err
+			}
+			for name, values := range header {
+				req.Header.Del(name)
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+			request.Headers = &req.Header
+			h.bufferPool.put(b)
+			hold.release()
+
+			start = time.Now()
+			res, b, truncated, err = h.do(req, key, depth, span)
+			h.checkSlowRequest(request, start)
+			if err != nil {
+				return nil, err
+			}
 		}
-	}()
+	}
 
-	// Read the full response body into `b`.
-	b, err := io.ReadAll(res.Body)
-	if err != nil {
-		return err
+	for attempt := 0; h.bodyRetry != nil && h.bodyRetry.shouldRetry(b, attempt); attempt++ {
+		if err := h.wait(h.bodyRetry.delay); err != nil {
+			return nil, err
+		}
+
+		if req, err = h.retryRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		h.bufferPool.put(b)
+		hold.release()
+
+		start = time.Now()
+		res, b, truncated, err = h.do(req, key, depth, span)
+		h.checkSlowRequest(request, start)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	statusCode = res.StatusCode
+	request.Proxy = proxyOf(res.Request)
+	if res.Request != nil {
+		request.finalURL = res.Request.URL
+	}
+
+	h.checkHeadMismatch(req.URL, key, res.Header.Get("Content-Type"))
+
+	duplicate := h.checkRedirectTarget(req.URL, res)
+
 	// Create a new reader from `b` for repeated reads.
 	body := bytes.NewReader(b)
 
 	// Reset the body reader for later use in `ResponseDo`.
 	_, err = body.Seek(0, io.SeekStart)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	response := &Response{
@@ -307,53 +1306,362 @@ func (h *Harvester) fetch(u, method string, depth int) error {
 		Headers:    &res.Header,
 		Request:    request,
 		Body:       body,
+		Trace:      traceOf(req),
+		Truncated:  truncated,
+		content:    b,
+		hasher:     h.contentHasher,
+		pool:       h.bufferPool,
 	}
 
+	_, endPhase = span.StartPhase(ctx, PhaseCallbacks)
+
+	h.handleFirstResponse(response)
+
 	h.handleResponseDo(response)
 
-	h.handleHtmlDo(response)
+	h.handleStatusDo(response)
 
-	return nil
+	if !duplicate {
+		// Streamed links do not need the DOM of the page unless it has HtmlDo callbacks.
+		if !h.streamingLinks || h.hasHtmlMiddlewares() {
+			h.handleHtmlDo(response)
+		}
+
+		if h.streamingLinks {
+			h.followStreamingLinks(response)
+		}
+
+		if h.followHeaderLinks {
+			h.followLinkHeaderResources(response)
+		}
+	}
+
+	endPhase(nil)
+
+	return response, nil
+}
+
+// do sends the request and reads the full response body, or the part of it that fits into the download
+// budget, reporting whether the body was cut short. The returned response body is closed.
+func (h *Harvester) do(req *http.Request, key string, depth int, span FetchSpan) (_ *http.Response, _ []byte, truncated bool, _ error) {
+	release, err := h.enterCrawlDelay(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer release()
+
+	if err := h.concurrency.acquire(req.Context()); err != nil {
+		return nil, nil, false, err
+	}
+	defer h.concurrency.release()
+
+	h.stats.requestsAttempted.Add(1)
+	h.stats.inFlight.Add(1)
+	defer h.stats.inFlight.Add(-1)
+
+	ctx, endPhase := span.StartPhase(req.Context(), PhaseRequest)
+	span.Inject(ctx, req.Header)
+
+	h.debug(EventRequestStarted, req.URL.String(), depth, 0, nil)
+
+	start := time.Now()
+
+	req = withProxyRecorder(req)
+
+	req, timer := h.responseTimer(req)
+	defer timer.stop()
+
+	res, err := h.send(req, depth)
+
+	if h.proxyPool != nil {
+		h.proxyPool.Report(proxyOf(req), err)
+	}
+	if err != nil {
+		err = wrapProxyError(req, err)
+	}
+	endPhase(err)
+	if err != nil {
+		h.stats.requestsFailed.Add(1)
+		h.recordExchange(req, nil, depth, start, nil, err)
+		return nil, nil, false, err
+	}
+
+	if h.marksVisited(res.StatusCode) {
+		h.store.Visit(key)
+
+		// Keep the shallowest depth at which the URL was visited.
+		if d, ok := h.store.VisitDepth(key); !ok || depth < d {
+			h.store.SetVisitDepth(key, depth)
+		}
+	}
+
+	defer h.closeBody(res)
+
+	// Read the full response body into `b`.
+	timer.start()
+	_, endPhase = span.StartPhase(req.Context(), PhaseBody)
+	b, truncated, err := h.readBody(req, res.Body)
+	if err != nil && h.resumableDownloads {
+		b, truncated, err = h.resumeBody(req, res, depth, b, err)
+	}
+	if err != nil && timer.expired() {
+		h.logger.Warn("response body too slow",
+			slog.String("url", req.URL.String()),
+			slog.Duration("max_response_time", h.maxResponseTime),
+		)
+		err = timer.err
+	}
+	endPhase(err)
+	endTrace(req)
+	h.stats.bytesDownloaded.Add(int64(len(b)))
+	if err != nil {
+		h.stats.requestsFailed.Add(1)
+		h.recordExchange(req, res, depth, start, b, err)
+		h.bufferPool.put(b)
+		return nil, nil, false, err
+	}
+
+	h.stats.requestsSucceeded.Add(1)
+	h.stats.recordStatus(res.StatusCode)
+	h.recordExchange(req, res, depth, start, b, nil)
+
+	return res, b, truncated, nil
+}
+
+// readBody reads a response body of the request into a buffer of the buffer pool, or the part of it
+// that fits into the download budget, reporting whether the body was cut short.
+func (h *Harvester) readBody(req *http.Request, r io.Reader) (_ []byte, truncated bool, _ error) {
+	if hold := byteHoldOf(req); hold != nil {
+		r = hold.reader(r)
+	}
+
+	var budget *budgetReader
+	if h.budget != nil {
+		budget = h.budget.reader(req.URL.Host, r)
+		r = budget
+	}
+
+	b, err := h.bufferPool.readAll(r)
+	if err != nil && budget != nil && err == budget.exceeded {
+		h.logger.Warn("response body truncated",
+			slog.String("url", req.URL.String()),
+			slog.Any("error", err),
+		)
+		h.stats.truncated.Add(1)
+		h.notifyHostDropped(req.URL.Host)
+		return b, true, nil
+	}
+
+	return b, false, err
+}
+
+// send performs the exchange of the request with the stub registered for its URL, the file system
+// for file:// URLs, the Backend of the Harvester if set, or else its client.
+func (h *Harvester) send(req *http.Request, depth int) (*http.Response, error) {
+	switch stub := h.stubFor(req.URL.String()); {
+	case stub != nil:
+		return stub.response(req), nil
+	case isFileURL(req.URL):
+		return fileResponse(req)
+	case h.backend != nil:
+		return h.doBackend(req, depth)
+	default:
+		return h.doProxied(req)
+	}
+}
+
+// marksVisited reports whether a response with the given status code marks its URL as visited.
+func (h *Harvester) marksVisited(statusCode int) bool {
+	if h.visitedStatusCodes != nil {
+		return h.visitedStatusCodes(statusCode)
+	}
+
+	return statusCode < http.StatusInternalServerError
+}
+
+// recordExchange records a completed HTTP exchange that started at start, with the read body b.
+// The response is nil if the request failed without a response.
+func (h *Harvester) recordExchange(req *http.Request, res *http.Response, depth int, start time.Time, b []byte, err error) {
+	statusCode := 0
+	if res != nil {
+		statusCode = res.StatusCode
+	}
+
+	h.debug(EventResponseReceived, req.URL.String(), depth, statusCode, err)
+	h.stats.recordHost(req.URL.Host, statusCode, time.Since(start), len(b), err)
+	h.handleMetricsDo(req, depth, statusCode, start, len(b), err)
+	h.recordOutcome(req, statusCode, err)
+
+	if h.har != nil {
+		h.har.record(req, res, start, b, err)
+	}
+}
+
+// checkRedirectTarget reports whether the request was redirected to a URL that was already visited,
+// notifying the OnDuplicate callbacks, and marks the final URL of a redirected request as visited otherwise.
+func (h *Harvester) checkRedirectTarget(requested *url.URL, res *http.Response) bool {
+	if res.Request == nil || res.Request.URL.String() == requested.String() {
+		return false
+	}
+
+	final := res.Request.URL
+	key := h.storeKey(final)
+	if !h.store.Visited(key) {
+		if h.marksVisited(res.StatusCode) {
+			h.store.Visit(key)
+		}
+		return false
+	}
+
+	for _, fn := range h.duplicateCallbacks {
+		fn(requested.String(), final.String())
+	}
+
+	return true
+}
+
+// recordOutcome records the outcome of the request for the broken link report if the link graph is enabled.
+func (h *Harvester) recordOutcome(req *http.Request, statusCode int, err error) {
+	if h.graph != nil {
+		h.graph.recordOutcome(req.URL.String(), statusCode, err)
+	}
+}
+
+// checkSlowRequest calls the slow request callback if the request started at start took
+// longer than the slow request threshold.
+func (h *Harvester) checkSlowRequest(req *Request, start time.Time) {
+	if h.slowRequest == nil {
+		return
+	}
+
+	if elapsed := time.Since(start); elapsed > h.slowRequest.threshold {
+		h.slowRequest.callback(req, elapsed)
+	}
+}
+
+// recordParent records the parent of the URL unless one is already recorded.
+func (h *Harvester) recordParent(u, parent string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.parents[u]; !ok {
+		h.parents[u] = parent
+	}
+}
+
+// closeBody closes the body of the response, logging a warning if closing fails.
+func (h *Harvester) closeBody(res *http.Response) {
+	if err := res.Body.Close(); err != nil {
+		h.logger.Warn("error closing response body",
+			slog.String("url", res.Request.URL.String()),
+			slog.String("host", res.Request.URL.Host),
+			slog.Any("error", err),
+		)
+	}
 }
 
 func (h *Harvester) handleRequestDo(req *Request) {
-	for _, m := range h.requestMiddlewares {
-		m(req)
+	h.mu.RLock()
+	middlewares := h.requestMiddlewares
+	h.mu.RUnlock()
+
+	for _, m := range middlewares {
+		h.runMiddleware(m.name, req.URL.String(), req.Depth, 0, func() {
+			m.function(req)
+		})
+	}
+}
+
+// handleFirstResponse calls the OnFirstResponse callbacks if the response is the first successful response.
+func (h *Harvester) handleFirstResponse(res *Response) {
+	if len(h.firstResponseCallbacks) == 0 || res.StatusCode < 200 || res.StatusCode > 299 {
+		return
 	}
+
+	h.firstResponse.Do(func() {
+		for _, fn := range h.firstResponseCallbacks {
+			fn(res)
+		}
+
+		// The callbacks may have read the body, let the middlewares read it from the start.
+		res.Body = bytes.NewReader(res.content)
+	})
 }
 
 func (h *Harvester) handleResponseDo(res *Response) {
-	for _, m := range h.responseMiddlewares {
-		m(res)
+	h.mu.RLock()
+	middlewares := h.responseMiddlewares
+	h.mu.RUnlock()
+
+	for _, m := range middlewares {
+		h.runMiddleware(m.name, res.Request.URL.String(), res.Request.Depth, res.StatusCode, func() {
+			m.function(res)
+		})
+	}
+}
+
+func (h *Harvester) handleStatusDo(res *Response) {
+	h.mu.RLock()
+	middlewares := h.statusMiddlewares
+	h.mu.RUnlock()
+
+	for _, m := range middlewares {
+		if res.StatusCode >= m.lo && res.StatusCode <= m.hi {
+			h.runMiddleware(m.name, res.Request.URL.String(), res.Request.Depth, res.StatusCode, func() {
+				m.function(res)
+			})
+		}
 	}
 }
 
 func (h *Harvester) handleHtmlDo(res *Response) {
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
-		log.Printf("error parsing response body: %v", err)
+		h.logger.Warn("error parsing response body",
+			slog.String("url", res.Request.URL.String()),
+			slog.String("host", res.Request.Host),
+			slog.Any("error", err),
+		)
+		h.debug(EventCallbackError, res.Request.URL.String(), res.Request.Depth, res.StatusCode, err)
 		return
 	}
 
-	for _, m := range h.htmlMiddlewares {
+	res.Request.BaseURL = extractBaseHref(doc, res.Request.URL)
+
+	h.mu.RLock()
+	middlewares := h.htmlMiddlewares
+	h.mu.RUnlock()
+
+	for _, m := range middlewares {
 		doc.Find(m.Selector).Each(func(i int, s *goquery.Selection) {
 			for _, n := range s.Nodes {
+				attributes := n.Attr
+				if h.trimURLWhitespace {
+					attributes = trimHrefWhitespace(attributes)
+				}
+
 				el := &HtmlElement{
-					attributes: n.Attr,
+					attributes: attributes,
 					Text:       s.Text(),
 					Request:    res.Request,
 					Response:   res,
 					Selection:  s,
 				}
 
-				m.Function(el)
+				h.runMiddleware(m.Name, res.Request.URL.String(), res.Request.Depth, res.StatusCode, func() {
+					m.Function(el)
+				})
 			}
 		})
 	}
+
+	if h.followFrames && !h.streamingLinks {
+		h.followFrameSources(doc, res)
+	}
 }
 
-func (h *Harvester) checkRobots(parsedURL *url.URL) error {
-	if h.ignoreRobots {
+func (h *Harvester) checkRobots(parsedURL *url.URL, depth int) error {
+	if h.ignoreRobots || isFileURL(parsedURL) || h.stubFor(parsedURL.String()) != nil {
 		return nil
 	}
 
@@ -362,74 +1670,148 @@ func (h *Harvester) checkRobots(parsedURL *url.URL) error {
 	h.mu.Unlock()
 
 	if !ok {
-		robotURL := parsedURL.Scheme + "://" + parsedURL.Host + "/robots.txt"
-		res, err := h.Client.Get(robotURL) //nolint: noctx // we don't need a context here
+		if d := h.initialDelay.next(parsedURL.Host); d > 0 {
+			if err := h.wait(d); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		robot, err = h.fetchRobots(parsedURL, depth)
 		if err != nil {
 			return err
 		}
+	}
 
-		defer func() {
-			if err := res.Body.Close(); err != nil {
-				log.Printf("error closing response body: %v for request of: %v", err, robotURL)
-			}
-		}()
+	if !robotsAllowed(robot, parsedURL.Path, h.robotsAgents) {
+		h.stats.skippedRobots.Add(1)
+		err := ErrRobotsDisallowed(parsedURL.String())
+		h.debug(EventRobotsDenied, parsedURL.String(), depth, 0, err)
+		for _, fn := range h.robotsDisallowedCallbacks {
+			fn(parsedURL.String())
+		}
+		return err
+	}
 
-		robot, err = robotstxt.FromResponse(res)
-		if err != nil {
+	return nil
+}
+
+func (h *Harvester) checkFilters(parsedURL *url.URL, key string, depth int, referrer *url.URL) error {
+	u := parsedURL.String()
+
+	if h.store.Visited(key) {
+		if !h.AllowRevisit {
+			h.stats.skippedVisited.Add(1)
+			err := ErrVisitedURL(u)
+			h.debug(EventVisitedSkip, u, depth, 0, err)
 			return err
 		}
 
-		h.mu.Lock()
-		h.robotsMap[parsedURL.Host] = robot
-		h.mu.Unlock()
+		if len(h.revisitCallbacks) > 0 {
+			visitCount := h.store.VisitCount(key)
+			for _, fn := range h.revisitCallbacks {
+				fn(u, visitCount)
+			}
+		}
+	}
+
+	// Local files may only be linked from local files, so that web pages cannot read them.
+	if !h.isURLAllowed(u) || isFileURL(parsedURL) && referrer != nil && !isFileURL(referrer) {
+		h.stats.skippedFiltered.Add(1)
+		err := ErrForbiddenURL(u)
+		h.debug(EventFilteredOut, u, depth, 0, err)
+		for _, fn := range h.forbiddenURLCallbacks {
+			fn(u)
+		}
+		h.handleOnFiltered(parsedURL, err)
+		return err
 	}
 
-	if !robot.TestAgent(parsedURL.Path, "Grawlr") {
-		return ErrRobotsDisallowed(parsedURL.String())
+	if referrer != nil && !h.matchesURLTemplates(parsedURL.Path) {
+		h.stats.skippedFiltered.Add(1)
+		err := ErrURLTemplateMismatch(u)
+		h.debug(EventFilteredOut, u, depth, 0, err)
+		h.handleOnFiltered(parsedURL, err)
+		return err
 	}
 
 	return nil
 }
 
-func (h *Harvester) checkFilters(parsedURL *url.URL) error {
-	u := parsedURL.String()
+// storeKey returns the key of the URL in the Storer used to deduplicate visits.
+func (h *Harvester) storeKey(u *url.URL) string {
+	u = h.cleanURL(u)
 
-	if !h.AllowRevisit && h.store.Visited(u) {
-		return ErrVisitedURL(u)
+	if h.collapseWWW && strings.HasPrefix(strings.ToLower(u.Host), "www.") {
+		c := *u
+		c.Host = c.Host[len("www."):]
+		return c.String()
 	}
 
-	if !h.isURLAllowed(u) {
-		return ErrForbiddenURL(u)
+	return u.String()
+}
+
+// requestKey returns the key of the request in the Storer used to deduplicate visits. Requests sending
+// a body are keyed by their URL and a hash of the body, so that e.g. GraphQL queries to the same
+// endpoint are not deduplicated.
+func (h *Harvester) requestKey(u *url.URL, reqBody *requestBody) string {
+	key := h.storeKey(u)
+	if reqBody != nil {
+		key += " " + FNVContentHasher(reqBody.data)
 	}
 
-	return nil
+	return key
 }
 
-func (h *Harvester) checkDepth(depth int) error {
-	if h.DepthLimit != 0 && depth >= h.DepthLimit {
-		return ErrDepthLimitExceeded(depth, h.DepthLimit)
+func (h *Harvester) checkBeforeVisit(parsedURL *url.URL, depth int) error {
+	for _, fn := range h.beforeVisitCallbacks {
+		if veto := fn(parsedURL); veto != nil {
+			h.stats.skippedFiltered.Add(1)
+			err := ErrVetoedURL(parsedURL.String(), veto)
+			h.debug(EventFilteredOut, parsedURL.String(), depth, 0, err)
+			h.handleOnFiltered(parsedURL, err)
+			return err
+		}
 	}
 
 	return nil
 }
 
-// isURLAllowed checks if the given URL is allowed to be fetched.
-func (h *Harvester) isURLAllowed(u string) bool {
-	for _, disallowed := range h.DisallowedURLs {
-		if strings.HasPrefix(u, disallowed) {
-			return false
-		}
+func (h *Harvester) handleOnFiltered(u *url.URL, err error) {
+	for _, fn := range h.filteredCallbacks {
+		fn(u, err)
 	}
+}
 
-	if len(h.AllowedURLs) == 0 {
-		return true
+func (h *Harvester) checkDepth(parsedURL *url.URL, depth, depthLimit int) error {
+	limit := h.depthLimit()
+	if depthLimit != inheritDepthLimit {
+		limit = depthLimit
 	}
 
-	for _, allowed := range h.AllowedURLs {
-		if strings.HasPrefix(u, allowed) {
-			return true
-		}
+	if limit != 0 && depth >= limit {
+		h.stats.skippedDepth.Add(1)
+		err := ErrDepthLimitExceeded(depth, limit)
+		h.debug(EventFilteredOut, parsedURL.String(), depth, 0, err)
+		return err
 	}
 
-	return false
+	return nil
+}
+
+// isURLAllowed checks if the given URL is allowed to be fetched against a snapshot of the URL filter lists.
+func (h *Harvester) isURLAllowed(u string) bool {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	h.mu.RLock()
+	scope, allowed, disallowed := h.scope, h.AllowedURLs, h.DisallowedURLs
+	h.mu.RUnlock()
+
+	scope.AllowedURLs = slices.Concat(allowed, scope.AllowedURLs)
+	scope.DisallowedURLs = slices.Concat(disallowed, scope.DisallowedURLs)
+
+	return scope.Allows(parsedURL)
 }
@@ -16,13 +16,25 @@
 package grawlr
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -78,6 +90,11 @@ func newUnstartedTestServer() *httptest.Server {
 		w.Write([]byte(r.Header.Get("User-Agent")))
 	}))
 
+	mux.Handle("/referer", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(r.Header.Get("Referer")))
+	}))
+
 	mux.HandleFunc("/faq", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, `
@@ -120,6 +137,39 @@ func newUnstartedTestServer() *httptest.Server {
 		`)
 	})
 
+	mux.HandleFunc("/base_href", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, `
+			<!DOCTYPE html>
+			<html>
+			<head>
+				<title>Base Href</title>
+				<base href="https://other.example.com/path/">
+			</head>
+			<body>
+				<a href="page1">Page 1</a>
+				<a href="/page2">Page 2</a>
+				<a href="../page3">Page 3</a>
+			</body>
+			</html>
+		`)
+	})
+
+	mux.HandleFunc("/broken_links", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, `
+			<!DOCTYPE html>
+			<html>
+			<head><title>Broken Links</title></head>
+			<body>
+				<a href="/">Home</a>
+				<a href="/404">Missing page</a>
+				<a href="http://127.0.0.1:1/dead">Dead external</a>
+			</body>
+			</html>
+		`)
+	})
+
 	mux.HandleFunc("/complex_whitespace", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, `
@@ -141,6 +191,23 @@ func newUnstartedTestServer() *httptest.Server {
 		`)
 	})
 
+	mux.HandleFunc("/nofollow_links", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, `
+			<!DOCTYPE html>
+			<html>
+			<body>
+				<a href="/about">About Us</a>
+				<a href="https://external.com/resource" rel="nofollow">External Resource</a>
+			</body>
+			</html>
+		`)
+	})
+
+	mux.HandleFunc("/moved_links", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/nofollow_links", http.StatusMovedPermanently)
+	})
+
 	return httptest.NewUnstartedServer(mux)
 }
 
@@ -387,4 +454,1794 @@ func TestHarvester_Clone(t *testing.T) {
 	assert.NotEqual(t, h1.requestMiddlewares, h2.requestMiddlewares)
 	assert.NotEqual(t, h1.responseMiddlewares, h2.responseMiddlewares)
 	assert.NotEqual(t, h1.htmlMiddlewares, h2.htmlMiddlewares)
+
+	t.Run("ProxyFunc", func(t *testing.T) {
+		h := newTestHarvester(WithProxyFunc(func(req *http.Request) (*url.URL, error) {
+			return nil, nil
+		}))
+
+		clone := h.Clone()
+
+		assert.NotNil(t, clone.proxyFunc)
+		assert.True(t, clone.Config().ProxyFunc)
+	})
+}
+
+func TestHarvester_StatusDo(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var okCalled, notFoundCalled, redirectCalled, serverErrorCalled int
+
+	h := newTestHarvester()
+
+	h.StatusDo(http.StatusOK, func(res *Response) {
+		okCalled++
+	})
+
+	h.StatusDo(http.StatusNotFound, func(res *Response) {
+		notFoundCalled++
+	})
+
+	h.StatusRangeDo(300, 399, func(res *Response) {
+		redirectCalled++
+
+		assert.Equal(t, "/", res.Location())
+		assert.Equal(t, server.URL+"/", res.RedirectURL())
+	})
+
+	h.StatusRangeDo(500, 599, func(res *Response) {
+		serverErrorCalled++
+
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+	assert.Equal(t, []int{0, 1, 0, 0}, []int{okCalled, notFoundCalled, redirectCalled, serverErrorCalled})
+
+	assert.NoError(t, h.Visit(server.URL+"/redirect"))
+	assert.Equal(t, []int{0, 1, 1, 0}, []int{okCalled, notFoundCalled, redirectCalled, serverErrorCalled})
+
+	assert.NoError(t, h.Visit(server.URL+"/error"))
+	assert.Equal(t, []int{0, 1, 1, 1}, []int{okCalled, notFoundCalled, redirectCalled, serverErrorCalled})
+}
+
+func TestHarvester_OnStatus(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithAllowRevisit(true))
+
+	var calls []string
+	h.ResponseDo(func(res *Response) {
+		calls = append(calls, "response")
+	})
+	h.OnStatus(http.StatusNotFound, func(res *Response) {
+		calls = append(calls, "404")
+	})
+	h.OnStatusClass(4, func(res *Response) {
+		calls = append(calls, "4xx")
+	})
+	h.OnStatusClass(2, func(res *Response) {
+		calls = append(calls, "2xx")
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+	assert.Equal(t, []string{"response", "404", "4xx"}, calls)
+
+	calls = nil
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, []string{"response", "2xx"}, calls)
+
+	calls = nil
+	assert.NoError(t, h.Visit(server.URL+"/error"))
+	assert.Equal(t, []string{"response"}, calls)
+}
+
+func TestHarvester_SetAllowedURLs(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	h.SetAllowedURLs([]string{server.URL + "/faq"})
+
+	url := server.URL + "/allowed"
+	assert.EqualError(t, h.Visit(url), fmt.Sprintf("URL %s is forbidden", url))
+
+	h.AddAllowedURL(server.URL + "/allowed")
+	assert.NoError(t, h.Visit(url))
+
+	h.SetDisallowedURLs([]string{server.URL + "/faq"})
+
+	url = server.URL + "/faq"
+	assert.EqualError(t, h.Visit(url), fmt.Sprintf("URL %s is forbidden", url))
+
+	h.AddDisallowedURL(server.URL + "/allowed")
+	assert.Equal(t, []string{server.URL + "/faq", server.URL + "/allowed"}, h.Config().DisallowedURLs)
+
+	assert.True(t, h.RemoveDisallowedURL(server.URL+"/faq"))
+	assert.False(t, h.RemoveDisallowedURL(server.URL+"/faq"))
+	assert.NoError(t, h.Visit(url))
+
+	assert.True(t, h.RemoveAllowedURL(server.URL+"/faq"))
+	assert.Equal(t, []string{server.URL + "/allowed"}, h.Config().AllowedURLs)
+}
+
+func TestHarvester_URLFilters_CopyOnWrite(t *testing.T) {
+	urls := make([]string, 1, 4)
+	urls[0] = "https://example.com/a"
+
+	h := NewHarvester()
+	h.SetAllowedURLs(urls)
+	clone := h.Clone()
+
+	h.AddAllowedURL("https://example.com/b")
+	clone.AddAllowedURL("https://example.com/c")
+	urls[0] = "https://example.com/changed"
+
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b"}, h.Config().AllowedURLs)
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/c"}, clone.Config().AllowedURLs)
+}
+
+func TestHarvester_URLFilters_DuringCrawl(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithAllowRevisit(true), WithAllowedURLs([]string{server.URL + "/"}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				h.Visit(server.URL + "/allowed")
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		h.AddDisallowedURL(server.URL + "/allowed")
+		h.AddAllowedURL(server.URL + "/faq")
+		h.RemoveDisallowedURL(server.URL + "/allowed")
+		h.RemoveAllowedURL(server.URL + "/faq")
+	}
+	wg.Wait()
+
+	assert.Equal(t, []string{server.URL + "/"}, h.Config().AllowedURLs)
+	assert.Empty(t, h.Config().DisallowedURLs)
+}
+
+func TestHarvester_LinkGraph(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithLinkGraph(true), WithDepthLimit(2))
+
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		link := el.Attribute("href")
+		absURL := el.Request.GetAbsoluteURL(link)
+		if absURL == "" {
+			return
+		}
+		el.Request.Visit(absURL)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/relative_links"))
+
+	graph := h.Graph().Adjacency()
+	assert.Equal(t, []string{
+		server.URL + "/page1",
+		server.URL + "/page2",
+		server.URL + "/page3",
+		server.URL + "/path/to/page4",
+		server.URL + "/path/to/page5",
+	}, graph[server.URL+"/relative_links"])
+
+	assert.Nil(t, newTestHarvester().Graph())
+}
+
+func TestHarvester_Stats(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithDisallowedURLs([]string{server.URL + "/faq"}))
+
+	assert.Equal(t, time.Duration(0), h.Stats().Elapsed)
+
+	h.Visit(server.URL + "/")
+	h.Visit(server.URL + "/")
+	h.Visit(server.URL + "/404")
+	h.Visit(server.URL + "/faq")
+	h.Visit(server.URL + "/disallowed")
+
+	stats := h.Stats()
+
+	assert.Equal(t, int64(2), stats.RequestsAttempted)
+	assert.Equal(t, int64(2), stats.RequestsSucceeded)
+	assert.Equal(t, int64(0), stats.RequestsFailed)
+	assert.Equal(t, int64(1), stats.SkippedVisited)
+	assert.Equal(t, int64(1), stats.SkippedFiltered)
+	assert.Equal(t, int64(1), stats.SkippedRobots)
+	assert.Equal(t, int64(0), stats.SkippedDepth)
+	assert.Equal(t, map[string]int64{"2xx": 1, "4xx": 1}, stats.ResponsesByClass)
+	assert.Equal(t, int64(0), stats.InFlight)
+	assert.Greater(t, stats.BytesDownloaded, int64(len(helloBytes)))
+	assert.Greater(t, stats.Elapsed, time.Duration(0))
+}
+
+func TestHarvester_RetryOnBody(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Write([]byte("Please wait..."))
+			return
+		}
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	pattern := regexp.MustCompile("Please wait")
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithRetryOnBody(pattern, 5, 10*time.Millisecond))
+
+	var body []byte
+	h.ResponseDo(func(res *Response) {
+		body, _ = io.ReadAll(res.Body)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, helloBytes, body)
+
+	attempts = 0
+
+	h = newTestHarvester(WithIgnoreRobots(true), WithRetryOnBody(pattern, 1, 10*time.Millisecond))
+	h.ResponseDo(func(res *Response) {
+		body, _ = io.ReadAll(res.Body)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, []byte("Please wait..."), body)
+}
+
+func TestHarvester_HtmlDoWithTimeout(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	h := newTestHarvester(WithLogger(logger))
+
+	var titles []string
+	h.HtmlDoWithTimeout("title", time.Second, func(ctx context.Context, el *HtmlElement) {
+		titles = append(titles, el.Text)
+	})
+
+	canceled := make(chan error, 1)
+	h.HtmlDoWithTimeout("h1", 10*time.Millisecond, func(ctx context.Context, el *HtmlElement) {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+
+	assert.Equal(t, []string{"FAQ"}, titles)
+	assert.ErrorIs(t, <-canceled, context.DeadlineExceeded)
+	assert.Contains(t, buf.String(), `"msg":"html callback timed out"`)
+	assert.Contains(t, buf.String(), `"selector":"h1"`)
+	assert.Contains(t, buf.String(), fmt.Sprintf(`"url":"%s/faq"`, server.URL))
+	assert.NotContains(t, buf.String(), `"selector":"title"`)
+
+	t.Run("BufferPool", func(t *testing.T) {
+		pages := map[string]string{
+			"/a": "<p>" + strings.Repeat("a", 1000) + "</p>",
+			"/b": "<p>" + strings.Repeat("b", 1000) + "</p>",
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(pages[r.URL.Path]))
+		}))
+		defer server.Close()
+
+		h := newTestHarvester(WithIgnoreRobots(true), WithBufferPool(true), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+		unblock := make(chan struct{})
+		body := make(chan string, 1)
+		h.HtmlDoWithTimeout("p", 10*time.Millisecond, func(ctx context.Context, el *HtmlElement) {
+			if el.Request.URL.Path != "/a" {
+				return
+			}
+
+			// Keep using the response after the callback timed out.
+			<-unblock
+			b, _ := io.ReadAll(el.Response.Body)
+			body <- string(b)
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/a"))
+		assert.NoError(t, h.Visit(server.URL+"/b"))
+		close(unblock)
+
+		assert.Equal(t, pages["/a"], <-body)
+	})
+}
+
+func TestHarvester_DelayFunc(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var delayed []string
+	h := newTestHarvester(WithDelayFunc(func(req *Request) time.Duration {
+		delayed = append(delayed, req.URL.Path)
+		if req.URL.Path == "/faq" {
+			return 20 * time.Millisecond
+		}
+		return 0
+	}))
+
+	start := time.Now()
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.NoError(t, h.Visit(server.URL+"/user_agent"))
+	assert.Equal(t, []string{"/faq", "/user_agent"}, delayed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	h = newTestHarvester(WithContext(ctx), WithIgnoreRobots(true), WithDelayFunc(func(*Request) time.Duration {
+		return time.Hour
+	}))
+
+	assert.ErrorIs(t, h.Visit(server.URL+"/faq"), context.Canceled)
+}
+
+func TestHarvester_InitialDelay(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithInitialDelay(time.Hour))
+	delay := h.initialDelay.next("example.com")
+	assert.Less(t, delay, time.Hour)
+	assert.Zero(t, h.initialDelay.next("example.com"), "only the first request to a host is delayed")
+
+	h = newTestHarvester(WithInitialDelay(50 * time.Millisecond))
+
+	start := time.Now()
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+	assert.NoError(t, h.Visit(server.URL+"/user_agent"))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, h.initialDelay.started, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	h = newTestHarvester(WithContext(ctx), WithInitialDelay(time.Hour))
+
+	start = time.Now()
+	assert.ErrorIs(t, h.Visit(server.URL+"/faq"), context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestHarvester_RefererPolicy(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	policies := map[string]string{
+		RefererPolicyNoReferrer:                  "",
+		RefererPolicyOrigin:                      server.URL + "/",
+		RefererPolicyStrictOriginWhenCrossOrigin: server.URL + "/faq",
+	}
+
+	for policy, expected := range policies {
+		h := newTestHarvester(WithRefererPolicy(policy))
+
+		var referer string
+		h.ResponseDo(func(res *Response) {
+			if res.Request.URL.Path == "/faq" {
+				res.Request.Visit(server.URL + "/referer")
+				return
+			}
+
+			b, _ := io.ReadAll(res.Body)
+			referer = string(b)
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/faq"))
+		assert.Equal(t, expected, referer, policy)
+	}
+}
+
+func TestHarvester_TrimURLWhitespace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><a href="  /page1 ">Page 1</a><a href="	 #section ">Section</a></body></html>`))
+	}))
+	defer server.Close()
+
+	for _, enabled := range []bool{true, false} {
+		h := newTestHarvester(WithIgnoreRobots(true), WithTrimURLWhitespace(enabled))
+
+		var links []string
+		h.HtmlDo("a[href]", func(el *HtmlElement) {
+			links = append(links, el.Request.GetAbsoluteURL(el.Attribute("href")))
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/"))
+
+		if enabled {
+			assert.Equal(t, []string{server.URL + "/page1", ""}, links)
+		} else {
+			assert.NotEqual(t, server.URL+"/page1", links[0])
+		}
+	}
+}
+
+func TestHarvester_BeforeVisit(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithDisallowedURLs([]string{server.URL + "/faq"}))
+
+	errPrivate := fmt.Errorf("private page")
+	h.BeforeVisit(func(u *url.URL) error {
+		if u.Path == "/allowed" {
+			return errPrivate
+		}
+		return nil
+	})
+
+	var filtered []string
+	h.OnFiltered(func(u *url.URL, err error) {
+		filtered = append(filtered, u.Path)
+	})
+
+	requested := 0
+	h.RequestDo(func(req *Request) {
+		requested++
+	})
+
+	err := h.Visit(server.URL + "/allowed")
+	assert.ErrorIs(t, err, errPrivate)
+	assert.EqualError(t, err, fmt.Sprintf("URL %s/allowed was vetoed: private page", server.URL))
+
+	assert.Error(t, h.Visit(server.URL+"/faq"))
+	assert.NoError(t, h.Visit(server.URL+"/"))
+
+	assert.Equal(t, []string{"/allowed", "/faq"}, filtered)
+	assert.Equal(t, 1, requested)
+}
+
+func TestHarvester_DepthOf(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithDepthLimit(3))
+
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		absURL := el.Request.GetAbsoluteURL(el.Attribute("href"))
+		if strings.HasPrefix(absURL, server.URL) {
+			el.Request.Visit(absURL)
+		}
+	})
+
+	h.ResponseDo(func(res *Response) {
+		if res.Request.URL.Path == "/" {
+			res.Request.Visit(server.URL + "/user_agent")
+		}
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+
+	depth, ok := h.DepthOf(server.URL + "/faq")
+	assert.True(t, ok)
+	assert.Equal(t, 0, depth)
+
+	depth, ok = h.DepthOf(server.URL + "/about")
+	assert.True(t, ok)
+	assert.Equal(t, 1, depth)
+
+	depth, ok = h.DepthOf(server.URL + "/user_agent")
+	assert.True(t, ok)
+	assert.Equal(t, 2, depth)
+
+	_, ok = h.DepthOf(server.URL + "/never")
+	assert.False(t, ok)
+}
+
+func TestHarvester_ResumableDownloads(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	drops := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", `"v1"`)
+
+		if r.Header.Get("Range") != "" {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			return
+		}
+
+		// Send half of the body and drop the connection.
+		drops++
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(content[:len(content)/2])
+		w.(http.Flusher).Flush()
+
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+	assert.Error(t, h.Visit(server.URL+"/"))
+
+	h = newTestHarvester(WithIgnoreRobots(true), WithResumableDownloads(true))
+
+	var body []byte
+	h.ResponseDo(func(res *Response) {
+		body, _ = io.ReadAll(res.Body)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, content, body)
+	assert.Equal(t, 2, drops)
+
+	t.Run("Backend", func(t *testing.T) {
+		var ranges []string
+		backend := backendFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			ranges = append(ranges, req.Headers.Get("Range"))
+			return NewHTTPBackend(http.DefaultClient).Do(ctx, req)
+		})
+
+		h := newTestHarvester(WithIgnoreRobots(true), WithResumableDownloads(true), WithBackend(backend))
+
+		var body []byte
+		h.ResponseDo(func(res *Response) {
+			body, _ = io.ReadAll(res.Body)
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/"))
+		assert.Equal(t, content, body)
+		assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}, ranges)
+	})
+
+	t.Run("Budget", func(t *testing.T) {
+		h := newTestHarvester(WithIgnoreRobots(true), WithResumableDownloads(true), WithBufferPool(true),
+			WithMaxTotalBytes(int64(len(content)*3/4)), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+		var body []byte
+		var truncated bool
+		h.ResponseDo(func(res *Response) {
+			body, _ = io.ReadAll(res.Body)
+			truncated = res.Truncated
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/"))
+		assert.Equal(t, content[:len(content)*3/4], body)
+		assert.True(t, truncated)
+		assert.Equal(t, int64(len(content)*3/4), h.Stats().BudgetUsed)
+		assert.Equal(t, int64(1), h.Stats().TruncatedBodies)
+	})
+}
+
+func TestHarvester_Logger(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	h := newTestHarvester(WithLogger(logger))
+
+	h.ResponseDo(func(res *Response) {
+		res.Body = iotest.ErrReader(fmt.Errorf("broken body"))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+
+	assert.Contains(t, buf.String(), `"msg":"error parsing response body"`)
+	assert.Contains(t, buf.String(), fmt.Sprintf(`"url":"%s/"`, server.URL))
+	assert.Contains(t, buf.String(), `"error":"broken body"`)
+}
+
+func TestHarvester_CrawlTree(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithDepthLimit(3))
+
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		absURL := el.Request.GetAbsoluteURL(el.Attribute("href"))
+		if strings.HasPrefix(absURL, server.URL) {
+			el.Request.Visit(absURL)
+		}
+	})
+
+	h.ResponseDo(func(res *Response) {
+		if res.Request.URL.Path == "/" {
+			res.Request.Visit(server.URL + "/user_agent")
+		}
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+
+	parent, ok := h.ParentOf(server.URL + "/user_agent")
+	assert.True(t, ok)
+	assert.Equal(t, server.URL+"/", parent)
+
+	_, ok = h.ParentOf(server.URL + "/faq")
+	assert.False(t, ok)
+
+	assert.Equal(t, map[string]string{
+		server.URL + "/":           server.URL + "/faq",
+		server.URL + "/about":      server.URL + "/faq",
+		server.URL + "/contact":    server.URL + "/faq",
+		server.URL + "/user_agent": server.URL + "/",
+	}, h.CrawlTree())
+}
+
+func TestHarvester_VisitWithDepth(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithDepthLimit(1), WithAllowRevisit(true))
+
+	reqCount := 0
+	h.ResponseDo(func(resp *Response) {
+		reqCount++
+		if reqCount >= 10 {
+			return
+		}
+		resp.Request.Visit(server.URL + "/") // resp.Request.Visit increments the depth
+	})
+
+	assert.NoError(t, h.VisitWithDepth(server.URL+"/", 3))
+	assert.Equal(t, 3, reqCount)
+
+	reqCount = 0
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, 1, reqCount)
+
+	reqCount = 0
+	assert.NoError(t, h.VisitWithDepth(server.URL+"/", 0))
+	assert.Equal(t, 10, reqCount)
+}
+
+func TestHarvester_MetricsDo(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	var metrics []FetchMetric
+	h.MetricsDo(func(m FetchMetric) {
+		metrics = append(metrics, m)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+	assert.Error(t, h.Visit("http://127.0.0.1:1/unreachable"))
+	assert.Error(t, h.Visit(server.URL+"/")) // Already visited, not fetched
+
+	assert.Len(t, metrics, 3)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	assert.Equal(t, host, metrics[0].Host)
+	assert.Equal(t, http.StatusOK, metrics[0].StatusCode)
+	assert.Equal(t, int64(len(helloBytes)), metrics[0].Bytes)
+	assert.Equal(t, 0, metrics[0].Depth)
+	assert.Greater(t, metrics[0].Duration, time.Duration(0))
+	assert.NoError(t, metrics[0].Err)
+
+	assert.Equal(t, http.StatusNotFound, metrics[1].StatusCode)
+
+	assert.Equal(t, "127.0.0.1:1", metrics[2].Host)
+	assert.Equal(t, 0, metrics[2].StatusCode)
+	assert.Error(t, metrics[2].Err)
+}
+
+func TestHarvester_BaseHref(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester()
+
+	var links []string
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		links = append(links, el.Request.GetAbsoluteURL(el.Attribute("href")))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/base_href"))
+	assert.Equal(t, []string{
+		"https://other.example.com/path/page1",
+		"https://other.example.com/page2",
+		"https://other.example.com/page3",
+	}, links)
+
+	links = nil
+	assert.NoError(t, h.Visit(server.URL+"/relative_links"))
+	assert.Equal(t, server.URL+"/page1", links[0])
+}
+
+func TestHarvester_CollapseWWW(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	// Resolve every host to the test server, so that www.example.com and example.com both reach it.
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, serverURL.Host)
+			},
+		},
+	}
+
+	for _, collapse := range []bool{true, false} {
+		h := NewHarvester(WithClient(client), WithIgnoreRobots(true), WithCollapseWWW(collapse))
+
+		assert.NoError(t, h.Visit("http://www.example.com/"))
+
+		err := h.Visit("http://example.com/")
+		if collapse {
+			assert.EqualError(t, err, "URL http://example.com/ has already been visited")
+		} else {
+			assert.NoError(t, err)
+		}
+
+		_, ok := h.DepthOf("http://example.com/")
+		assert.True(t, ok)
+	}
+}
+
+func TestHarvester_SlowRequestThreshold(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var slow []string
+	h := newTestHarvester(WithSlowRequestThreshold(time.Second, func(req *Request, elapsed time.Duration) {
+		slow = append(slow, req.URL.Path)
+
+		assert.Equal(t, 0, req.Depth)
+		assert.GreaterOrEqual(t, elapsed, time.Second)
+	}))
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Empty(t, slow)
+
+	assert.NoError(t, h.Visit(server.URL+"/heavyweight"))
+	assert.Equal(t, []string{"/heavyweight"}, slow)
+}
+
+func TestHarvester_WithURLValues(t *testing.T) {
+	allowed, _ := url.Parse("https://example.com/docs")
+	disallowed, _ := url.Parse("https://example.com/docs/private")
+
+	h := newTestHarvester(
+		WithAllowedURLValues([]*url.URL{allowed}),
+		WithDisallowedURLValues([]*url.URL{disallowed}),
+	)
+
+	assert.Equal(t, []string{"https://example.com/docs"}, h.AllowedURLs)
+	assert.Equal(t, []string{"https://example.com/docs/private"}, h.DisallowedURLs)
+	assert.True(t, h.isURLAllowed("https://example.com/docs/intro"))
+	assert.False(t, h.isURLAllowed("https://example.com/docs/private/keys"))
+}
+
+func TestHarvester_Stub(t *testing.T) {
+	stubHeaders := http.Header{"Content-Type": []string{"text/html"}}
+
+	h := newTestHarvester(
+		WithStub("https://stubbed.example/", http.StatusOK, []byte(`<a href="/products/1">Product</a>`), stubHeaders),
+		WithStub("https://stubbed.example/products/*", http.StatusNotFound, []byte("gone"), nil),
+	)
+
+	var statuses []int
+	h.ResponseDo(func(res *Response) {
+		statuses = append(statuses, res.StatusCode)
+		if res.StatusCode == http.StatusOK {
+			assert.Equal(t, "text/html", res.Headers.Get("Content-Type"))
+		}
+	})
+
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		el.Request.Visit(el.Request.GetAbsoluteURL(el.Attribute("href")))
+	})
+
+	assert.NoError(t, h.Visit("https://stubbed.example/"))
+	assert.Equal(t, []int{http.StatusOK, http.StatusNotFound}, statuses)
+	assert.Equal(t, int64(2), h.Stats().RequestsSucceeded)
+}
+
+func TestHarvester_HTTPTrace(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithHTTPTrace(true))
+
+	var traces []*Trace
+	h.ResponseDo(func(res *Response) {
+		traces = append(traces, res.Trace)
+	})
+
+	var metricTraces []*Trace
+	h.MetricsDo(func(m FetchMetric) {
+		metricTraces = append(metricTraces, m.Trace)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.NoError(t, h.Visit(server.URL+"/allowed"))
+
+	assert.Len(t, traces, 2)
+	assert.Greater(t, traces[0].TimeToFirstByte, time.Duration(0))
+	assert.Greater(t, traces[0].ConnectDuration, time.Duration(0))
+	assert.GreaterOrEqual(t, traces[0].TotalDuration, traces[0].TimeToFirstByte)
+	assert.False(t, traces[0].ConnReused)
+	assert.True(t, traces[1].ConnReused)
+	assert.Equal(t, traces, metricTraces)
+
+	h = newTestHarvester(WithIgnoreRobots(true))
+	h.ResponseDo(func(res *Response) {
+		assert.Nil(t, res.Trace)
+	})
+	assert.NoError(t, h.Visit(server.URL+"/"))
+}
+
+func TestHarvester_OnRobotsDisallowed(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithDisallowedURLs([]string{server.URL + "/faq"}))
+
+	var disallowed, forbidden []string
+	h.OnRobotsDisallowed(func(u string) {
+		disallowed = append(disallowed, u)
+	})
+	h.OnForbiddenURL(func(u string) {
+		forbidden = append(forbidden, u)
+	})
+
+	assert.Error(t, h.Visit(server.URL+"/disallowed"))
+	assert.Error(t, h.Visit(server.URL+"/faq"))
+	assert.Error(t, h.Visit("http://127.0.0.1:1/unreachable"))
+	assert.NoError(t, h.Visit(server.URL+"/"))
+
+	assert.Equal(t, []string{server.URL + "/disallowed"}, disallowed)
+	assert.Equal(t, []string{server.URL + "/faq"}, forbidden)
+}
+
+func TestHarvester_LinkGraphExport(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithLinkGraph(true), WithAllowedURLs([]string{server.URL + "/faq"}))
+
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		el.Visit(el.Attribute("href"))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+
+	faq := server.URL + "/faq"
+	assert.Equal(t, []Edge{
+		{From: faq, To: server.URL + "/", AnchorText: "Home"},
+		{From: faq, To: server.URL + "/about", AnchorText: "About Us"},
+		{From: faq, To: server.URL + "/contact", AnchorText: "Contact"},
+		{From: faq, To: faq, AnchorText: "FAQ Section 2"},
+		{From: faq, To: "https://external.com/resource", AnchorText: "External Resource"},
+	}, h.Graph().Edges())
+
+	var dot bytes.Buffer
+	assert.NoError(t, h.Graph().WriteDOT(&dot))
+	assert.True(t, strings.HasPrefix(dot.String(), "digraph grawlr {\n"))
+	assert.Contains(t, dot.String(), fmt.Sprintf("\t%q -> %q [label=\"Home\"];\n", faq, server.URL+"/"))
+	assert.Contains(t, dot.String(), fmt.Sprintf("\t%q -> \"https://external.com/resource\" [label=\"External Resource\"];\n", faq))
+
+	var edges []Edge
+	var js bytes.Buffer
+	assert.NoError(t, h.Graph().WriteJSON(&js))
+	assert.NoError(t, json.Unmarshal(js.Bytes(), &edges))
+	assert.Equal(t, h.Graph().Edges(), edges)
+
+	limited := newTestHarvester(WithLinkGraphLimit(2), WithAllowedURLs([]string{server.URL + "/faq"}))
+	limited.HtmlDo("a[href]", func(el *HtmlElement) {
+		el.Visit(el.Attribute("href"))
+	})
+
+	assert.NoError(t, limited.Visit(server.URL+"/faq"))
+	assert.Equal(t, 2, limited.Graph().Len())
+	assert.Equal(t, 3, limited.Graph().Dropped())
+
+	t.Run("Redirect", func(t *testing.T) {
+		h := NewHarvester(WithLinkGraph(true), WithIgnoreRobots(true), WithAllowedURLs([]string{server.URL + "/moved_links"}))
+
+		h.HtmlDo("a[href]", func(el *HtmlElement) {
+			el.Visit(el.Attribute("href"))
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/moved_links"))
+
+		page := server.URL + "/nofollow_links"
+		assert.Equal(t, []Edge{
+			{From: page, To: server.URL + "/about", AnchorText: "About Us"},
+			{From: page, To: "https://external.com/resource", AnchorText: "External Resource", NoFollow: true},
+		}, h.Graph().Edges())
+
+		var dot bytes.Buffer
+		assert.NoError(t, h.Graph().WriteDOT(&dot))
+		assert.Contains(t, dot.String(), fmt.Sprintf("\t%q -> \"https://external.com/resource\" [label=\"External Resource\", style=dashed];\n", page))
+	})
+}
+
+func TestHarvester_OnRevisit(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithAllowRevisit(true))
+
+	var counts []int
+	h.OnRevisit(func(u string, visitCount int) {
+		assert.Equal(t, server.URL+"/", u)
+		counts = append(counts, visitCount)
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, h.Visit(server.URL+"/"))
+	}
+	assert.NoError(t, h.Visit(server.URL+"/allowed"))
+
+	assert.Equal(t, []int{1, 2}, counts)
+}
+
+func TestHarvester_ContentHasher(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var hashes []string
+	collect := func(res *Response) {
+		hashes = append(hashes, res.ContentHash())
+	}
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+	h.ResponseDo(collect)
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, []string{FNVContentHasher(helloBytes)}, hashes)
+
+	hashes = nil
+	h = newTestHarvester(WithIgnoreRobots(true), WithContentHasher(func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}))
+	h.ResponseDo(collect)
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	sum := sha256.Sum256(helloBytes)
+	assert.Equal(t, []string{hex.EncodeToString(sum[:])}, hashes)
+}
+
+func TestHarvester_BrokenLinkReport(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	for _, checkExternal := range []bool{false, true} {
+		h := newTestHarvester(
+			WithLinkGraph(true),
+			WithCheckExternalLinks(checkExternal),
+			WithAllowedURLs([]string{server.URL}),
+		)
+
+		h.HtmlDo("a[href]", func(el *HtmlElement) {
+			el.Visit(el.Attribute("href"))
+		})
+
+		h.ResponseDo(func(res *Response) {
+			if res.Request.URL.Path == "/" {
+				res.Request.Visit(server.URL + "/404")
+			}
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/broken_links"))
+
+		report := h.BrokenLinkReport()
+
+		missing := BrokenLink{
+			URL:         server.URL + "/404",
+			StatusCode:  http.StatusNotFound,
+			Referrers:   []string{server.URL + "/", server.URL + "/broken_links"},
+			AnchorTexts: []string{"Missing page"},
+		}
+
+		if !checkExternal {
+			assert.Equal(t, []BrokenLink{missing}, report)
+			continue
+		}
+
+		assert.Len(t, report, 2)
+		assert.Equal(t, "http://127.0.0.1:1/dead", report[0].URL)
+		assert.NotEmpty(t, report[0].Error)
+		assert.Equal(t, []string{server.URL + "/broken_links"}, report[0].Referrers)
+		assert.Equal(t, []string{"Dead external"}, report[0].AnchorTexts)
+		assert.Equal(t, missing, report[1])
+	}
+
+	assert.Nil(t, newTestHarvester().BrokenLinkReport())
+}
+
+func TestHarvester_SeedDeny(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester()
+
+	err := h.Seed([]string{server.URL}).Deny([]string{server.URL + "/faq"}).Visit(server.URL + "/")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{server.URL}, h.AllowedURLs)
+	assert.Equal(t, []string{server.URL + "/faq"}, h.DisallowedURLs)
+
+	url := server.URL + "/faq"
+	assert.EqualError(t, h.Visit(url), fmt.Sprintf("URL %s is forbidden", url))
+}
+
+func TestHarvester_Referrer(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithDepthLimit(3))
+
+	referrers := make(map[string]string)
+	h.ResponseDo(func(res *Response) {
+		referrer := ""
+		if res.Request.Referrer != nil {
+			referrer = res.Request.Referrer.String()
+		}
+		referrers[res.Request.URL.Path] = referrer
+
+		if res.Request.URL.Path == "/" {
+			res.Visit(server.URL + "/user_agent")
+		}
+	})
+
+	h.HtmlDo(`a[href="/"]`, func(el *HtmlElement) {
+		el.Visit(el.Attribute("href"))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+
+	assert.Equal(t, map[string]string{
+		"/faq":        "",
+		"/":           server.URL + "/faq",
+		"/user_agent": server.URL + "/",
+	}, referrers)
+}
+
+func TestHarvester_VisitAbsolute(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester()
+
+	var visited []string
+	h.ResponseDo(func(res *Response) {
+		visited = append(visited, res.Request.URL.Path)
+	})
+
+	assert.NoError(t, h.VisitAbsolute(server.URL+"/faq/", "../user_agent#top"))
+	assert.NoError(t, h.VisitAbsolute(server.URL+"/faq", "#section"))
+	assert.NoError(t, h.VisitAbsolute(server.URL+"/faq", ""))
+
+	assert.Equal(t, []string{"/user_agent"}, visited)
+}
+
+func TestRequest_VisitRelative(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithDepthLimit(2))
+
+	var visited []string
+	h.ResponseDo(func(res *Response) {
+		visited = append(visited, res.Request.URL.Path)
+
+		if res.Request.URL.Path == "/faq" {
+			assert.NoError(t, res.Request.VisitRelative("#top"))
+			assert.NoError(t, res.Request.VisitRelative("user_agent"))
+		}
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+
+	assert.Equal(t, []string{"/faq", "/user_agent"}, visited)
+}
+
+func TestHarvester_FollowJSONPagination(t *testing.T) {
+	next := map[string]string{"": "b", "b": "c", "c": ""}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprintf(w, `{"items": [%q], "meta": {"next": %q}}`, cursor, next[cursor])
+	}))
+	defer server.Close()
+
+	buildURL := func(cursor string) string {
+		return server.URL + "/items?cursor=" + cursor
+	}
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	var cursors []string
+	h.ResponseDo(func(res *Response) {
+		cursors = append(cursors, res.Request.URL.Query().Get("cursor"))
+	})
+	h.FollowJSONPagination("meta.next", buildURL)
+
+	assert.NoError(t, h.Visit(server.URL+"/items"))
+	assert.Equal(t, []string{"", "b", "c"}, cursors)
+
+	h = newTestHarvester(WithIgnoreRobots(true), WithDepthLimit(2))
+	cursors = nil
+	h.ResponseDo(func(res *Response) {
+		cursors = append(cursors, res.Request.URL.Query().Get("cursor"))
+	})
+	h.FollowJSONPagination("meta.next", buildURL)
+
+	assert.NoError(t, h.Visit(server.URL+"/items"))
+	assert.Equal(t, []string{"", "b"}, cursors)
+
+	h = newTestHarvester(WithIgnoreRobots(true), WithDisallowedURLs([]string{buildURL("c")}))
+	cursors = nil
+	h.ResponseDo(func(res *Response) {
+		cursors = append(cursors, res.Request.URL.Query().Get("cursor"))
+	})
+	h.FollowJSONPagination("meta.next", buildURL)
+
+	assert.NoError(t, h.Visit(server.URL+"/items"))
+	assert.Equal(t, []string{"", "b"}, cursors)
+}
+
+func TestHarvester_FollowJSONLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/items" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"items": [
+				{"url": "/api/items/1"},
+				{"url": "items/2"},
+				{"url": "http://other.example/items/3"},
+				{"url": 4},
+				{"name": "no url"}
+			]}`)
+			return
+		}
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithAllowedURLs([]string{server.URL}))
+
+	var visited []string
+	h.ResponseDo(func(res *Response) {
+		visited = append(visited, res.Request.URL.Path)
+	})
+	h.FollowJSONLinks("items[*].url")
+
+	assert.NoError(t, h.Visit(server.URL+"/api/items"))
+	assert.Equal(t, []string{"/api/items", "/api/items/1", "/api/items/2"}, visited)
+}
+
+func TestSelectJSONPath(t *testing.T) {
+	var v any
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"items": [{"url": "a", "tags": ["x", "y"]}, {"url": "b", "tags": ["z"]}],
+		"next": "c"
+	}`), &v))
+
+	tests := []struct {
+		path string
+		want []any
+	}{
+		{"next", []any{"c"}},
+		{"$.next", []any{"c"}},
+		{"items[*].url", []any{"a", "b"}},
+		{"items[1].url", []any{"b"}},
+		{"items[5].url", nil},
+		{"items[*].tags[*]", []any{"x", "y", "z"}},
+		{"items[*].missing", nil},
+		{"next[*]", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := parseJSONPath(tt.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, selectJSONPath(v, path))
+		})
+	}
+
+	var arr any
+	assert.NoError(t, json.Unmarshal([]byte(`[["a"], ["b", "c"]]`), &arr))
+	path, err := parseJSONPath("[*][0]")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"a", "b"}, selectJSONPath(arr, path))
+
+	for _, invalid := range []string{"items[*", "items[x]", "items[-1]", "items..url", "items[0]x"} {
+		_, err := parseJSONPath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestHarvester_RobotsRateLimited(t *testing.T) {
+	robotsRequests := 0
+	rateLimited := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			robotsRequests++
+			if rateLimited {
+				w.Header().Set("Retry-After", "120")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte("User-agent: *\nDisallow: /disallowed"))
+			return
+		}
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithAllowRevisit(true))
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	assert.NoError(t, h.Visit(server.URL+"/disallowed"))
+	assert.NoError(t, h.Visit(server.URL+"/disallowed"))
+	assert.Equal(t, 1, robotsRequests)
+
+	backoff := h.robotsBackoffs[host]
+	assert.Equal(t, 120*time.Second, backoff.delay)
+
+	// The next retry doubles the delay when Retry-After asks for less.
+	backoff.next = time.Now()
+	assert.NoError(t, h.Visit(server.URL+"/disallowed"))
+	assert.Equal(t, 2, robotsRequests)
+	assert.Equal(t, 240*time.Second, h.robotsBackoffs[host].delay)
+
+	rateLimited = false
+	h.robotsBackoffs[host].next = time.Now()
+
+	assert.Error(t, h.Visit(server.URL+"/disallowed"))
+	assert.Error(t, h.Visit(server.URL+"/disallowed"))
+	assert.Equal(t, 3, robotsRequests)
+	assert.Empty(t, h.robotsBackoffs)
+
+	rateLimited = true
+	h = newTestHarvester(WithDisallowOnRobotsRateLimit(true))
+
+	assert.Error(t, h.Visit(server.URL+"/"))
+}
+
+// countingRoundTripper is an http.RoundTripper counting the requests it sends by path.
+type countingRoundTripper struct {
+	paths []string
+	lock  sync.Mutex
+}
+
+func (rt *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.lock.Lock()
+	rt.paths = append(rt.paths, req.URL.Path)
+	rt.lock.Unlock()
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHarvester_WithTransport(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	rt := &countingRoundTripper{}
+	h := NewHarvester(WithTransport(rt), WithClient(client))
+
+	assert.NoError(t, h.Visit(server.URL+"/html"))
+	assert.Equal(t, []string{"/robots.txt", "/html"}, rt.paths)
+	assert.Nil(t, client.Transport, "the provided client is not modified")
+	assert.Equal(t, 10*time.Second, h.Client.Timeout)
+	assert.NotNil(t, h.Client.CheckRedirect)
+
+	h = NewHarvester(WithTransport(rt))
+	assert.Same(t, rt, h.Client.Transport)
+	assert.Nil(t, http.DefaultClient.Transport, "http.DefaultClient is not modified")
+}
+
+func TestHarvester_RobotsAgentChain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: GrawlrBot\nDisallow: /bot\n\n" +
+				"User-agent: Grawlr\nDisallow: /grawlr\n\n" +
+				"User-agent: *\nDisallow: /all"))
+			return
+		}
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		agents     []string
+		disallowed []string
+		allowed    []string
+	}{
+		{"Default agent", nil, []string{"/grawlr"}, []string{"/bot", "/all"}},
+		{"Most specific agent", []string{"GrawlrBot/1.0", "Grawlr", "*"}, []string{"/bot"}, []string{"/grawlr", "/all"}},
+		{"Fallback agent", []string{"OtherBot/2.0", "Grawlr", "*"}, []string{"/grawlr"}, []string{"/bot", "/all"}},
+		{"Wildcard group", []string{"OtherBot/2.0"}, []string{"/all"}, []string{"/bot", "/grawlr"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHarvester(WithRobotsAgentChain(tt.agents))
+
+			for _, path := range tt.disallowed {
+				assert.ErrorContains(t, h.Visit(server.URL+path), "disallowed by robots.txt", path)
+			}
+			for _, path := range tt.allowed {
+				assert.NoError(t, h.Visit(server.URL+path), path)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	d, ok := parseRetryAfter("30")
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, d)
+
+	d, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour, d, float64(2*time.Second))
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
+
+func TestHarvester_Progress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	var (
+		mu      sync.Mutex
+		reports []Stats
+	)
+	h := newTestHarvester(WithIgnoreRobots(true), WithProgress(5*time.Millisecond, func(s Stats) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		reports = append(reports, s)
+	}))
+
+	h.ResponseDo(func(res *Response) {
+		if res.Request.Depth < 3 {
+			res.Visit(fmt.Sprintf("%s/%d", server.URL, res.Request.Depth+1))
+		}
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/0"))
+
+	mu.Lock()
+	count := len(reports)
+	assert.Greater(t, count, 2)
+	for i := 1; i < count; i++ {
+		assert.GreaterOrEqual(t, reports[i].RequestsAttempted, reports[i-1].RequestsAttempted)
+	}
+
+	final := reports[count-1]
+	assert.Equal(t, int64(4), final.RequestsSucceeded)
+	assert.Equal(t, int64(0), final.InFlight)
+	mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	assert.Len(t, reports, count)
+	mu.Unlock()
+
+	t.Run("VisitFromFinalReport", func(t *testing.T) {
+		var h *Harvester
+		var final atomic.Int32
+		h = newTestHarvester(WithIgnoreRobots(true), WithProgress(time.Hour, func(s Stats) {
+			if final.Add(1) == 1 {
+				assert.NoError(t, h.Visit(server.URL+"/next"))
+			}
+		}))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			assert.NoError(t, h.Visit(server.URL+"/first"))
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Visit from the final progress report deadlocked")
+		}
+		assert.Equal(t, int32(2), final.Load())
+	})
+}
+
+func TestHarvester_MaxInFlightBytes(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	t.Run("Callbacks", func(t *testing.T) {
+		h := newTestHarvester(WithMaxInFlightBytes(1))
+
+		holding := make(chan struct{})
+		proceed := make(chan struct{})
+		var (
+			mu      sync.Mutex
+			visited []string
+		)
+		h.ResponseDo(func(res *Response) {
+			mu.Lock()
+			visited = append(visited, res.Request.URL.Path)
+			mu.Unlock()
+
+			if res.Request.URL.Path == "/faq" {
+				close(holding)
+				<-proceed
+			}
+		})
+
+		done := make(chan error)
+		go func() {
+			done <- h.Visit(server.URL + "/faq")
+		}()
+		<-holding
+
+		second := make(chan error)
+		go func() {
+			second <- h.Visit(server.URL + "/user_agent")
+		}()
+
+		select {
+		case <-second:
+			t.Fatal("Visit did not wait for the in-flight bytes to be released")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(proceed)
+		assert.NoError(t, <-done)
+		assert.NoError(t, <-second)
+		assert.Equal(t, []string{"/faq", "/user_agent"}, visited)
+	})
+
+	t.Run("Reading", func(t *testing.T) {
+		unblock := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+
+			w.Write([]byte("<html><body>"))
+			w.(http.Flusher).Flush()
+			<-unblock
+			w.Write([]byte("</body></html>"))
+		}))
+		defer slow.Close()
+
+		h := newTestHarvester(WithMaxInFlightBytes(1))
+
+		done := make(chan error)
+		go func() {
+			done <- h.Visit(slow.URL)
+		}()
+		assert.Eventually(t, func() bool {
+			h.inFlightBytes.lock.Lock()
+			defer h.inFlightBytes.lock.Unlock()
+			return h.inFlightBytes.used > 0
+		}, time.Second, time.Millisecond)
+
+		second := make(chan error)
+		go func() {
+			second <- h.Visit(server.URL + "/user_agent")
+		}()
+
+		select {
+		case <-second:
+			t.Fatal("Visit did not wait for the bytes of the body being read")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(unblock)
+		assert.NoError(t, <-done)
+		assert.NoError(t, <-second)
+	})
+
+	t.Run("Followed links", func(t *testing.T) {
+		h := newTestHarvester(WithMaxInFlightBytes(1), WithDepthLimit(2))
+		other := h.inFlightBytes.hold()
+
+		holding := make(chan struct{})
+		var (
+			mu      sync.Mutex
+			visited []string
+		)
+		h.ResponseDo(func(res *Response) {
+			mu.Lock()
+			visited = append(visited, res.Request.URL.Path)
+			mu.Unlock()
+
+			if res.Request.URL.Path == "/faq" {
+				// The link waits for the bytes of the other fetch, not for those of its own page.
+				other.add(1)
+				close(holding)
+				assert.NoError(t, res.Visit(server.URL+"/"))
+			}
+		})
+
+		done := make(chan error)
+		go func() {
+			done <- h.Visit(server.URL + "/faq")
+		}()
+		<-holding
+
+		select {
+		case <-done:
+			t.Fatal("followed link did not wait for the in-flight bytes to be released")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		other.release()
+		assert.NoError(t, <-done)
+		assert.Equal(t, []string{"/faq", "/"}, visited)
+		assert.Zero(t, h.inFlightBytes.used)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		h := newTestHarvester(WithContext(ctx), WithMaxInFlightBytes(1))
+		h.inFlightBytes.hold().add(1)
+		cancel()
+
+		assert.ErrorIs(t, h.Visit(server.URL+"/"), context.Canceled)
+	})
+}
+
+func TestHarvester_GraphQL(t *testing.T) {
+	var queries []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		queries = append(queries, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": {"items": {"pageInfo": {"endCursor": "next"}}}}`)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	var responses int
+	h.ResponseDo(func(res *Response) {
+		responses++
+	})
+
+	query := `query($after: String) { items(after: $after) { pageInfo { endCursor } } }`
+
+	res, err := h.GraphQL(server.URL+"/graphql", query, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, http.MethodPost, res.Request.Method)
+
+	var data struct {
+		Data struct {
+			Items struct {
+				PageInfo struct {
+					EndCursor string
+				}
+			}
+		}
+	}
+	body, _ := io.ReadAll(res.Body)
+	assert.NoError(t, json.Unmarshal(body, &data))
+	assert.Equal(t, "next", data.Data.Items.PageInfo.EndCursor)
+
+	_, err = h.GraphQL(server.URL+"/graphql", query, map[string]any{"after": "next"})
+	assert.NoError(t, err)
+
+	_, err = h.GraphQL(server.URL+"/graphql", query, map[string]any{"after": "next"})
+	assert.ErrorContains(t, err, "has already been visited")
+
+	assert.Equal(t, 2, responses)
+	assert.Equal(t, []map[string]any{
+		{"query": query},
+		{"query": query, "variables": map[string]any{"after": "next"}},
+	}, queries)
+}
+
+func TestHarvester_HostStats(t *testing.T) {
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(helloBytes)
+	}))
+	defer fast.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		w.Write(helloBytes)
+	}))
+	defer slow.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+	for i := range 4 {
+		assert.NoError(t, h.Visit(fmt.Sprintf("%s/%d", fast.URL, i)))
+	}
+	assert.NoError(t, h.Visit(fast.URL+"/error"))
+	assert.NoError(t, h.Visit(slow.URL+"/0"))
+	assert.NoError(t, h.Visit(slow.URL+"/1"))
+
+	hosts := h.HostStats()
+	fastStats := hosts[strings.TrimPrefix(fast.URL, "http://")]
+	slowStats := hosts[strings.TrimPrefix(slow.URL, "http://")]
+
+	assert.Equal(t, int64(5), fastStats.Requests)
+	assert.Equal(t, int64(1), fastStats.Errors)
+	assert.Equal(t, int64(4*len(helloBytes)), fastStats.Bytes)
+	assert.Less(t, fastStats.LatencyP50, 50*time.Millisecond)
+
+	assert.Equal(t, int64(2), slowStats.Requests)
+	assert.Equal(t, int64(0), slowStats.Errors)
+	assert.GreaterOrEqual(t, slowStats.LatencyP50, 60*time.Millisecond)
+	assert.GreaterOrEqual(t, slowStats.LatencyP95, slowStats.LatencyP50)
+
+	assert.Nil(t, h.Stats().Hosts)
+
+	h = newTestHarvester(WithIgnoreRobots(true), WithHostStats(true))
+	assert.NoError(t, h.Visit(fast.URL+"/"))
+	assert.Equal(t, h.HostStats(), h.Stats().Hosts)
+	assert.Len(t, h.Stats().Hosts, 1)
+}
+
+func TestHarvester_OnDuplicate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a", "/b":
+			http.Redirect(w, r, "/target", http.StatusMovedPermanently)
+		default:
+			fmt.Fprint(w, `<html><body><a href="/next">Next</a></body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	h := NewHarvester(WithIgnoreRobots(true), WithClient(&http.Client{Timeout: 10 * time.Second}))
+
+	var links []string
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		links = append(links, el.Request.URL.Path)
+	})
+
+	var duplicates [][2]string
+	h.OnDuplicate(func(u, finalURL string) {
+		duplicates = append(duplicates, [2]string{u, finalURL})
+	})
+
+	var responses int
+	h.ResponseDo(func(res *Response) {
+		responses++
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/a"))
+	assert.NoError(t, h.Visit(server.URL+"/b"))
+
+	assert.Equal(t, 2, responses)
+	assert.Equal(t, []string{"/a"}, links)
+	assert.Equal(t, [][2]string{{server.URL + "/b", server.URL + "/target"}}, duplicates)
+
+	url := server.URL + "/target"
+	assert.EqualError(t, h.Visit(url), fmt.Sprintf("URL %s has already been visited", url))
+}
+
+func TestHarvester_OnFirstResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><meta name="csrf-token" content="token-%s"></head></html>`, r.URL.Path)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	var calls atomic.Int32
+	var token string
+	h.OnFirstResponse(func(res *Response) {
+		calls.Add(1)
+		b, _ := io.ReadAll(res.Body)
+		token = string(b)
+	})
+
+	var tokens sync.Map
+	h.HtmlDo(`meta[name="csrf-token"]`, func(el *HtmlElement) {
+		tokens.Store(el.Request.URL.Path, el.Attribute("content"))
+	})
+
+	// Unsuccessful responses are not the first response.
+	assert.NoError(t, h.Visit(server.URL+"/missing"))
+	assert.Equal(t, int32(0), calls.Load())
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, h.Visit(fmt.Sprintf("%s/page%d", server.URL, i)))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Contains(t, token, `content="token-/page`)
+
+	// The Html middlewares of the first response read its body from the start.
+	n := 0
+	tokens.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	assert.Equal(t, 10, n)
+}
+
+func TestHarvester_VisitedStatusCodes(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester()
+
+	var statuses []int
+	h.ResponseDo(func(res *Response) {
+		statuses = append(statuses, res.StatusCode)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/error"))
+	assert.NoError(t, h.Visit(server.URL+"/error"))
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+	assert.Error(t, h.Visit(server.URL+"/404"))
+	assert.Equal(t, []int{500, 500, 404}, statuses)
+
+	_, visited := h.DepthOf(server.URL + "/error")
+	assert.False(t, visited)
+
+	h = newTestHarvester(WithVisitedStatusCodes(func(code int) bool {
+		return code < http.StatusBadRequest
+	}))
+
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+	assert.NoError(t, h.Visit(server.URL+"/404"))
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Error(t, h.Visit(server.URL+"/"))
 }
@@ -0,0 +1,31 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// ContentHasher is a type for functions that hash response bodies.
+type ContentHasher func(b []byte) string
+
+// FNVContentHasher is a ContentHasher returning the hex encoded 64-bit FNV-1a hash of the body.
+func FNVContentHasher(b []byte) string {
+	h := fnv.New64a()
+	h.Write(b)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,476 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// WithRandomHeaderOrder is a functional option that writes the headers of every request in a random
+// order instead of the fixed order of net/http, which some sites use to fingerprint clients. The Host
+// header is always written first. Requests are sent over HTTP/1.1 only, ignoring ForceAttemptHTTP2 and
+// TLSNextProto of the transport, with the dialers, TLS configuration, keep-alive and compression
+// settings of the transport. Idle connections are reused like with net/http, and responses are
+// decompressed transparently unless the request sets its own Accept-Encoding. Requests sent through a
+// proxy keep the order of net/http. The transport of the client must be an *http.Transport, or every
+// request fails with ErrUnsupportedTransport.
+func WithRandomHeaderOrder(enabled bool) Options {
+	return func(h *Harvester) {
+		h.randomHeaderOrder = enabled
+	}
+}
+
+// headerOrderTransport is an http.RoundTripper writing HTTP/1.1 requests with their headers in a random order.
+type headerOrderTransport struct {
+	next *http.Transport
+	idle map[string][]*headerOrderConn
+	lock *sync.Mutex
+}
+
+// headerOrderConn is a connection of a headerOrderTransport with the reader of its responses.
+type headerOrderConn struct {
+	net.Conn
+	br     *bufio.Reader
+	key    string
+	idleAt time.Time
+}
+
+func newHeaderOrderTransport(next *http.Transport) *headerOrderTransport {
+	return &headerOrderTransport{
+		next: next,
+		idle: make(map[string][]*headerOrderConn),
+		lock: &sync.Mutex{},
+	}
+}
+
+// applyHeaderOrder wraps the transport of the client of the Harvester in a headerOrderTransport.
+func (h *Harvester) applyHeaderOrder() {
+	if !h.randomHeaderOrder {
+		return
+	}
+
+	var transport *http.Transport
+	switch t := h.Client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport)
+	case *http.Transport:
+		transport = t
+	default:
+		h.failTransport(ErrUnsupportedTransport("random header order", t))
+		return
+	}
+
+	client := *h.Client
+	client.Transport = newHeaderOrderTransport(transport)
+	h.Client = &client
+}
+
+// RoundTrip sends the request on an idle connection to its host or a new one, falling back to the
+// wrapped transport for requests sent through a proxy and requests with a scheme other than http and https.
+func (t *headerOrderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return t.next.RoundTrip(req)
+	}
+
+	if t.next.Proxy != nil {
+		proxy, err := t.next.Proxy(req)
+		if err != nil {
+			closeRequestBody(req)
+			return nil, err
+		}
+		if proxy != nil {
+			// Pin the proxy so that the wrapped transport does not choose another one.
+			return t.next.RoundTrip(withProxyOverride(req, proxy))
+		}
+	}
+
+	gzip := !t.next.DisableCompression && req.Method != http.MethodHead &&
+		req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == ""
+	keepAlive := !t.next.DisableKeepAlives && !req.Close
+
+	raw, err := writeShuffledRequest(req, gzip, keepAlive)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := req.Context()
+	key := req.URL.Scheme + "://" + dialAddr(req.URL)
+	for {
+		conn := t.idleConn(key)
+		reused := conn != nil
+		if !reused {
+			if conn, err = t.dial(ctx, req, key); err != nil {
+				return nil, err
+			}
+		}
+
+		res, responded, err := t.exchange(ctx, req, conn, raw, reused, keepAlive)
+		if err != nil {
+			// The server may have closed an idle connection before it got the request.
+			if reused && !responded && ctx.Err() == nil && isIdempotent(req.Method) {
+				continue
+			}
+			return nil, err
+		}
+
+		if gzip && res.Header.Get("Content-Encoding") == "gzip" {
+			res.Header.Del("Content-Encoding")
+			res.Header.Del("Content-Length")
+			res.ContentLength = -1
+			res.Uncompressed = true
+			res.Body = &gzipBody{body: res.Body}
+		}
+
+		return res, nil
+	}
+}
+
+// exchange writes the request to the connection and reads its response, reporting whether any of the
+// response was received.
+func (t *headerOrderTransport) exchange(ctx context.Context, req *http.Request, conn *headerOrderConn, raw []byte, reused, keepAlive bool) (_ *http.Response, responded bool, _ error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.GotConn != nil {
+		info := httptrace.GotConnInfo{Conn: conn.Conn, Reused: reused, WasIdle: reused}
+		if reused {
+			info.IdleTime = time.Since(conn.idleAt)
+		}
+		trace.GotConn(info)
+	}
+
+	_, err := conn.Write(raw)
+	if trace != nil && trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+	}
+	if err != nil {
+		return nil, false, roundTripError(ctx, conn, stop, err)
+	}
+
+	if _, err := conn.br.Peek(1); err != nil {
+		return nil, false, roundTripError(ctx, conn, stop, err)
+	}
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+
+	res, err := http.ReadResponse(conn.br, req)
+	if err != nil {
+		return nil, true, roundTripError(ctx, conn, stop, err)
+	}
+
+	body := &connBody{ReadCloser: res.Body, conn: conn, stop: stop, transport: t, reusable: keepAlive && !res.Close}
+	if res.Body == http.NoBody {
+		body.release(true)
+	} else {
+		res.Body = body
+	}
+
+	return res, true, nil
+}
+
+// idleConn returns an idle connection for the key, or nil if there is none.
+func (t *headerOrderTransport) idleConn(key string) *headerOrderConn {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for conns := t.idle[key]; len(conns) > 0; conns = t.idle[key] {
+		conn := conns[len(conns)-1]
+		t.idle[key] = conns[:len(conns)-1]
+
+		if timeout := t.next.IdleConnTimeout; timeout > 0 && time.Since(conn.idleAt) > timeout {
+			conn.Close()
+			continue
+		}
+		return conn
+	}
+
+	return nil
+}
+
+// putIdle keeps the connection for a later request, or closes it if the host has enough idle connections.
+func (t *headerOrderTransport) putIdle(conn *headerOrderConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	maxIdle := t.next.MaxIdleConnsPerHost
+	if maxIdle == 0 {
+		maxIdle = http.DefaultMaxIdleConnsPerHost
+	}
+	if len(t.idle[conn.key]) >= maxIdle {
+		conn.Close()
+		return
+	}
+
+	conn.idleAt = time.Now()
+	t.idle[conn.key] = append(t.idle[conn.key], conn)
+}
+
+// CloseIdleConnections closes the idle connections of the transport and of the wrapped transport.
+func (t *headerOrderTransport) CloseIdleConnections() {
+	t.lock.Lock()
+	for key, conns := range t.idle {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		delete(t.idle, key)
+	}
+	t.lock.Unlock()
+
+	t.next.CloseIdleConnections()
+}
+
+// dial opens a connection to the host of the request with the dialers and TLS configuration of the wrapped transport.
+func (t *headerOrderTransport) dial(ctx context.Context, req *http.Request, key string) (*headerOrderConn, error) {
+	conn, err := t.dialConn(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &headerOrderConn{Conn: conn, br: bufio.NewReader(conn), key: key}, nil
+}
+
+func (t *headerOrderTransport) dialConn(ctx context.Context, req *http.Request) (net.Conn, error) {
+	addr := dialAddr(req.URL)
+	if req.URL.Scheme == "https" && t.next.DialTLSContext != nil {
+		return t.next.DialTLSContext(ctx, "tcp", addr)
+	}
+
+	dial := t.next.DialContext
+	if dial == nil {
+		dial = defaultDialer.DialContext
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme == "http" {
+		return conn, nil
+	}
+
+	config := &tls.Config{}
+	if t.next.TLSClientConfig != nil {
+		config = t.next.TLSClientConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = req.URL.Hostname()
+	}
+	config.NextProtos = []string{"http/1.1"}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dialAddr returns the host:port address of the URL, with the default port of its scheme if it has none.
+func dialAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// isIdempotent reports whether a request with the method can be sent again after a connection failed.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// writeShuffledRequest returns the HTTP/1.1 wire format of the request with its headers in a random
+// order, closing the body of the request. It asks for a gzip response if gzip is set, and for the
+// connection to be closed after the response unless keepAlive is set.
+func writeShuffledRequest(req *http.Request, gzip, keepAlive bool) ([]byte, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	type field struct {
+		key    string
+		values []string
+	}
+	var fields []field
+	for key, values := range req.Header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Host", "Content-Length", "Transfer-Encoding", "Connection":
+			continue
+		}
+		if !httpguts.ValidHeaderFieldName(key) {
+			return nil, fmt.Errorf("invalid header field name %q", key)
+		}
+		for _, v := range values {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return nil, fmt.Errorf("invalid header field value for %q", key)
+			}
+		}
+		fields = append(fields, field{key, values})
+	}
+	if req.Header.Get("User-Agent") == "" {
+		fields = append(fields, field{"User-Agent", []string{"Go-http-client/1.1"}})
+	}
+	if len(body) > 0 || req.Method == http.MethodPost || req.Method == http.MethodPut || req.Method == http.MethodPatch {
+		fields = append(fields, field{"Content-Length", []string{strconv.Itoa(len(body))}})
+	}
+	if gzip {
+		fields = append(fields, field{"Accept-Encoding", []string{"gzip"}})
+	}
+	if !keepAlive {
+		fields = append(fields, field{"Connection", []string{"close"}})
+	}
+
+	rand.Shuffle(len(fields), func(i, j int) {
+		fields[i], fields[j] = fields[j], fields[i]
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), host)
+	for _, f := range fields {
+		for _, v := range f.values {
+			fmt.Fprintf(&buf, "%s: %s\r\n", f.key, v)
+		}
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	return buf.Bytes(), nil
+}
+
+// roundTripError closes the connection of a failed request, returning the error of the context if
+// it was canceled.
+func roundTripError(ctx context.Context, conn net.Conn, stop func() bool, err error) error {
+	stop()
+	conn.Close()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// closeRequestBody closes the body of the request, if any.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// connBody is a response body returning its connection to the idle connections of the transport once
+// it has been read to the end, or closing the connection if it is closed before.
+type connBody struct {
+	io.ReadCloser
+	conn      *headerOrderConn
+	stop      func() bool
+	transport *headerOrderTransport
+	reusable  bool
+	done      bool
+}
+
+func (b *connBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release(true)
+	}
+	return n, err
+}
+
+// Close closes the body, and the connection of the response unless the body was read to the end.
+func (b *connBody) Close() error {
+	if b.done {
+		return b.ReadCloser.Close()
+	}
+
+	// Closing the connection first keeps the body from reading its unread part, failing with the
+	// error of the closed connection, which does not matter to the caller.
+	b.release(false)
+	b.ReadCloser.Close()
+	return nil
+}
+
+// release gives the connection back to the transport if the response was read to the end and the
+// connection can be reused, or else closes it.
+func (b *connBody) release(eof bool) {
+	if b.done {
+		return
+	}
+	b.done = true
+
+	// stop reports false if the context was canceled and the connection closed already.
+	if b.stop() && eof && b.reusable {
+		b.transport.putIdle(b.conn)
+		return
+	}
+	b.conn.Close()
+}
+
+// gzipBody is a response body decompressing the gzip body of the response, read lazily so that a
+// response closed before it is read does not fail.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil {
+		if b.err == nil {
+			b.zr, b.err = gzip.NewReader(b.body)
+		}
+		if b.err != nil {
+			return 0, b.err
+		}
+	}
+	return b.zr.Read(p)
+}
+
+// Close closes the compressed body.
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newHeaderOrderServer starts a server recording the header names of every request in the order
+// they were written and responding with helloBytes. Connections are kept open for more requests
+// unless keepAlive is false or the request asks for them to be closed.
+func newHeaderOrderServer(t *testing.T, keepAlive bool) (addr string, orders func() [][]string, conns func() int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var lock sync.Mutex
+	var recorded [][]string
+	var accepted int
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			accepted++
+			lock.Unlock()
+
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					var names []string
+					closing := !keepAlive
+					for i := 0; ; i++ {
+						line, err := br.ReadString('\n')
+						if err != nil {
+							return
+						}
+						line = strings.TrimRight(line, "\r\n")
+						if line == "" {
+							break
+						}
+						if i > 0 {
+							names = append(names, strings.SplitN(line, ":", 2)[0])
+						}
+						if strings.EqualFold(line, "Connection: close") {
+							closing = true
+						}
+					}
+					lock.Lock()
+					recorded = append(recorded, names)
+					lock.Unlock()
+
+					conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\n"))
+					conn.Write(helloBytes[:5])
+					if closing {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), func() [][]string {
+			lock.Lock()
+			defer lock.Unlock()
+			return recorded
+		}, func() int {
+			lock.Lock()
+			defer lock.Unlock()
+			return accepted
+		}
+}
+
+func TestWithRandomHeaderOrder(t *testing.T) {
+	addr, orders, conns := newHeaderOrderServer(t, true)
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithAllowRevisit(true), WithRandomHeaderOrder(true))
+	h.RequestDo(func(req *Request) {
+		for _, name := range []string{"Accept", "Accept-Language", "Cache-Control", "Dnt", "Pragma", "X-Requested-With"} {
+			req.Headers.Set(name, "1")
+		}
+	})
+
+	var bodies []string
+	h.ResponseDo(func(res *Response) {
+		b := make([]byte, 5)
+		n, _ := res.Body.Read(b)
+		bodies = append(bodies, string(b[:n]))
+	})
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, h.Visit("http://"+addr+"/"))
+	}
+	assert.Len(t, bodies, 20)
+	assert.Equal(t, string(helloBytes[:5]), bodies[0])
+	assert.Equal(t, 1, conns(), "the connection is reused")
+
+	distinct := map[string]bool{}
+	for _, names := range orders() {
+		assert.Equal(t, "Host", names[0])
+		assert.ElementsMatch(t, []string{
+			"Host", "Accept", "Accept-Language", "Cache-Control", "Dnt", "Pragma", "X-Requested-With",
+			"User-Agent", "Accept-Encoding",
+		}, names)
+		distinct[strings.Join(names, ",")] = true
+	}
+	assert.Greater(t, len(distinct), 1)
+}
+
+func TestWithRandomHeaderOrder_Connections(t *testing.T) {
+	t.Run("Closed by server", func(t *testing.T) {
+		addr, orders, conns := newHeaderOrderServer(t, false)
+		h := newTestHarvester(WithIgnoreRobots(true), WithAllowRevisit(true), WithRandomHeaderOrder(true))
+
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, h.Visit("http://"+addr+"/"))
+		}
+		assert.Len(t, orders(), 5)
+		assert.Equal(t, 5, conns())
+	})
+
+	t.Run("DisableKeepAlives", func(t *testing.T) {
+		addr, orders, conns := newHeaderOrderServer(t, true)
+		h := newTestHarvester(WithIgnoreRobots(true), WithAllowRevisit(true), WithRandomHeaderOrder(true),
+			WithTransport(&http.Transport{DisableKeepAlives: true}))
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, h.Visit("http://"+addr+"/"))
+		}
+		assert.Equal(t, 3, conns())
+		for _, names := range orders() {
+			assert.Contains(t, names, "Connection")
+		}
+	})
+
+	t.Run("Unsupported transport", func(t *testing.T) {
+		addr, orders, _ := newHeaderOrderServer(t, true)
+		rt := &countingRoundTripper{}
+		h := NewHarvester(WithTransport(rt), WithIgnoreRobots(true), WithRandomHeaderOrder(true))
+
+		err := h.Visit("http://" + addr + "/")
+
+		assert.ErrorContains(t, err, "random header order requires an *http.Transport")
+		assert.Empty(t, rt.paths)
+		assert.Empty(t, orders())
+	})
+}
+
+func TestWithRandomHeaderOrder_Gzip(t *testing.T) {
+	var encodings []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Accept-Encoding"))
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write(helloBytes)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(helloBytes)
+		zw.Close()
+	}))
+	defer ts.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithRandomHeaderOrder(true))
+
+	var bodies []string
+	h.ResponseDo(func(res *Response) {
+		b, _ := io.ReadAll(res.Body)
+		bodies = append(bodies, string(b))
+		assert.Empty(t, res.Headers.Get("Content-Encoding"))
+	})
+	h.RequestDo(func(req *Request) {
+		if req.URL.Path == "/identity" {
+			req.Headers.Set("Accept-Encoding", "identity")
+		}
+	})
+
+	assert.NoError(t, h.Visit(ts.URL+"/"))
+	assert.NoError(t, h.Visit(ts.URL+"/identity"))
+	assert.Equal(t, []string{"gzip", "identity"}, encodings)
+	assert.Equal(t, []string{string(helloBytes), string(helloBytes)}, bodies)
+}
+
+func TestWithRandomHeaderOrder_Body(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Write(helloBytes)
+	}))
+	defer ts.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithRandomHeaderOrder(true))
+	_, err := h.GraphQL(ts.URL, "{ name }", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, body, `"query":"{ name }"`)
+}
+
+func TestWithRandomHeaderOrder_TLS(t *testing.T) {
+	var proto string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+		w.Write(helloBytes)
+	}))
+	defer ts.Close()
+
+	h := NewHarvester(WithClient(ts.Client()), WithIgnoreRobots(true), WithRandomHeaderOrder(true))
+
+	var status int
+	h.ResponseDo(func(res *Response) {
+		status = res.StatusCode
+	})
+
+	assert.NoError(t, h.Visit(ts.URL))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "HTTP/1.1", proto)
+
+	var dialed atomic.Int32
+	transport := ts.Client().Transport.(*http.Transport).Clone()
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed.Add(1)
+		config := transport.TLSClientConfig.Clone()
+		config.NextProtos = []string{"http/1.1"}
+		return (&tls.Dialer{Config: config}).DialContext(ctx, network, addr)
+	}
+	h = NewHarvester(WithTransport(transport), WithIgnoreRobots(true), WithAllowRevisit(true), WithRandomHeaderOrder(true))
+
+	assert.NoError(t, h.Visit(ts.URL))
+	assert.NoError(t, h.Visit(ts.URL))
+	assert.Equal(t, int32(1), dialed.Load())
+}
+
+func TestWithRandomHeaderOrder_Proxy(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	var relayed atomic.Int32
+	var auth atomic.Value
+	proxy := newTestProxy(&relayed, &auth)
+	defer proxy.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithProxy(proxy.URL), WithRandomHeaderOrder(true))
+
+	assert.NoError(t, h.Visit(ts.URL))
+	assert.Equal(t, int32(1), relayed.Load())
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrHeadProbeRejected is returned when the HEAD probe of a URL rejects fetching it.
+var ErrHeadProbeRejected = func(u string) error {
+	return fmt.Errorf("URL %s was rejected by its HEAD probe", u)
+}
+
+// HeadProbeFunc is a type for functions that decide from the response to a HEAD request whether
+// to fetch a URL, e.g. from its Content-Type or Content-Length.
+type HeadProbeFunc func(res *Response) bool
+
+// headProbe is the HEAD probe of a Harvester with its cached decisions by URL, the media types the
+// HEAD requests responded with, and the hosts that are no longer probed.
+type headProbe struct {
+	fn           HeadProbeFunc
+	preflight    bool
+	contentTypes []string
+	maxLength    int64
+	results      map[string]bool
+	headTypes    map[string]string
+	skipHosts    map[string]bool
+	lock         sync.Mutex
+}
+
+// newHeadProbe creates a new headProbe without a probe function or preflight filters.
+func newHeadProbe() *headProbe {
+	return &headProbe{
+		results:   make(map[string]bool),
+		headTypes: make(map[string]string),
+		skipHosts: make(map[string]bool),
+	}
+}
+
+// probeState returns the HEAD probe of the Harvester, creating it if needed.
+func (h *Harvester) probeState() *headProbe {
+	if h.headProbe == nil {
+		h.headProbe = newHeadProbe()
+	}
+
+	return h.headProbe
+}
+
+// WithHeadProbe is a functional option that sends a HEAD request before every GET request and fetches
+// the URL only if the given function returns true for the response, e.g. to skip large files that
+// are not HTML. The decision is cached by URL. If the HEAD request fails or the server does not
+// support HEAD requests, the URL is fetched.
+func WithHeadProbe(fn HeadProbeFunc) Options {
+	return func(h *Harvester) {
+		h.probeState().fn = fn
+	}
+}
+
+// WithPreflight is a functional option that sends a HEAD request before every GET request like
+// WithHeadProbe, and fetches the URL only if its Content-Type and Content-Length pass the filters
+// set with WithPreflightContentTypes and WithPreflightMaxLength. Hosts answering HEAD requests with
+// 405 Method Not Allowed, or with a Content-Type that does not match the one of the GET response,
+// are no longer preflighted. The HEAD requests and the skipped URLs are counted in Stats.
+func WithPreflight(enabled bool) Options {
+	return func(h *Harvester) {
+		h.probeState().preflight = enabled
+	}
+}
+
+// WithPreflightContentTypes is a functional option that sets the media types allowed by the preflight
+// HEAD request, e.g. "text/html". A type ending with a slash, such as "text/", allows every subtype.
+// Responses without a Content-Type are allowed.
+func WithPreflightContentTypes(types ...string) Options {
+	return func(h *Harvester) {
+		h.probeState().contentTypes = types
+	}
+}
+
+// WithPreflightMaxLength is a functional option that sets the maximum Content-Length allowed by the
+// preflight HEAD request. Responses without a Content-Length are allowed.
+func WithPreflightMaxLength(n int64) Options {
+	return func(h *Harvester) {
+		h.probeState().maxLength = n
+	}
+}
+
+// enabled reports whether URLs are probed with a HEAD request.
+func (p *headProbe) enabled() bool {
+	return p != nil && (p.fn != nil || p.preflight)
+}
+
+// allows reports whether the response to the HEAD request of a URL allows fetching it.
+func (p *headProbe) allows(res *Response) bool {
+	if p.preflight && !p.preflightAllows(res) {
+		return false
+	}
+
+	return p.fn == nil || p.fn(res)
+}
+
+// preflightAllows reports whether the Content-Type and Content-Length of the response pass the preflight filters.
+func (p *headProbe) preflightAllows(res *Response) bool {
+	if contentType := res.ContentType(); contentType != "" && len(p.contentTypes) > 0 {
+		allowed := false
+		for _, t := range p.contentTypes {
+			t = strings.ToLower(t)
+			if contentType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if p.maxLength > 0 {
+		if n, err := strconv.ParseInt(res.Headers.Get("Content-Length"), 10, 64); err == nil && n > p.maxLength {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkHeadProbe probes the URL with a HEAD request if a HEAD probe is set, returning an error if
+// the probe rejects fetching it.
+func (h *Harvester) checkHeadProbe(ctx context.Context, parsedURL *url.URL, method, key string, depth int, referrer *url.URL) error {
+	p := h.headProbe
+	if !p.enabled() || method != http.MethodGet || isFileURL(parsedURL) {
+		return nil
+	}
+
+	p.lock.Lock()
+	allowed, ok := p.results[key]
+	skip := p.skipHosts[parsedURL.Host]
+	p.lock.Unlock()
+
+	if skip {
+		return nil
+	}
+
+	if !ok {
+		allowed, ok = h.probe(ctx, parsedURL, key, depth, referrer)
+		if ok {
+			p.lock.Lock()
+			p.results[key] = allowed
+			p.lock.Unlock()
+		}
+	}
+
+	if !allowed {
+		h.stats.skippedPreflight.Add(1)
+		err := ErrHeadProbeRejected(parsedURL.String())
+		h.debug(EventFilteredOut, parsedURL.String(), depth, 0, err)
+		h.handleOnFiltered(parsedURL, err)
+		return err
+	}
+
+	return nil
+}
+
+// probe sends a HEAD request for the URL and returns the decision of the HEAD probe for the response.
+// The boolean is false if the decision should not be cached because the request failed.
+func (h *Harvester) probe(ctx context.Context, parsedURL *url.URL, key string, depth int, referrer *url.URL) (allowed, ok bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, parsedURL.String(), http.NoBody)
+	if err != nil {
+		return true, false
+	}
+
+	h.stats.preflightRequests.Add(1)
+
+	res, err := h.Client.Do(req)
+	if err != nil {
+		h.logger.Debug("error sending HEAD probe",
+			slog.String("url", parsedURL.String()),
+			slog.Any("error", err),
+		)
+		return true, false
+	}
+	defer h.closeBody(res)
+
+	p := h.headProbe
+
+	if res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented {
+		if p.preflight {
+			p.skipHost(parsedURL.Host)
+		}
+		return true, true
+	}
+
+	response := &Response{
+		StatusCode: res.StatusCode,
+		Headers:    &res.Header,
+		Request: &Request{
+			URL:       req.URL,
+			Headers:   &req.Header,
+			Host:      req.URL.Host,
+			Method:    req.Method,
+			Body:      http.NoBody,
+			Depth:     depth,
+			Referrer:  referrer,
+			harvester: h,
+		},
+		Body: http.NoBody,
+	}
+
+	p.lock.Lock()
+	p.headTypes[key] = response.ContentType()
+	p.lock.Unlock()
+
+	return p.allows(response), true
+}
+
+// checkHeadMismatch stops preflighting the host of the URL if the media type of the GET response
+// differs from the one of its HEAD request, as the HEAD requests of the host cannot be trusted.
+func (h *Harvester) checkHeadMismatch(u *url.URL, key, contentType string) {
+	p := h.headProbe
+	if p == nil || !p.preflight {
+		return
+	}
+
+	p.lock.Lock()
+	headType, ok := p.headTypes[key]
+	p.lock.Unlock()
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if ok && headType != mediaType {
+		h.logger.Debug("HEAD and GET responses differ, no longer preflighting the host",
+			slog.String("url", u.String()),
+			slog.String("head", headType),
+			slog.String("get", mediaType),
+		)
+		p.skipHost(u.Host)
+	}
+}
+
+// skipHost stops probing the host.
+func (p *headProbe) skipHost(host string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.skipHosts[host] = true
+}
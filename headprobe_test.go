@@ -0,0 +1,170 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_WithHeadProbe(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path]++
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write(helloBytes)
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Length", strconv.Itoa(50<<20))
+			if r.Method == http.MethodGet {
+				w.Write(make([]byte, 1024))
+			}
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write(helloBytes)
+		}
+	}))
+	defer server.Close()
+
+	var filtered []error
+	h := newTestHarvester(WithIgnoreRobots(true), WithAllowRevisit(true), WithHeadProbe(func(res *Response) bool {
+		return res.IsHTML() && res.Request.Method == http.MethodHead
+	}))
+	h.OnFiltered(func(u *url.URL, err error) {
+		filtered = append(filtered, err)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/page"))
+	assert.ErrorContains(t, h.Visit(server.URL+"/report.pdf"), "rejected by its HEAD probe")
+	assert.NoError(t, h.Visit(server.URL+"/no-head"))
+
+	// The decisions are cached.
+	assert.NoError(t, h.Visit(server.URL+"/page"))
+	assert.Error(t, h.Visit(server.URL+"/report.pdf"))
+
+	assert.Equal(t, map[string]int{
+		"HEAD /page":       1,
+		"GET /page":        2,
+		"HEAD /report.pdf": 1,
+		"HEAD /no-head":    1,
+		"GET /no-head":     1,
+	}, requests)
+	assert.Len(t, filtered, 2)
+}
+
+func TestHarvester_WithPreflight(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path]++
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(helloBytes)
+		case "/video.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+		case "/large.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", strconv.Itoa(10<<20))
+			if r.Method == http.MethodGet {
+				w.Write(make([]byte, 1024))
+			}
+		}
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(
+		WithIgnoreRobots(true),
+		WithPreflight(true),
+		WithPreflightContentTypes("text/"),
+		WithPreflightMaxLength(1<<20),
+	)
+
+	assert.NoError(t, h.Visit(server.URL+"/page"))
+	assert.ErrorContains(t, h.Visit(server.URL+"/video.mp4"), "rejected by its HEAD probe")
+	assert.ErrorContains(t, h.Visit(server.URL+"/large.html"), "rejected by its HEAD probe")
+
+	assert.Equal(t, map[string]int{
+		"HEAD /page":       1,
+		"GET /page":        1,
+		"HEAD /video.mp4":  1,
+		"HEAD /large.html": 1,
+	}, requests)
+
+	stats := h.Stats()
+	assert.Equal(t, int64(3), stats.PreflightRequests)
+	assert.Equal(t, int64(2), stats.SkippedPreflight)
+}
+
+func TestHarvester_WithPreflight_StopsOnMethodNotAllowed(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path]++
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithPreflight(true))
+
+	assert.NoError(t, h.Visit(server.URL+"/first"))
+	assert.NoError(t, h.Visit(server.URL+"/second"))
+
+	assert.Equal(t, map[string]int{
+		"HEAD /first": 1,
+		"GET /first":  1,
+		"GET /second": 1,
+	}, requests)
+	assert.Equal(t, int64(1), h.Stats().PreflightRequests)
+}
+
+func TestHarvester_WithPreflight_StopsOnMismatch(t *testing.T) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path]++
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithPreflight(true))
+
+	assert.NoError(t, h.Visit(server.URL+"/first"))
+	assert.NoError(t, h.Visit(server.URL+"/second"))
+
+	assert.Equal(t, map[string]int{
+		"HEAD /first": 1,
+		"GET /first":  1,
+		"GET /second": 1,
+	}, requests)
+}
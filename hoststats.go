@@ -0,0 +1,180 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram of the per-host statistics.
+var latencyBuckets = [...]time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// HostStats is a snapshot of the statistics of the requests sent to a single host.
+type HostStats struct {
+	// Requests is the number of requests sent to the host.
+	Requests int64
+	// Errors is the number of requests that failed or received a 5xx response.
+	Errors int64
+	// Bytes is the number of response body bytes read from the host.
+	Bytes int64
+	// LatencyP50 is the median time taken to send a request and read the response body, as the upper
+	// bound of its latency histogram bucket. Latencies over 30 seconds are reported as 30 seconds.
+	LatencyP50 time.Duration
+	// LatencyP95 is the 95th percentile of the latency, see LatencyP50.
+	LatencyP95 time.Duration
+}
+
+// hostCounters are the counters of the requests sent to a single host.
+type hostCounters struct {
+	requests  int64
+	errors    int64
+	bytes     int64
+	latencies [len(latencyBuckets)]int64
+}
+
+// recordHost records a request sent to the host that took the given time and read n bytes.
+func (s *stats) recordHost(host string, statusCode int, elapsed time.Duration, n int, err error) {
+	s.hostsLock.Lock()
+	defer s.hostsLock.Unlock()
+
+	c, ok := s.hosts[host]
+	if !ok {
+		c = &hostCounters{}
+		s.hosts[host] = c
+	}
+
+	c.requests++
+	c.bytes += int64(n)
+	if err != nil || statusCode >= http.StatusInternalServerError {
+		c.errors++
+	}
+
+	bucket := len(latencyBuckets) - 1
+	for i, bound := range latencyBuckets {
+		if elapsed <= bound {
+			bucket = i
+			break
+		}
+	}
+	c.latencies[bucket]++
+}
+
+// hostSnapshot returns a snapshot of the per-host statistics.
+func (s *stats) hostSnapshot() map[string]HostStats {
+	s.hostsLock.Lock()
+	defer s.hostsLock.Unlock()
+
+	snapshot := make(map[string]HostStats, len(s.hosts))
+	for host, c := range s.hosts {
+		snapshot[host] = HostStats{
+			Requests:   c.requests,
+			Errors:     c.errors,
+			Bytes:      c.bytes,
+			LatencyP50: c.quantile(0.5),
+			LatencyP95: c.quantile(0.95),
+		}
+	}
+
+	return snapshot
+}
+
+// hostState is the state of the counters of a host saved by Harvester.SaveState, with the full
+// latency histogram, which HostStats only summarizes.
+type hostState struct {
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	Bytes     int64   `json:"bytes"`
+	Latencies []int64 `json:"latencies"`
+}
+
+// hostStates returns the state of the per-host counters.
+func (s *stats) hostStates() map[string]hostState {
+	s.hostsLock.Lock()
+	defer s.hostsLock.Unlock()
+
+	states := make(map[string]hostState, len(s.hosts))
+	for host, c := range s.hosts {
+		states[host] = hostState{
+			Requests:  c.requests,
+			Errors:    c.errors,
+			Bytes:     c.bytes,
+			Latencies: slices.Clone(c.latencies[:]),
+		}
+	}
+
+	return states
+}
+
+// restoreHosts replaces the per-host counters with the given state.
+func (s *stats) restoreHosts(states map[string]hostState) {
+	s.hostsLock.Lock()
+	defer s.hostsLock.Unlock()
+
+	s.hosts = make(map[string]*hostCounters, len(states))
+	for host, state := range states {
+		c := &hostCounters{requests: state.Requests, errors: state.Errors, bytes: state.Bytes}
+		copy(c.latencies[:], state.Latencies)
+		s.hosts[host] = c
+	}
+}
+
+// quantile returns the upper bound of the histogram bucket holding the q quantile of the latencies.
+func (c *hostCounters) quantile(q float64) time.Duration {
+	var total int64
+	for _, n := range c.latencies {
+		total += n
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	rank := int64(q*float64(total) + 0.5)
+	rank = max(rank, 1)
+
+	var cumulative int64
+	for i, n := range c.latencies {
+		cumulative += n
+		if cumulative >= rank {
+			return latencyBuckets[i]
+		}
+	}
+
+	return latencyBuckets[len(latencyBuckets)-1]
+}
+
+// HostStats returns a snapshot of the statistics of the requests sent to each host, by host.
+// It is safe to call while the Harvester is crawling.
+func (h *Harvester) HostStats() map[string]HostStats {
+	return h.stats.hostSnapshot()
+}
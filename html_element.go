@@ -16,6 +16,9 @@ limitations under the License.
 package grawlr
 
 import (
+	"net/url"
+	"strings"
+
 	"github.com/PuerkitoBio/goquery"
 	"golang.org/x/net/html"
 )
@@ -38,3 +41,107 @@ func (e *HtmlElement) Attribute(key string) string {
 	}
 	return ""
 }
+
+// TrimmedText returns the text of the element with runs of whitespace collapsed to single spaces
+// and leading and trailing whitespace removed.
+func (e *HtmlElement) TrimmedText() string {
+	return strings.Join(strings.Fields(e.Text), " ")
+}
+
+// ChildText returns the trimmed text of the descendants of the element that match the given
+// GoQuery selector, an empty string if none match.
+func (e *HtmlElement) ChildText(selector string) string {
+	return strings.Join(strings.Fields(e.Selection.Find(selector).Text()), " ")
+}
+
+// ChildAttr returns the value of the attribute with the given key of the first descendant of the
+// element that matches the given GoQuery selector, an empty string if none match.
+func (e *HtmlElement) ChildAttr(selector, key string) string {
+	value, _ := e.Selection.Find(selector).First().Attr(key)
+	return value
+}
+
+// Visit resolves the given link against the page of the element and visits it like
+// Request.Visit, recording the text and the rel="nofollow" attribute of the element in
+// the link graph. Links that resolve to an empty URL, such as fragment-only links, are ignored.
+func (e *HtmlElement) Visit(link string) error {
+	absURL := e.Request.GetAbsoluteURL(link)
+	if absURL == "" {
+		return nil
+	}
+
+	noFollow := false
+	for _, rel := range strings.Fields(e.Attribute("rel")) {
+		if strings.EqualFold(rel, "nofollow") {
+			noFollow = true
+		}
+	}
+
+	return e.Request.follow(absURL, e.TrimmedText(), noFollow)
+}
+
+// Closest returns the closest ancestor of the element, including the element itself,
+// that matches the given GoQuery selector. Returns nil if no element matches.
+func (e *HtmlElement) Closest(selector string) *HtmlElement {
+	s := e.Selection.Closest(selector)
+	if s.Length() == 0 {
+		return nil
+	}
+
+	return e.newChild(s)
+}
+
+// Find returns the descendants of the element that match the given GoQuery selector.
+func (e *HtmlElement) Find(selector string) []*HtmlElement {
+	s := e.Selection.Find(selector)
+
+	elements := make([]*HtmlElement, 0, s.Length())
+	s.Each(func(_ int, child *goquery.Selection) {
+		elements = append(elements, e.newChild(child))
+	})
+
+	return elements
+}
+
+// newChild returns a new HtmlElement for the first node of the given selection,
+// sharing the Request and Response of the element.
+func (e *HtmlElement) newChild(s *goquery.Selection) *HtmlElement {
+	return &HtmlElement{
+		Text:       s.Text(),
+		attributes: s.Nodes[0].Attr,
+		Request:    e.Request,
+		Response:   e.Response,
+		Selection:  s,
+	}
+}
+
+// trimHrefWhitespace returns a copy of the attributes with whitespace trimmed from the href value.
+func trimHrefWhitespace(attributes []html.Attribute) []html.Attribute {
+	trimmed := make([]html.Attribute, len(attributes))
+	copy(trimmed, attributes)
+
+	for i, attr := range trimmed {
+		if attr.Key == "href" {
+			trimmed[i].Val = strings.TrimSpace(attr.Val)
+		}
+	}
+
+	return trimmed
+}
+
+// extractBaseHref returns the effective base URL of the document for resolving relative links.
+// It is the href of the first <base> element resolved against the request URL, or the request
+// URL itself if the document has no valid <base> element.
+func extractBaseHref(doc *goquery.Document, requestURL *url.URL) *url.URL {
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok {
+		return requestURL
+	}
+
+	base, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return requestURL
+	}
+
+	return requestURL.ResolveReference(base)
+}
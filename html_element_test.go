@@ -0,0 +1,147 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+const productsHTML = `
+<html>
+<body>
+	<div class="product" id="first">
+		<h2 class="title">Keyboard</h2>
+		<span class="price">49.90</span>
+	</div>
+	<div class="product" id="second">
+		<h2 class="title">Mouse</h2>
+		<span class="price">19.90</span>
+	</div>
+</body>
+</html>
+`
+
+func newTestElement(t *testing.T, selector string) *HtmlElement {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(productsHTML))
+	assert.NoError(t, err)
+
+	s := doc.Find(selector).First()
+
+	return &HtmlElement{
+		Text:       s.Text(),
+		attributes: s.Nodes[0].Attr,
+		Selection:  s,
+	}
+}
+
+func TestHtmlElement_Closest(t *testing.T) {
+	el := newTestElement(t, "#second .title")
+
+	card := el.Closest(".product")
+	assert.NotNil(t, card)
+	assert.Equal(t, "second", card.Attribute("id"))
+
+	price := card.Find(".price")
+	assert.Len(t, price, 1)
+	assert.Equal(t, "19.90", price[0].Text)
+
+	assert.Nil(t, el.Closest("table"))
+}
+
+func TestHtmlElement_Find(t *testing.T) {
+	el := newTestElement(t, "body")
+
+	titles := el.Find(".title")
+	assert.Len(t, titles, 2)
+	assert.Equal(t, "Keyboard", titles[0].Text)
+	assert.Equal(t, "title", titles[1].Attribute("class"))
+
+	assert.Empty(t, el.Find("table"))
+}
+
+func TestHtmlElement_TrimmedText(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	var paragraphs []string
+	h.HtmlDo("p", func(el *HtmlElement) {
+		paragraphs = append(paragraphs, el.TrimmedText())
+	})
+
+	err := h.Visit(server.URL + "/complex_whitespace")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"This page contains tabs, newlines, and various spacing:",
+		"Text with tabs and newlines",
+		"Another paragraph with mixed spacing and newlines.",
+	}, paragraphs)
+
+	el := newTestElement(t, "#first")
+	assert.Equal(t, "Keyboard 49.90", el.TrimmedText())
+	assert.Contains(t, el.Text, "\n", "Text is kept raw")
+}
+
+func TestHtmlElement_ChildText(t *testing.T) {
+	el := newTestElement(t, "#first")
+
+	assert.Equal(t, "Keyboard", el.ChildText(".title"))
+	assert.Equal(t, "title", el.ChildAttr("h2", "class"))
+	assert.Empty(t, el.ChildText("table"))
+	assert.Empty(t, el.ChildAttr("table", "class"))
+}
+
+// fakeElement is an Element for testing callbacks without a page.
+type fakeElement struct {
+	Element
+	text  string
+	attrs map[string]string
+}
+
+func (e fakeElement) Text() string                { return e.text }
+func (e fakeElement) Attribute(key string) string { return e.attrs[key] }
+
+func TestElement(t *testing.T) {
+	price := func(el Element) string {
+		return el.Attribute("data-currency") + " " + el.Text()
+	}
+
+	// Callbacks written against Element can be tested with fake elements.
+	assert.Equal(t, "EUR 9.90", price(fakeElement{text: "9.90", attrs: map[string]string{"data-currency": "EUR"}}))
+
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	var titles []string
+	var requests []*Request
+	h.ElementDo("title", func(el Element) {
+		titles = append(titles, el.Text())
+		requests = append(requests, el.Request())
+		assert.Same(t, el.Request(), el.Response().Request)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/complex_whitespace"))
+	assert.Equal(t, []string{"Complex Whitespace"}, titles)
+	assert.Equal(t, "/complex_whitespace", requests[0].URL.Path)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// byteLimiter bounds the number of response body bytes held in memory by the running fetches.
+type byteLimiter struct {
+	limit   int64
+	used    int64
+	changed chan struct{}
+	lock    *sync.Mutex
+}
+
+func newByteLimiter(limit int64) *byteLimiter {
+	return &byteLimiter{
+		limit:   limit,
+		changed: make(chan struct{}),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// wait blocks until the bytes in use are below the limit or the context is done.
+func (l *byteLimiter) wait(ctx context.Context) error {
+	for {
+		l.lock.Lock()
+		if l.used < l.limit {
+			l.lock.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// hold returns a byteHold counting the body bytes of a fetch against the limiter, nil if l is nil.
+func (l *byteLimiter) hold() *byteHold {
+	if l == nil {
+		return nil
+	}
+
+	return &byteHold{limiter: l}
+}
+
+// byteHold holds the body bytes read by a fetch in the byteLimiter until they are released.
+type byteHold struct {
+	limiter *byteLimiter
+	held    int64
+}
+
+// add records n more bytes held by the fetch.
+func (b *byteHold) add(n int64) {
+	l := b.limiter
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	b.held += n
+	l.used += n
+}
+
+// release gives back the bytes held by the fetch and wakes up the waiting fetches.
+// The bytes read afterwards are held again. A nil byteHold does nothing.
+func (b *byteHold) release() {
+	if b == nil {
+		return
+	}
+
+	l := b.limiter
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if b.held == 0 {
+		return
+	}
+	l.used -= b.held
+	b.held = 0
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// reader returns a reader holding the bytes read from r as they are read.
+func (b *byteHold) reader(r io.Reader) io.Reader {
+	return &byteHoldReader{r: r, hold: b}
+}
+
+// byteHoldReader adds the bytes read from r to its byteHold.
+type byteHoldReader struct {
+	r    io.Reader
+	hold *byteHold
+}
+
+func (r *byteHoldReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.hold.add(int64(n))
+	}
+	return n, err
+}
+
+// byteHoldContextKey is the context key of the byteHold of a fetch.
+type byteHoldContextKey struct{}
+
+// withByteHold returns a copy of the context carrying the byteHold, or ctx itself if b is nil.
+func withByteHold(ctx context.Context, b *byteHold) context.Context {
+	if b == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, byteHoldContextKey{}, b)
+}
+
+// byteHoldOf returns the byteHold of the fetch of the request, or nil if it has none.
+func byteHoldOf(req *http.Request) *byteHold {
+	b, _ := req.Context().Value(byteHoldContextKey{}).(*byteHold)
+	return b
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// FetchPhase is a phase of a single fetch reported to FetchHooks.
+type FetchPhase string
+
+const (
+	// PhaseRobots covers the robots.txt check of the fetched URL.
+	PhaseRobots FetchPhase = "robots"
+	// PhaseRequest covers sending the request and receiving the response headers.
+	PhaseRequest FetchPhase = "request"
+	// PhaseBody covers reading the response body.
+	PhaseBody FetchPhase = "body"
+	// PhaseCallbacks covers running the response and Html middlewares.
+	PhaseCallbacks FetchPhase = "callbacks"
+)
+
+// FetchHooks is an interface for instrumenting the fetches of a Harvester, for example
+// with distributed tracing. See the grawlrotel package for an OpenTelemetry implementation.
+type FetchHooks interface {
+	// StartFetch is called when a fetch of the given URL starts. The returned context is
+	// used for the outgoing request and the returned FetchSpan receives the fetch phases.
+	StartFetch(ctx context.Context, u *url.URL, depth int) (context.Context, FetchSpan)
+}
+
+// FetchSpan receives the phases and the outcome of a single fetch.
+type FetchSpan interface {
+	// StartPhase is called when a phase of the fetch starts. The returned function is called
+	// with the error of the phase, if any, when the phase ends.
+	StartPhase(ctx context.Context, phase FetchPhase) (context.Context, func(err error))
+	// Inject is called with the headers of the outgoing request, allowing trace headers to be propagated.
+	Inject(ctx context.Context, header http.Header)
+	// End is called when the fetch ends with the response status code, 0 if there is no response,
+	// and the error of the fetch, if any.
+	End(statusCode int, err error)
+}
+
+// noopFetchSpan is a FetchSpan that does nothing, used when no FetchHooks are configured.
+type noopFetchSpan struct{}
+
+func (noopFetchSpan) StartPhase(ctx context.Context, _ FetchPhase) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
+
+func (noopFetchSpan) Inject(context.Context, http.Header) {}
+
+func (noopFetchSpan) End(int, error) {}
+
+// startFetch starts instrumenting a fetch of the given URL if FetchHooks are configured.
+func (h *Harvester) startFetch(u *url.URL, depth int) (context.Context, FetchSpan) {
+	if h.hooks == nil {
+		return h.Context, noopFetchSpan{}
+	}
+
+	return h.hooks.StartFetch(h.Context, u, depth)
+}
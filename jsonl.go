@@ -0,0 +1,105 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// PageRecord is the record written by a JSONLExporter for an exported response.
+type PageRecord struct {
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status_code"`
+	Title      string    `json:"title,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// JSONLExporter writes one JSON object per line for every exported response or record, in the
+// JSON Lines format. It is safe to use from concurrent callbacks.
+//
+//	exporter := grawlr.NewJSONLExporter(f)
+//	h.ResponseDo(func(res *grawlr.Response) {
+//		exporter.Export(res)
+//	})
+type JSONLExporter struct {
+	// Transform shapes the record of an exported response before it is marshaled, nil to write the PageRecord as is.
+	Transform func(res *Response, rec PageRecord) any
+
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewJSONLExporter creates a new JSONLExporter writing to w.
+func NewJSONLExporter(w io.Writer) *JSONLExporter {
+	return &JSONLExporter{w: w}
+}
+
+// Export writes the PageRecord of the response, shaped by the Transform function if set.
+func (e *JSONLExporter) Export(res *Response) error {
+	rec := PageRecord{
+		URL:        res.Request.URL.String(),
+		StatusCode: res.StatusCode,
+		Title:      pageTitle(res.content),
+		Timestamp:  time.Now(),
+	}
+
+	if e.Transform != nil {
+		return e.WriteRecord(e.Transform(res, rec))
+	}
+
+	return e.WriteRecord(rec)
+}
+
+// WriteRecord writes the JSON encoding of v as a line. Nothing is written if v cannot be marshaled.
+func (e *JSONLExporter) WriteRecord(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+// Write writes the item as a line, so that a JSONLExporter can be used as a Sink.
+func (e *JSONLExporter) Write(item Item) error {
+	return e.WriteRecord(item)
+}
+
+// Close does nothing, it does not close the underlying writer.
+func (e *JSONLExporter) Close() error {
+	return nil
+}
+
+// pageTitle returns the trimmed text of the <title> element of an HTML page, empty if there is none.
+func pageTitle(content []byte) string {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(doc.Find("title").First().Text())
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLExporter(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	exporter := NewJSONLExporter(&buf)
+
+	h := newTestHarvester(WithDepthLimit(2))
+	h.ResponseDo(func(res *Response) {
+		assert.NoError(t, exporter.Export(res))
+	})
+	h.HtmlDo(`a[href="/"]`, func(el *HtmlElement) {
+		el.Request.Visit(el.Request.GetAbsoluteURL(el.Attribute("href")))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+
+	var records []PageRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var rec PageRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		assert.False(t, rec.Timestamp.IsZero())
+
+		records = append(records, PageRecord{URL: rec.URL, StatusCode: rec.StatusCode, Title: rec.Title})
+	}
+
+	assert.Equal(t, []PageRecord{
+		{URL: server.URL + "/faq", StatusCode: 200, Title: "FAQ"},
+		{URL: server.URL + "/", StatusCode: 200},
+	}, records)
+}
+
+func TestJSONLExporter_Transform(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	exporter := NewJSONLExporter(&buf)
+	exporter.Transform = func(res *Response, rec PageRecord) any {
+		return map[string]any{"page": rec.Title, "depth": res.Request.Depth}
+	}
+
+	h := newTestHarvester()
+	h.ResponseDo(func(res *Response) {
+		assert.NoError(t, exporter.Export(res))
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+	assert.JSONEq(t, `{"page": "FAQ", "depth": 0}`, buf.String())
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\n")))
+}
+
+func TestJSONLExporter_MarshalError(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := NewJSONLExporter(&buf)
+
+	assert.Error(t, exporter.WriteRecord(make(chan int)))
+	assert.NoError(t, exporter.WriteRecord(map[string]int{"n": 1}))
+	assert.Equal(t, "{\"n\":1}\n", buf.String())
+}
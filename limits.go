@@ -0,0 +1,132 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"sync"
+)
+
+// SetDepthLimit sets the maximum depth of links to follow, 0 to follow all links. It is safe to call
+// while the Harvester is crawling, and the new limit applies to the URLs checked after the call.
+func (h *Harvester) SetDepthLimit(depth int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.DepthLimit = depth
+}
+
+// depthLimit returns the maximum depth of links to follow.
+func (h *Harvester) depthLimit() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.DepthLimit
+}
+
+// SetDelayFunc sets the function computing the delay to wait before each request like WithDelayFunc,
+// nil to disable it, e.g. to slow down when a site starts responding with 429 Too Many Requests. It is
+// safe to call while the Harvester is crawling, and the new function applies to the requests sent after
+// the call.
+func (h *Harvester) SetDelayFunc(fn DelayFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.delayFunc = fn
+}
+
+// WithMaxConcurrency is a functional option that limits the number of requests the Harvester sends at
+// the same time, however many goroutines call Visit, 0 for no limit. The limit covers the exchange and
+// the read of the response body, not the callbacks, so links followed from a callback do not wait for
+// the request of their page.
+func WithMaxConcurrency(n int) Options {
+	return func(h *Harvester) {
+		h.concurrency.setLimit(n)
+	}
+}
+
+// SetMaxConcurrency sets the number of requests the Harvester sends at the same time like
+// WithMaxConcurrency. It is safe to call while the Harvester is crawling: raising the limit lets waiting
+// requests proceed at once, and lowering it takes effect as the running requests finish.
+func (h *Harvester) SetMaxConcurrency(n int) {
+	h.concurrency.setLimit(n)
+}
+
+// concurrencyLimiter is a semaphore whose size can be changed while it is in use.
+type concurrencyLimiter struct {
+	limit   int
+	running int
+	changed chan struct{}
+	lock    sync.Mutex
+}
+
+func newConcurrencyLimiter() *concurrencyLimiter {
+	return &concurrencyLimiter{
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire blocks until a request can be sent, or until the context is done.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.lock.Lock()
+		if l.limit <= 0 || l.running < l.limit {
+			l.running++
+			l.lock.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release marks a request acquired with acquire as finished.
+func (l *concurrencyLimiter) release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.running--
+	l.notify()
+}
+
+// setLimit sets the number of requests that can run at the same time, 0 for no limit.
+func (l *concurrencyLimiter) setLimit(n int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.limit = n
+	l.notify()
+}
+
+// maxConcurrency returns the number of requests that can run at the same time.
+func (l *concurrencyLimiter) maxConcurrency() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.limit
+}
+
+// notify wakes up the requests waiting in acquire. Must be called with the lock held.
+func (l *concurrencyLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_SetMaxConcurrency(t *testing.T) {
+	var running atomic.Int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		running.Add(1)
+		defer running.Add(-1)
+		<-release
+		w.Write(helloBytes)
+	}))
+	defer ts.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithMaxConcurrency(1))
+
+	visit := func(from, to int) {
+		for i := from; i < to; i++ {
+			go h.Visit(fmt.Sprintf("%s/%d", ts.URL, i))
+		}
+	}
+	runningIs := func(n int32) {
+		assert.Eventually(t, func() bool { return running.Load() == n }, time.Second, 5*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, n, running.Load())
+	}
+
+	visit(0, 3)
+	runningIs(1)
+
+	// Loosen the limit: the waiting requests proceed at once.
+	h.SetMaxConcurrency(3)
+	runningIs(3)
+	assert.Equal(t, 3, h.Config().MaxConcurrency)
+
+	// Tighten the limit: it takes effect as the running requests finish.
+	h.SetMaxConcurrency(1)
+	visit(3, 5)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(3), running.Load())
+
+	for i := 0; i < 3; i++ {
+		release <- struct{}{}
+	}
+	runningIs(1)
+
+	release <- struct{}{}
+	runningIs(1)
+	release <- struct{}{}
+
+	stats, err := h.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), stats.RequestsSucceeded)
+}
+
+func TestHarvester_SetDepthLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="%s/next">next</a></body></html>`, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithDepthLimit(2))
+
+	var visited []string
+	h.ResponseDo(func(res *Response) {
+		visited = append(visited, res.Request.URL.Path)
+	})
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		el.Visit(el.Attribute("href"))
+	})
+
+	assert.NoError(t, h.Visit(ts.URL+"/a"))
+	assert.Equal(t, []string{"/a", "/a/next"}, visited)
+
+	// Loosen the limit during the crawl.
+	visited = nil
+	h.RequestDo(func(req *Request) {
+		if req.Depth == 1 {
+			h.SetDepthLimit(4)
+		}
+	})
+	assert.NoError(t, h.Visit(ts.URL+"/b"))
+	assert.Equal(t, []string{"/b", "/b/next", "/b/next/next", "/b/next/next/next"}, visited)
+	assert.Equal(t, 4, h.Config().DepthLimit)
+
+	// Tighten the limit between crawls.
+	visited = nil
+	h.SetDepthLimit(1)
+	assert.NoError(t, h.Visit(ts.URL+"/c"))
+	assert.Equal(t, []string{"/c"}, visited)
+}
+
+func TestHarvester_SetDelayFunc(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithAllowRevisit(true))
+
+	var delayed int
+	h.SetDelayFunc(func(req *Request) time.Duration {
+		delayed++
+		return time.Millisecond
+	})
+	assert.NoError(t, h.Visit(ts.URL))
+	assert.Equal(t, 1, delayed)
+	assert.True(t, h.Config().DelayFunc)
+
+	h.SetDelayFunc(nil)
+	assert.NoError(t, h.Visit(ts.URL))
+	assert.Equal(t, 1, delayed)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// linkValue is a link of a Link header, as described in RFC 8288, with its parameter names in lowercase.
+type linkValue struct {
+	target string
+	params map[string]string
+}
+
+// LinkHeader returns the links of the Link headers of the response by relation type, e.g. "next"
+// or "last" for paginated APIs. Relation types are lowercase and the URLs are resolved against the
+// URL of the response. The first link of a relation type is returned if it occurs more than once.
+func (r *Response) LinkHeader() map[string]string {
+	links := make(map[string]string)
+
+	for _, link := range parseLinkHeader(r.Headers.Values("Link")) {
+		target, err := r.Request.URL.Parse(link.target)
+		if err != nil {
+			continue
+		}
+
+		for _, rel := range strings.Fields(strings.ToLower(link.params["rel"])) {
+			if _, ok := links[rel]; !ok {
+				links[rel] = target.String()
+			}
+		}
+	}
+
+	return links
+}
+
+// FollowLinkHeader follows pagination with the Link header. For every response with a link of the
+// given relation type, usually "next", the link is visited as a link of the response. The followed
+// pages are subject to the allowed and disallowed URLs and to the depth limit, which bounds the
+// number of pages followed from the first page. The link is followed by a response middleware named
+// "link-header" with PriorityBuiltin, after the middlewares with a lower priority.
+func (h *Harvester) FollowLinkHeader(rel string) {
+	rel = strings.ToLower(rel)
+
+	h.addResponseMiddleware("link-header", PriorityBuiltin, func(res *Response) {
+		next, ok := res.LinkHeader()[rel]
+		if !ok {
+			return
+		}
+
+		if err := res.Visit(next); err != nil {
+			h.logger.Debug("error following link header",
+				slog.String("url", res.Request.URL.String()),
+				slog.String("next", next),
+				slog.Any("error", err),
+			)
+		}
+	})
+}
+
+// headerLinkRels are the relation types of the Link header links followed with WithFollowHeaderLinks.
+var headerLinkRels = []string{"preload", "prefetch"}
+
+// WithFollowHeaderLinks is a functional option that follows the rel="preload" and rel="prefetch"
+// links of the Link headers of every response, discovering resources that are not linked from the
+// body of the page. The links are resolved against the URL of the response and followed as links of
+// the page, subject to the allowed and disallowed URLs and to the depth limit.
+func WithFollowHeaderLinks(enabled bool) Options {
+	return func(h *Harvester) {
+		h.followHeaderLinks = enabled
+	}
+}
+
+// followLinkHeaderResources visits the preload and prefetch links of the Link headers of the response.
+func (h *Harvester) followLinkHeaderResources(res *Response) {
+	for _, link := range parseLinkHeader(res.Headers.Values("Link")) {
+		if !slices.ContainsFunc(strings.Fields(link.params["rel"]), func(rel string) bool {
+			return slices.Contains(headerLinkRels, strings.ToLower(rel))
+		}) {
+			continue
+		}
+
+		target, err := res.Request.URL.Parse(link.target)
+		if err != nil {
+			continue
+		}
+
+		if err := res.Request.follow(withoutFragment(target).String(), "", false); err != nil {
+			h.logger.Debug("error following header link",
+				slog.String("url", res.Request.URL.String()),
+				slog.String("link", target.String()),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// parseLinkHeader parses the values of Link headers of the form `<url>; rel="next"; title="Next", <url>; ...`.
+// Malformed links are skipped.
+func parseLinkHeader(values []string) []linkValue {
+	var links []linkValue
+
+	for _, value := range values {
+		for value != "" {
+			start := strings.IndexByte(value, '<')
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(value[start:], '>')
+			if end < 0 {
+				break
+			}
+
+			link := linkValue{
+				target: strings.TrimSpace(value[start+1 : start+end]),
+				params: make(map[string]string),
+			}
+
+			var params string
+			params, value = splitLinkParams(value[start+end+1:])
+			for _, param := range strings.Split(params, ";") {
+				name, val, _ := strings.Cut(param, "=")
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name == "" {
+					continue
+				}
+				if _, ok := link.params[name]; !ok {
+					link.params[name] = strings.Trim(strings.TrimSpace(val), `"`)
+				}
+			}
+
+			links = append(links, link)
+		}
+	}
+
+	return links
+}
+
+// splitLinkParams splits the parameters of a link from the links following it at the first
+// comma outside of a quoted string.
+func splitLinkParams(s string) (params, rest string) {
+	quoted := false
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			return s[:i], s[i+1:]
+		}
+	}
+
+	return s, ""
+}
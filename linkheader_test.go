@@ -0,0 +1,99 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponse_LinkHeader(t *testing.T) {
+	headers := http.Header{}
+	headers.Add("Link", `<https://api.example.com/items?page=2>; rel="next", <https://api.example.com/items?page=5>; rel="last"`)
+	headers.Add("Link", `</items?page=1>; title="First, page"; rel="First prev", <https://other.example.com/>; rel=next`)
+	headers.Add("Link", `malformed; rel="broken"`)
+	u, _ := url.Parse("https://api.example.com/v1/items?page=2")
+	res := &Response{Headers: &headers, Request: &Request{URL: u}}
+
+	assert.Equal(t, map[string]string{
+		"next":  "https://api.example.com/items?page=2",
+		"last":  "https://api.example.com/items?page=5",
+		"first": "https://api.example.com/items?page=1",
+		"prev":  "https://api.example.com/items?page=1",
+	}, res.LinkHeader())
+
+	headers.Del("Link")
+	assert.Empty(t, res.LinkHeader())
+}
+
+func TestHarvester_FollowLinkHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+		if page != "3" {
+			next := map[string]string{"1": "2", "2": "3"}[page]
+			w.Header().Set("Link", fmt.Sprintf(`</items?page=%s>; rel="next", </items?page=3>; rel="last"`, next))
+		}
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true))
+
+	var pages []string
+	h.ResponseDo(func(res *Response) {
+		pages = append(pages, res.Request.URL.RequestURI())
+	})
+	h.FollowLinkHeader("next")
+
+	assert.NoError(t, h.Visit(server.URL+"/items"))
+	assert.Equal(t, []string{"/items", "/items?page=2", "/items?page=3"}, pages)
+}
+
+func TestHarvester_WithFollowHeaderLinks(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Header().Add("Link", `</static/app.css>; rel=preload; as=style, </next>; rel="next"`)
+			w.Header().Add("Link", `<fonts/font.woff2#x>; rel="Preload"; as=font, <`+server.URL+`/feed>; rel="prefetch"`)
+			w.Header().Add("Link", `<https://cdn.example.com/lib.js>; rel=preload`)
+		}
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(
+		WithFollowHeaderLinks(true),
+		WithIgnoreRobots(true),
+		WithAllowedURLs([]string{server.URL}),
+	)
+
+	var visited []string
+	h.ResponseDo(func(res *Response) {
+		visited = append(visited, res.Request.URL.Path)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, []string{"/", "/static/app.css", "/fonts/font.woff2", "/feed"}, visited)
+	assert.Equal(t, int64(1), h.Stats().SkippedFiltered)
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrLocalAddr is returned for every request when an address set with WithLocalAddrs is invalid
+// or not assigned to a network interface of the machine.
+var ErrLocalAddr = func(addr string, err error) error {
+	return fmt.Errorf("local address %s: %w", addr, err)
+}
+
+// interfaceAddrs returns the addresses assigned to the network interfaces, replaced in tests.
+var interfaceAddrs = net.InterfaceAddrs
+
+// WithLocalAddrs is a functional option that binds the connections of the Harvester to the given
+// local IP addresses, e.g. to spread the crawl over several egress IPs. A new connection uses the next
+// address round-robin, or the same address for every connection to a host if enabled with
+// WithStickyLocalAddrs. The addresses are checked against the network interfaces when the Harvester is
+// created, and every request fails with ErrLocalAddr if one of them is not assigned to an interface.
+// The transport of the client is cloned, and the address of each connection is recorded in
+// Response.Trace, enabling WithHTTPTrace.
+func WithLocalAddrs(addrs []string) Options {
+	return func(h *Harvester) {
+		h.localAddrs = addrs
+	}
+}
+
+// WithStickyLocalAddrs is a functional option that makes WithLocalAddrs use the same local address
+// for every connection to a host, instead of rotating the addresses round-robin.
+func WithStickyLocalAddrs(enabled bool) Options {
+	return func(h *Harvester) {
+		h.stickyLocalAddrs = enabled
+	}
+}
+
+// localAddrPool rotates the local addresses connections are bound to.
+type localAddrPool struct {
+	addrs  []*net.TCPAddr
+	sticky bool
+	next   int
+	hosts  map[string]*net.TCPAddr
+	lock   sync.Mutex
+}
+
+// newLocalAddrPool creates a new localAddrPool, returning an error if an address is not an IP
+// address assigned to a network interface.
+func newLocalAddrPool(addrs []string, sticky bool) (*localAddrPool, error) {
+	assigned, err := interfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("listing interface addresses: %w", err)
+	}
+
+	p := &localAddrPool{
+		sticky: sticky,
+		hosts:  make(map[string]*net.TCPAddr),
+	}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, ErrLocalAddr(addr, errors.New("not an IP address"))
+		}
+		if !isAssigned(ip, assigned) {
+			return nil, ErrLocalAddr(addr, errors.New("not assigned to a network interface"))
+		}
+		p.addrs = append(p.addrs, &net.TCPAddr{IP: ip})
+	}
+
+	if len(p.addrs) == 0 {
+		return nil, errors.New("no local addresses")
+	}
+
+	return p, nil
+}
+
+// isAssigned reports whether the IP is one of the interface addresses.
+func isAssigned(ip net.IP, assigned []net.Addr) bool {
+	for _, a := range assigned {
+		var assignedIP net.IP
+		switch a := a.(type) {
+		case *net.IPNet:
+			assignedIP = a.IP
+		case *net.IPAddr:
+			assignedIP = a.IP
+		}
+		if assignedIP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pick returns the local address of the next connection to the host.
+func (p *localAddrPool) pick(host string) *net.TCPAddr {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.sticky {
+		if addr, ok := p.hosts[host]; ok {
+			return addr
+		}
+	}
+
+	addr := p.addrs[p.next%len(p.addrs)]
+	p.next++
+
+	if p.sticky {
+		p.hosts[host] = addr
+	}
+
+	return addr
+}
+
+// localAddrDialer returns the dial function binding connections to the local addresses, or a dial
+// function failing every connection if the addresses are invalid.
+func (h *Harvester) localAddrDialer() DialFunc {
+	pool, err := newLocalAddrPool(h.localAddrs, h.stickyLocalAddrs)
+	if err != nil {
+		h.logger.Error("invalid local addresses", slog.Any("error", err))
+		return func(context.Context, string, string) (net.Conn, error) {
+			return nil, err
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, _ := net.SplitHostPort(addr)
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			LocalAddr: pool.pick(host),
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
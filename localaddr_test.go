@@ -0,0 +1,136 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withInterfaceAddrs replaces the interface addresses for the duration of the test.
+func withInterfaceAddrs(t *testing.T, addrs ...string) {
+	original := interfaceAddrs
+	t.Cleanup(func() { interfaceAddrs = original })
+
+	interfaceAddrs = func() ([]net.Addr, error) {
+		var assigned []net.Addr
+		for _, addr := range addrs {
+			_, ipNet, _ := net.ParseCIDR(addr + "/24")
+			ipNet.IP = net.ParseIP(addr)
+			assigned = append(assigned, ipNet)
+		}
+		return assigned, nil
+	}
+}
+
+func TestLocalAddrPool(t *testing.T) {
+	withInterfaceAddrs(t, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+
+	pick := func(p *localAddrPool, host string) string {
+		return p.pick(host).IP.String()
+	}
+
+	t.Run("Round-robin", func(t *testing.T) {
+		p, err := newLocalAddrPool([]string{"10.0.0.1", "10.0.0.2"}, false)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "10.0.0.1", pick(p, "a.example"))
+		assert.Equal(t, "10.0.0.2", pick(p, "a.example"))
+		assert.Equal(t, "10.0.0.1", pick(p, "b.example"))
+	})
+
+	t.Run("Sticky", func(t *testing.T) {
+		p, err := newLocalAddrPool([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, true)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "10.0.0.1", pick(p, "a.example"))
+		assert.Equal(t, "10.0.0.2", pick(p, "b.example"))
+		assert.Equal(t, "10.0.0.1", pick(p, "a.example"))
+		assert.Equal(t, "10.0.0.2", pick(p, "b.example"))
+		assert.Equal(t, "10.0.0.3", pick(p, "c.example"))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := newLocalAddrPool([]string{"10.0.0.1", "10.0.0.9"}, false)
+		assert.EqualError(t, err, "local address 10.0.0.9: not assigned to a network interface")
+
+		_, err = newLocalAddrPool([]string{"eth0"}, false)
+		assert.EqualError(t, err, "local address eth0: not an IP address")
+
+		_, err = newLocalAddrPool(nil, false)
+		assert.Error(t, err)
+	})
+}
+
+func TestHarvester_WithLocalAddrs(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithLocalAddrs([]string{"127.0.0.1"}))
+
+	var localAddr string
+	h.ResponseDo(func(res *Response) {
+		localAddr = res.Trace.LocalAddr
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.True(t, strings.HasPrefix(localAddr, "127.0.0.1:"), localAddr)
+
+	t.Run("Unassigned address", func(t *testing.T) {
+		h := newTestHarvester(WithIgnoreRobots(true), WithLocalAddrs([]string{"192.0.2.1"}))
+
+		err := h.Visit(server.URL + "/")
+
+		assert.ErrorContains(t, err, "local address 192.0.2.1: not assigned to a network interface")
+	})
+}
+
+// TestHarvester_WithLocalAddrs_Aliases binds to loopback aliases listed in GRAWLR_TEST_LOCAL_ADDRS,
+// e.g. "127.0.0.2,127.0.0.3" after adding them with "ip addr add 127.0.0.2/8 dev lo".
+func TestHarvester_WithLocalAddrs_Aliases(t *testing.T) {
+	env := os.Getenv("GRAWLR_TEST_LOCAL_ADDRS")
+	if env == "" {
+		t.Skip("GRAWLR_TEST_LOCAL_ADDRS is not set")
+	}
+	addrs := strings.Split(env, ",")
+
+	var lock sync.Mutex
+	var remotes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		lock.Lock()
+		remotes = append(remotes, host)
+		lock.Unlock()
+		w.Header().Set("Connection", "close")
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithLocalAddrs(addrs))
+
+	for i := range addrs {
+		assert.NoError(t, h.Visit(server.URL+"/"+strings.Repeat("a", i+1)))
+	}
+
+	assert.Equal(t, addrs, remotes)
+}
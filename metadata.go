@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// metadataURLProperties are the OpenGraph and Twitter card properties whose values are URLs.
+var metadataURLProperties = map[string]bool{
+	"og:url":                true,
+	"og:image":              true,
+	"og:image:url":          true,
+	"og:image:secure_url":   true,
+	"og:video":              true,
+	"og:video:url":          true,
+	"og:video:secure_url":   true,
+	"og:audio":              true,
+	"og:audio:url":          true,
+	"og:audio:secure_url":   true,
+	"twitter:image":         true,
+	"twitter:image:src":     true,
+	"twitter:player":        true,
+	"twitter:player:stream": true,
+}
+
+// OpenGraph returns the OpenGraph properties of the page from its <meta property="og:*"> tags, keyed
+// by property name, e.g. "og:title". URL properties such as og:image are resolved to absolute URLs.
+// The first value of a property is returned if it occurs more than once.
+func (r *Response) OpenGraph() map[string]string {
+	return r.metaProperties("og:")
+}
+
+// TwitterCard returns the Twitter card properties of the page from its <meta name="twitter:*"> tags,
+// keyed by property name, e.g. "twitter:card". URL properties such as twitter:image are resolved to
+// absolute URLs. The first value of a property is returned if it occurs more than once.
+func (r *Response) TwitterCard() map[string]string {
+	return r.metaProperties("twitter:")
+}
+
+// metaProperties returns the content of the <meta> tags of the page whose property or name
+// attribute starts with the given prefix.
+func (r *Response) metaProperties(prefix string) map[string]string {
+	properties := make(map[string]string)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.content))
+	if err != nil {
+		return properties
+	}
+
+	doc.Find("meta[content]").Each(func(_ int, s *goquery.Selection) {
+		name, ok := s.Attr("property")
+		if !ok {
+			name, _ = s.Attr("name")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !strings.HasPrefix(name, prefix) {
+			return
+		}
+		if _, ok := properties[name]; ok {
+			return
+		}
+
+		content, _ := s.Attr("content")
+		content = strings.TrimSpace(content)
+		if metadataURLProperties[name] && r.Request != nil {
+			content = r.Request.GetAbsoluteURL(content)
+		}
+
+		properties[name] = content
+	})
+
+	return properties
+}
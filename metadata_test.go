@@ -0,0 +1,66 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const metadataHTML = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Article</title>
+	<meta property="og:title" content="An Article">
+	<meta property="og:type" content="article">
+	<meta property="og:url" content="https://example.com/articles/1">
+	<meta property="og:image" content="/images/cover.png">
+	<meta property="og:image" content="/images/other.png">
+	<meta property="og:image:width" content=" 1200 ">
+	<meta property="OG:Locale" content="en_US">
+	<meta name="twitter:card" content="summary_large_image">
+	<meta name="twitter:site" content="@example">
+	<meta name="twitter:image" content="images/card.png">
+	<meta name="description" content="Not OpenGraph">
+	<meta property="og:description">
+</head>
+<body></body>
+</html>`
+
+func TestResponse_OpenGraph(t *testing.T) {
+	u, _ := url.Parse("https://example.com/articles/1?ref=feed")
+	res := &Response{Request: &Request{URL: u}, content: []byte(metadataHTML)}
+
+	assert.Equal(t, map[string]string{
+		"og:title":       "An Article",
+		"og:type":        "article",
+		"og:url":         "https://example.com/articles/1",
+		"og:image":       "https://example.com/images/cover.png",
+		"og:image:width": "1200",
+		"og:locale":      "en_US",
+	}, res.OpenGraph())
+
+	assert.Equal(t, map[string]string{
+		"twitter:card":  "summary_large_image",
+		"twitter:site":  "@example",
+		"twitter:image": "https://example.com/articles/images/card.png",
+	}, res.TwitterCard())
+
+	empty := &Response{Request: &Request{URL: u}, content: []byte("<html></html>")}
+	assert.Empty(t, empty.OpenGraph())
+}
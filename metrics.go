@@ -0,0 +1,67 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"time"
+)
+
+// FetchMetric describes a single completed HTTP exchange of a Harvester.
+//
+// Use MetricsDo for a cheap per-request stream of metrics, for example to adjust the crawl
+// behavior live based on the responses of a host. Use Stats for aggregate counters of the
+// whole crawl and a Debugger for a detailed trace of every crawl lifecycle event.
+type FetchMetric struct {
+	// Host is the host of the requested URL.
+	Host string
+	// StatusCode is the status code of the response, 0 if the request failed without a response.
+	StatusCode int
+	// Duration is the time taken to send the request and read the response body.
+	Duration time.Duration
+	// Bytes is the number of response body bytes read.
+	Bytes int64
+	// Depth is the depth of the request.
+	Depth int
+	// Err is the error of the request, if any.
+	Err error
+	// Trace holds the network timings of the request, nil unless enabled with the WithHTTPTrace functional option.
+	Trace *Trace
+}
+
+// MetricsCallback is a type for callbacks that receive a FetchMetric for each completed HTTP exchange.
+type MetricsCallback func(m FetchMetric)
+
+// handleMetricsDo passes the metric of a completed HTTP exchange to the MetricsDo callbacks.
+func (h *Harvester) handleMetricsDo(req *http.Request, depth, statusCode int, start time.Time, n int, err error) {
+	if len(h.metricsCallbacks) == 0 {
+		return
+	}
+
+	m := FetchMetric{
+		Host:       req.URL.Host,
+		StatusCode: statusCode,
+		Duration:   time.Since(start),
+		Bytes:      int64(n),
+		Depth:      depth,
+		Err:        err,
+		Trace:      traceOf(req),
+	}
+
+	for _, fn := range h.metricsCallbacks {
+		fn(m)
+	}
+}
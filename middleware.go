@@ -0,0 +1,254 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// MiddlewareKind is the kind of a middleware registered on a Harvester.
+type MiddlewareKind string
+
+const (
+	// MiddlewareRequest is the kind of the middlewares added with RequestDo.
+	MiddlewareRequest MiddlewareKind = "request"
+	// MiddlewareResponse is the kind of the middlewares added with ResponseDo.
+	MiddlewareResponse MiddlewareKind = "response"
+	// MiddlewareStatus is the kind of the middlewares added with StatusDo and StatusRangeDo.
+	MiddlewareStatus MiddlewareKind = "status"
+	// MiddlewareHtml is the kind of the middlewares added with HtmlDo and ElementDo.
+	MiddlewareHtml MiddlewareKind = "html"
+)
+
+// Middleware priorities. Middlewares run in ascending order of priority, and middlewares with the same
+// priority in the order they were added. Priorities from PriorityBuiltin up to, but not including,
+// 2*PriorityBuiltin are reserved for the middlewares of built-in features, such as FollowJSONPagination
+// and FollowLinkHeader: a middleware with a lower priority runs before them and one with a priority of
+// 2*PriorityBuiltin or more runs after them. The request setup of the Harvester, such as the Referer and
+// cookie headers, happens before every request middleware regardless of priority.
+const (
+	// PriorityDefault is the priority of middlewares added without one.
+	PriorityDefault = 0
+	// PriorityBuiltin is the priority of the middlewares of built-in features.
+	PriorityBuiltin = 1000
+)
+
+// MiddlewareInfo describes a middleware registered on a Harvester, returned by ListMiddlewares.
+type MiddlewareInfo struct {
+	// Name is the name of the middleware, generated from its kind if it was added without a name.
+	Name string
+	// Kind is the kind of the middleware.
+	Kind MiddlewareKind
+	// Selector is the GoQuery selector of a Html middleware, empty for other kinds.
+	Selector string
+	// Priority is the priority of the middleware, PriorityDefault for status middlewares.
+	Priority int
+}
+
+// requestMiddleware is a named request middleware.
+type requestMiddleware struct {
+	name     string
+	priority int
+	function ReqMiddleware
+}
+
+// responseMiddleware is a named response middleware.
+type responseMiddleware struct {
+	name     string
+	priority int
+	function ResMiddleware
+}
+
+// RequestDoNamed adds a request middleware to the Harvester like RequestDo under the given name,
+// which identifies it in ListMiddlewares, RemoveMiddleware and the events of the Debugger.
+func (h *Harvester) RequestDoNamed(name string, mw ReqMiddleware) {
+	h.addRequestMiddleware(name, PriorityDefault, mw)
+}
+
+// ResponseDoNamed adds a response middleware to the Harvester like ResponseDo under the given name,
+// which identifies it in ListMiddlewares, RemoveMiddleware and the events of the Debugger.
+func (h *Harvester) ResponseDoNamed(name string, mw ResMiddleware) {
+	h.addResponseMiddleware(name, PriorityDefault, mw)
+}
+
+// HtmlDoNamed adds a Html middleware to the Harvester like HtmlDo under the given name, which
+// identifies it in ListMiddlewares, RemoveMiddleware and the events of the Debugger.
+func (h *Harvester) HtmlDoNamed(name, gqSelector string, fn HtmlCallback) {
+	h.addHtmlMiddleware(name, PriorityDefault, gqSelector, fn)
+}
+
+// RequestDoWithPriority adds a request middleware to the Harvester like RequestDo, running it in
+// the order of the given priority. See PriorityBuiltin for the priorities of built-in features.
+func (h *Harvester) RequestDoWithPriority(p int, mw ReqMiddleware) {
+	h.addRequestMiddleware("", p, mw)
+}
+
+// ResponseDoWithPriority adds a response middleware to the Harvester like ResponseDo, running it in
+// the order of the given priority. See PriorityBuiltin for the priorities of built-in features.
+func (h *Harvester) ResponseDoWithPriority(p int, mw ResMiddleware) {
+	h.addResponseMiddleware("", p, mw)
+}
+
+// HtmlDoWithPriority adds a Html middleware to the Harvester like HtmlDo, running it in the order
+// of the given priority. See PriorityBuiltin for the priorities of built-in features.
+func (h *Harvester) HtmlDoWithPriority(p int, gqSelector string, fn HtmlCallback) {
+	h.addHtmlMiddleware("", p, gqSelector, fn)
+}
+
+func (h *Harvester) addRequestMiddleware(name string, priority int, mw ReqMiddleware) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.requestMiddlewares = insertByPriority(h.requestMiddlewares, requestMiddleware{
+		name:     h.middlewareName(name, MiddlewareRequest),
+		priority: priority,
+		function: mw,
+	}, func(m requestMiddleware) int { return m.priority })
+}
+
+func (h *Harvester) addResponseMiddleware(name string, priority int, mw ResMiddleware) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.responseMiddlewares = insertByPriority(h.responseMiddlewares, responseMiddleware{
+		name:     h.middlewareName(name, MiddlewareResponse),
+		priority: priority,
+		function: mw,
+	}, func(m responseMiddleware) int { return m.priority })
+}
+
+func (h *Harvester) addHtmlMiddleware(name string, priority int, gqSelector string, fn HtmlCallback) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.htmlMiddlewares = insertByPriority(h.htmlMiddlewares, HtmlMiddleware{
+		Name:     h.middlewareName(name, MiddlewareHtml),
+		Priority: priority,
+		Selector: gqSelector,
+		Function: fn,
+	}, func(m HtmlMiddleware) int { return m.Priority })
+}
+
+// insertByPriority returns the middlewares with m inserted after the middlewares with the same or a
+// lower priority. Like withoutNamed, it copies the slice rather than modifying the middlewares that
+// the handlers may be iterating over, except for appending to its end.
+func insertByPriority[T any](middlewares []T, m T, priorityOf func(T) int) []T {
+	i := len(middlewares)
+	for i > 0 && priorityOf(middlewares[i-1]) > priorityOf(m) {
+		i--
+	}
+
+	if i == len(middlewares) {
+		return append(middlewares, m)
+	}
+
+	inserted := make([]T, 0, len(middlewares)+1)
+	inserted = append(inserted, middlewares[:i]...)
+	inserted = append(inserted, m)
+	return append(inserted, middlewares[i:]...)
+}
+
+// ListMiddlewares returns the middlewares registered on the Harvester: the request middlewares, then
+// the response, status and Html middlewares, each in the order they run.
+func (h *Harvester) ListMiddlewares() []MiddlewareInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var infos []MiddlewareInfo
+	for _, m := range h.requestMiddlewares {
+		infos = append(infos, MiddlewareInfo{Name: m.name, Kind: MiddlewareRequest, Priority: m.priority})
+	}
+	for _, m := range h.responseMiddlewares {
+		infos = append(infos, MiddlewareInfo{Name: m.name, Kind: MiddlewareResponse, Priority: m.priority})
+	}
+	for _, m := range h.statusMiddlewares {
+		infos = append(infos, MiddlewareInfo{Name: m.name, Kind: MiddlewareStatus})
+	}
+	for _, m := range h.htmlMiddlewares {
+		infos = append(infos, MiddlewareInfo{Name: m.Name, Kind: MiddlewareHtml, Selector: m.Selector, Priority: m.Priority})
+	}
+	return infos
+}
+
+// RemoveMiddleware removes every middleware with the given name from the Harvester, reporting whether
+// any was removed. It is safe to call during a crawl: requests and responses already being handled
+// finish with the middlewares they started with.
+func (h *Harvester) RemoveMiddleware(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var removed [4]bool
+	h.requestMiddlewares, removed[0] = withoutNamed(h.requestMiddlewares, name, func(m requestMiddleware) string { return m.name })
+	h.responseMiddlewares, removed[1] = withoutNamed(h.responseMiddlewares, name, func(m responseMiddleware) string { return m.name })
+	h.statusMiddlewares, removed[2] = withoutNamed(h.statusMiddlewares, name, func(m statusMiddleware) string { return m.name })
+	h.htmlMiddlewares, removed[3] = withoutNamed(h.htmlMiddlewares, name, func(m HtmlMiddleware) string { return m.Name })
+
+	return removed != [4]bool{}
+}
+
+// withoutNamed returns a copy of the middlewares without the ones with the given name, or the
+// middlewares themselves if none has the name. The slice is copied rather than modified in place as
+// the handlers iterate over it without holding the lock of the Harvester.
+func withoutNamed[T any](middlewares []T, name string, nameOf func(T) string) ([]T, bool) {
+	kept := make([]T, 0, len(middlewares))
+	for _, m := range middlewares {
+		if nameOf(m) != name {
+			kept = append(kept, m)
+		}
+	}
+
+	if len(kept) == len(middlewares) {
+		return middlewares, false
+	}
+	return kept, true
+}
+
+// hasHtmlMiddlewares reports whether the Harvester has Html middlewares.
+func (h *Harvester) hasHtmlMiddlewares() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.htmlMiddlewares) > 0
+}
+
+// middlewareName returns the given name, or a name generated from the kind if it is empty.
+// Must be called with the lock of the Harvester held.
+func (h *Harvester) middlewareName(name string, kind MiddlewareKind) string {
+	h.middlewareSeq++
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("%s-%d", kind, h.middlewareSeq)
+}
+
+// runMiddleware calls the middleware, reporting a panic with the name of the middleware to the
+// logger and the Debugger before letting it continue.
+func (h *Harvester) runMiddleware(name, u string, depth, statusCode int, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.logger.Error("middleware panicked",
+				slog.String("middleware", name),
+				slog.String("url", u),
+				slog.Any("panic", r),
+			)
+			h.debugMiddleware(EventCallbackError, name, u, depth, statusCode, fmt.Errorf("middleware %s panicked: %v", name, r))
+			panic(r)
+		}
+	}()
+
+	fn()
+}
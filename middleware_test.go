@@ -0,0 +1,168 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_ListMiddlewares(t *testing.T) {
+	h := newTestHarvester()
+
+	h.RequestDoNamed("auth", func(req *Request) {})
+	h.RequestDo(func(req *Request) {})
+	h.ResponseDoNamed("save", func(res *Response) {})
+	h.StatusDo(404, func(res *Response) {})
+	h.HtmlDoNamed("links", "a[href]", func(el *HtmlElement) {})
+
+	assert.Equal(t, []MiddlewareInfo{
+		{Name: "auth", Kind: MiddlewareRequest},
+		{Name: "request-2", Kind: MiddlewareRequest},
+		{Name: "save", Kind: MiddlewareResponse},
+		{Name: "status-4", Kind: MiddlewareStatus},
+		{Name: "links", Kind: MiddlewareHtml, Selector: "a[href]"},
+	}, h.ListMiddlewares())
+}
+
+func TestHarvester_RemoveMiddleware(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithAllowRevisit(true))
+
+	var calls []string
+	h.RequestDoNamed("phase-1", func(req *Request) {
+		calls = append(calls, "request")
+	})
+	h.ResponseDoNamed("phase-1", func(res *Response) {
+		calls = append(calls, "response")
+	})
+	h.HtmlDoNamed("phase-1", "body", func(el *HtmlElement) {
+		calls = append(calls, "html")
+	})
+	h.ResponseDoNamed("always", func(res *Response) {
+		calls = append(calls, "always")
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/html"))
+	assert.Equal(t, []string{"request", "response", "always", "html"}, calls)
+
+	assert.True(t, h.RemoveMiddleware("phase-1"))
+	assert.False(t, h.RemoveMiddleware("phase-1"))
+	assert.Equal(t, []MiddlewareInfo{{Name: "always", Kind: MiddlewareResponse}}, h.ListMiddlewares())
+
+	calls = nil
+	assert.NoError(t, h.Visit(server.URL+"/html"))
+	assert.Equal(t, []string{"always"}, calls)
+}
+
+func TestHarvester_RemoveMiddleware_DuringCrawl(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(WithAllowRevisit(true))
+	h.ResponseDoNamed("removed", func(res *Response) {})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				h.Visit(server.URL + "/html")
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		h.ResponseDoNamed("removed", func(res *Response) {})
+		h.RemoveMiddleware("removed")
+	}
+	wg.Wait()
+
+	assert.Empty(t, h.ListMiddlewares())
+}
+
+func TestHarvester_MiddlewarePanic(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	d := &recordingDebugger{}
+	h := newTestHarvester(WithDebugger(d))
+	h.ResponseDoNamed("broken", func(res *Response) {
+		panic("boom")
+	})
+
+	assert.PanicsWithValue(t, "boom", func() {
+		h.Visit(server.URL + "/html")
+	})
+
+	last := d.events[len(d.events)-1]
+	assert.Equal(t, EventCallbackError, last.Type)
+	assert.Equal(t, "broken", last.Middleware)
+	assert.EqualError(t, last.Err, "middleware broken panicked: boom")
+}
+
+func TestHarvester_MiddlewarePriority(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester()
+
+	var calls []string
+	record := func(call string) func() {
+		return func() { calls = append(calls, call) }
+	}
+
+	for _, m := range []struct {
+		priority int
+		call     string
+	}{
+		{PriorityDefault, "default-1"},
+		{2 * PriorityBuiltin, "last"},
+		{-10, "first"},
+		{PriorityDefault, "default-2"},
+		{PriorityBuiltin, "builtin"},
+	} {
+		requestCall, responseCall, htmlCall := record("request:"+m.call), record("response:"+m.call), record("html:"+m.call)
+		h.RequestDoWithPriority(m.priority, func(req *Request) { requestCall() })
+		h.ResponseDoWithPriority(m.priority, func(res *Response) { responseCall() })
+		h.HtmlDoWithPriority(m.priority, "body", func(el *HtmlElement) { htmlCall() })
+	}
+	h.ResponseDo(func(res *Response) { calls = append(calls, "response:default-3") })
+
+	assert.NoError(t, h.Visit(server.URL))
+	assert.Equal(t, []string{
+		"request:first", "request:default-1", "request:default-2", "request:builtin", "request:last",
+		"response:first", "response:default-1", "response:default-2", "response:default-3", "response:builtin", "response:last",
+		"html:first", "html:default-1", "html:default-2", "html:builtin", "html:last",
+	}, calls)
+}
+
+func TestHarvester_MiddlewarePriority_Builtin(t *testing.T) {
+	h := newTestHarvester()
+
+	h.FollowLinkHeader("next")
+	h.ResponseDoNamed("save", func(res *Response) {})
+
+	assert.Equal(t, []MiddlewareInfo{
+		{Name: "save", Kind: MiddlewareResponse},
+		{Name: "link-header", Kind: MiddlewareResponse, Priority: PriorityBuiltin},
+	}, h.ListMiddlewares())
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// FollowJSONPagination follows cursor-based pagination of JSON responses. For every JSON response
+// the cursor is read from the field at the given dot path, e.g. "meta.next_cursor", and the URL built
+// from it with buildURL is visited as a link of the response, until the field is empty or missing.
+// The followed pages are subject to the allowed and disallowed URLs and to the depth limit, which
+// bounds the number of pages followed from the first page. The next page is followed by a response
+// middleware named "json-pagination" with PriorityBuiltin, after the middlewares with a lower priority.
+func (h *Harvester) FollowJSONPagination(nextField string, buildURL func(cursor string) string) {
+	path := strings.Split(nextField, ".")
+
+	h.addResponseMiddleware("json-pagination", PriorityBuiltin, func(res *Response) {
+		if !res.IsJSON() {
+			return
+		}
+
+		var v any
+		if err := json.Unmarshal(res.content, &v); err != nil {
+			return
+		}
+
+		cursor := jsonCursor(lookupJSONPath(v, path))
+		if cursor == "" {
+			return
+		}
+
+		next := buildURL(cursor)
+		if err := res.Visit(next); err != nil {
+			h.logger.Debug("error following pagination",
+				slog.String("url", res.Request.URL.String()),
+				slog.String("next", next),
+				slog.Any("error", err),
+			)
+		}
+	})
+}
+
+// FollowJSONLinks follows the URLs listed in JSON responses. For every JSON response the string values
+// at the given path are visited as links of the response, resolved against the URL of the response. The
+// path is a dot-separated list of object keys, each optionally followed by "[*]" for every element of an
+// array or by an index such as "[0]", e.g. "items[*].url" or "[*].links[*]" for a top-level array. Values
+// that are not strings are ignored, and the followed URLs are subject to the allowed and disallowed URLs
+// and to the depth limit. The links are followed by a response middleware named "json-links" with
+// PriorityBuiltin. An invalid path is logged and no links are followed.
+func (h *Harvester) FollowJSONLinks(jsonPath string) {
+	path, err := parseJSONPath(jsonPath)
+	if err != nil {
+		h.logger.Error("invalid JSON path", slog.String("path", jsonPath), slog.Any("error", err))
+		return
+	}
+
+	h.addResponseMiddleware("json-links", PriorityBuiltin, func(res *Response) {
+		if !res.IsJSON() {
+			return
+		}
+
+		var v any
+		if err := json.Unmarshal(res.content, &v); err != nil {
+			return
+		}
+
+		for _, link := range selectJSONPath(v, path) {
+			s, ok := link.(string)
+			if !ok {
+				continue
+			}
+
+			if err := res.Request.VisitRelative(s); err != nil {
+				h.logger.Debug("error following JSON link",
+					slog.String("url", res.Request.URL.String()),
+					slog.String("link", s),
+					slog.Any("error", err),
+				)
+			}
+		}
+	})
+}
+
+// jsonPathStep is a step of a path parsed with parseJSONPath: an object key, if not empty, followed by
+// array indexes, where an index of -1 selects every element.
+type jsonPathStep struct {
+	key     string
+	indexes []int
+}
+
+// parseJSONPath parses a path of FollowJSONLinks, such as "items[*].url".
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, nil
+	}
+
+	var steps []jsonPathStep
+	for _, segment := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(segment, "[")
+		step := jsonPathStep{key: key}
+
+		for rest != "" {
+			index, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("unclosed bracket in %q", segment)
+			}
+
+			if index == "*" {
+				step.indexes = append(step.indexes, -1)
+			} else {
+				n, err := strconv.Atoi(index)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid index %q in %q", index, segment)
+				}
+				step.indexes = append(step.indexes, n)
+			}
+
+			if after != "" && !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("unexpected %q after index in %q", after, segment)
+			}
+			rest = strings.TrimPrefix(after, "[")
+		}
+
+		if step.key == "" && len(step.indexes) == 0 {
+			return nil, fmt.Errorf("empty segment in %q", path)
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// selectJSONPath returns the values at the given path in a decoded JSON value.
+func selectJSONPath(v any, path []jsonPathStep) []any {
+	values := []any{v}
+	for _, step := range path {
+		var next []any
+		for _, v := range values {
+			if step.key != "" {
+				obj, ok := v.(map[string]any)
+				if !ok {
+					continue
+				}
+				if v, ok = obj[step.key]; !ok {
+					continue
+				}
+			}
+			next = append(next, selectJSONIndexes(v, step.indexes)...)
+		}
+		values = next
+	}
+
+	return values
+}
+
+// selectJSONIndexes returns the elements at the given indexes of nested arrays in a decoded JSON value.
+func selectJSONIndexes(v any, indexes []int) []any {
+	if len(indexes) == 0 {
+		return []any{v}
+	}
+
+	arr, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+
+	if i := indexes[0]; i >= 0 {
+		if i >= len(arr) {
+			return nil
+		}
+		return selectJSONIndexes(arr[i], indexes[1:])
+	}
+
+	var values []any
+	for _, elem := range arr {
+		values = append(values, selectJSONIndexes(elem, indexes[1:])...)
+	}
+	return values
+}
+
+// isJSONContentType reports whether the Content-Type header value is a JSON media type,
+// such as application/json or application/ld+json.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// lookupJSONPath returns the value at the given path of object keys in a decoded JSON value, nil if not found.
+func lookupJSONPath(v any, path []string) any {
+	for _, key := range path {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+
+	return v
+}
+
+// jsonCursor returns the string form of a decoded JSON string or number cursor, empty for other values.
+func jsonCursor(v any) string {
+	switch c := v.(type) {
+	case string:
+		return c
+	case float64:
+		return strconv.FormatFloat(c, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
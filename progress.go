@@ -0,0 +1,103 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"sync"
+	"time"
+)
+
+// ProgressCallback is a type for callbacks that are notified periodically with the crawl counters.
+type ProgressCallback func(s Stats)
+
+// progress reports the crawl counters periodically while the Harvester is crawling.
+type progress struct {
+	interval time.Duration
+	fn       ProgressCallback
+	active   int
+	stop     chan struct{}
+	done     chan struct{}
+	lock     *sync.Mutex
+}
+
+func newProgress(interval time.Duration, fn ProgressCallback) *progress {
+	return &progress{
+		interval: interval,
+		fn:       fn,
+		lock:     &sync.Mutex{},
+	}
+}
+
+// clone returns a new progress with the same configuration, or nil if p is nil.
+func (p *progress) clone() *progress {
+	if p == nil {
+		return nil
+	}
+
+	return newProgress(p.interval, p.fn)
+}
+
+// trackProgress starts reporting the progress when the first Visit starts and returns
+// a function that stops reporting when the last running Visit returns, with a final
+// report of the end state.
+func (h *Harvester) trackProgress() func() {
+	p := h.progress
+	if p == nil {
+		return func() {}
+	}
+
+	p.lock.Lock()
+	p.active++
+	if p.active == 1 {
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		go h.reportProgress(p.stop, p.done)
+	}
+	p.lock.Unlock()
+
+	return func() {
+		p.lock.Lock()
+		p.active--
+		if p.active > 0 {
+			p.lock.Unlock()
+			return
+		}
+
+		done := p.done
+		close(p.stop)
+		p.lock.Unlock()
+
+		// Wait and report outside the lock, so that the callback can start a new Visit.
+		<-done
+		p.fn(h.Stats())
+	}
+}
+
+func (h *Harvester) reportProgress(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(h.progress.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.progress.fn(h.Stats())
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,484 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestProxy returns a forward proxy relaying absolute-URI requests, counting the requests it relays
+// and recording the last Proxy-Authorization header.
+func newTestProxy(relayed *atomic.Int32, auth *atomic.Value) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		relayed.Add(1)
+		auth.Store(r.Header.Get("Proxy-Authorization"))
+
+		req, err := http.NewRequest(r.Method, r.URL.String(), r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+}
+
+// newTestAuthProxy returns a forward proxy supporting CONNECT tunnels that rejects the first request
+// with 407 Proxy Authentication Required, recording the Proxy-Authorization header of every request.
+func newTestAuthProxy(auths *[]string, lock *sync.Mutex) *httptest.Server {
+	var relayed atomic.Int32
+	var auth atomic.Value
+	relay := newTestProxy(&relayed, &auth).Config.Handler
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		*auths = append(*auths, r.Header.Get("Proxy-Authorization"))
+		first := len(*auths) == 1
+		lock.Unlock()
+
+		if first {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method != http.MethodConnect {
+			relay.ServeHTTP(w, r)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+		buf.Flush()
+
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+}
+
+func TestWithProxy(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var relayed atomic.Int32
+	var auth atomic.Value
+	proxy := newTestProxy(&relayed, &auth)
+	defer proxy.Close()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	t.Run("Option before WithClient", func(t *testing.T) {
+		relayed.Store(0)
+		h := NewHarvester(WithProxy(proxy.URL), WithClient(client), WithIgnoreRobots(true))
+
+		err := h.Visit(server.URL + "/html")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), relayed.Load())
+		assert.Nil(t, client.Transport, "the transport of the provided client is not modified")
+	})
+
+	t.Run("Option after WithClient", func(t *testing.T) {
+		relayed.Store(0)
+		h := NewHarvester(WithClient(client), WithProxy(proxy.URL), WithIgnoreRobots(true))
+
+		err := h.Visit(server.URL + "/html")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), relayed.Load())
+	})
+
+	t.Run("Authenticated proxy", func(t *testing.T) {
+		u, _ := url.Parse(proxy.URL)
+		u.User = url.UserPassword("user", "pass")
+		h := NewHarvester(WithClient(client), WithProxy(u.String()), WithIgnoreRobots(true))
+
+		err := h.Visit(server.URL + "/html")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Basic dXNlcjpwYXNz", auth.Load())
+	})
+
+	t.Run("Unreachable proxy", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		u, _ := url.Parse(closed.URL)
+		u.User = url.UserPassword("user", "secret")
+		h := NewHarvester(WithClient(client), WithProxy(u.String()), WithIgnoreRobots(true))
+
+		err := h.Visit(server.URL + "/html")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "proxy http://user:xxxxx@"+u.Host)
+		assert.False(t, strings.Contains(err.Error(), "secret"))
+	})
+
+	t.Run("Invalid proxy URL", func(t *testing.T) {
+		h := NewHarvester(WithClient(client), WithProxy("://bad"), WithIgnoreRobots(true))
+
+		err := h.Visit(server.URL + "/html")
+
+		assert.ErrorContains(t, err, "invalid proxy URL")
+	})
+
+	t.Run("WithTransport", func(t *testing.T) {
+		relayed.Store(0)
+		transport := &http.Transport{MaxIdleConnsPerHost: 1}
+		h := NewHarvester(WithTransport(transport), WithProxy(proxy.URL), WithIgnoreRobots(true))
+
+		err := h.Visit(server.URL + "/html")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), relayed.Load())
+		assert.Nil(t, transport.Proxy, "the provided transport is not modified")
+	})
+
+	t.Run("Unsupported transport", func(t *testing.T) {
+		relayed.Store(0)
+		rt := &countingRoundTripper{}
+		h := NewHarvester(WithTransport(rt), WithProxy(proxy.URL), WithProxyCredentials("user", "pass"))
+
+		err := h.Visit(server.URL + "/html")
+
+		assert.ErrorContains(t, err, "proxy requires an *http.Transport")
+		assert.Empty(t, rt.paths, "no request is sent without the proxy")
+		assert.Zero(t, relayed.Load())
+	})
+}
+
+func TestWithProxyPool(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var relayedA, relayedB atomic.Int32
+	var auth atomic.Value
+	proxyA := newTestProxy(&relayedA, &auth)
+	defer proxyA.Close()
+	proxyB := newTestProxy(&relayedB, &auth)
+	defer proxyB.Close()
+
+	t.Run("Round-robin", func(t *testing.T) {
+		h := newTestHarvester(WithProxyPool([]string{proxyA.URL, proxyB.URL}), WithIgnoreRobots(true), WithAllowRevisit(true))
+
+		var proxies []string
+		h.ResponseDo(func(res *Response) {
+			proxies = append(proxies, res.Request.Proxy.String())
+		})
+
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, h.Visit(server.URL+"/html"))
+		}
+
+		assert.Equal(t, []string{proxyA.URL, proxyB.URL, proxyA.URL, proxyB.URL}, proxies)
+	})
+
+	t.Run("Ejection", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		relayedA.Store(0)
+		h := newTestHarvester(
+			WithProxyPool([]string{closed.URL, proxyA.URL}, WithProxyEjection(1, time.Minute)),
+			WithIgnoreRobots(true),
+			WithAllowRevisit(true),
+		)
+		now := time.Now()
+		h.proxyPool.now = func() time.Time { return now }
+
+		err := h.Visit(server.URL + "/html")
+		assert.ErrorContains(t, err, "proxy "+closed.URL)
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, h.Visit(server.URL+"/html"))
+		}
+		assert.Equal(t, int32(3), relayedA.Load())
+
+		now = now.Add(time.Minute)
+		err = h.Visit(server.URL + "/html")
+		assert.ErrorContains(t, err, "proxy "+closed.URL, "the proxy is re-admitted after the cooldown")
+	})
+}
+
+func TestProxyPool_Rotation(t *testing.T) {
+	req := func(host string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+	}
+	hosts := func(pool *ProxyPool, hosts ...string) []string {
+		picked := make([]string, 0, len(hosts))
+		for _, host := range hosts {
+			u, err := pool.Proxy(req(host))
+			assert.NoError(t, err)
+			picked = append(picked, u.Host)
+		}
+		return picked
+	}
+
+	t.Run("Weighted", func(t *testing.T) {
+		pool, err := NewProxyPool([]string{"http://a:1", "http://b:1"}, WithWeightedRotation(2, 1))
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"a:1", "b:1", "a:1", "a:1", "b:1", "a:1"}, hosts(pool, "x", "x", "x", "x", "x", "x"))
+	})
+
+	t.Run("Sticky", func(t *testing.T) {
+		pool, err := NewProxyPool([]string{"http://a:1", "http://b:1"}, WithStickyRotation())
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"a:1", "b:1", "a:1", "b:1"}, hosts(pool, "x", "y", "x", "y"))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewProxyPool(nil)
+		assert.Error(t, err)
+
+		_, err = NewProxyPool([]string{"://bad"})
+		assert.ErrorContains(t, err, "invalid proxy URL")
+	})
+}
+
+func TestWithProxyFunc(t *testing.T) {
+	serverA := newTestServer()
+	defer serverA.Close()
+	serverB := newTestServer()
+	defer serverB.Close()
+
+	var relayedA, relayedB atomic.Int32
+	var auth atomic.Value
+	proxyA := newTestProxy(&relayedA, &auth)
+	defer proxyA.Close()
+	proxyB := newTestProxy(&relayedB, &auth)
+	defer proxyB.Close()
+
+	hostA := strings.TrimPrefix(serverA.URL, "http://")
+	proxyAURL, _ := url.Parse(proxyA.URL)
+
+	var calls atomic.Int32
+	fn := func(req *http.Request) (*url.URL, error) {
+		calls.Add(1)
+		if req.URL.Host == hostA {
+			return proxyAURL, nil
+		}
+		return nil, nil
+	}
+
+	h := NewHarvester(
+		WithProxyFunc(fn),
+		WithProxy(proxyB.URL),
+		WithClient(&http.Client{Timeout: 10 * time.Second}),
+		WithAllowRevisit(true),
+	)
+
+	proxies := make(map[string]*url.URL)
+	h.ResponseDo(func(res *Response) {
+		proxies[res.Request.Host] = res.Request.Proxy
+	})
+
+	assert.NoError(t, h.Visit(serverA.URL+"/html"))
+	assert.NoError(t, h.Visit(serverB.URL+"/html"))
+
+	assert.Equal(t, proxyAURL, proxies[hostA])
+	assert.Nil(t, proxies[strings.TrimPrefix(serverB.URL, "http://")])
+	assert.Equal(t, int32(2), relayedA.Load(), "the robots.txt and the page of server A are proxied")
+	assert.Equal(t, int32(0), relayedB.Load(), "the proxy func takes precedence over WithProxy")
+	assert.Equal(t, int32(4), calls.Load())
+
+	t.Run("Error", func(t *testing.T) {
+		h := NewHarvester(WithProxyFunc(func(*http.Request) (*url.URL, error) {
+			return nil, errors.New("no proxy for region")
+		}), WithIgnoreRobots(true))
+
+		err := h.Visit(serverA.URL + "/html")
+
+		assert.ErrorContains(t, err, "choosing proxy: no proxy for region")
+	})
+}
+
+func TestRequest_ProxyURL(t *testing.T) {
+	serverA := newTestServer()
+	defer serverA.Close()
+	serverB := newTestServer()
+	defer serverB.Close()
+
+	var relayedA, relayedB atomic.Int32
+	var auth atomic.Value
+	proxyA := newTestProxy(&relayedA, &auth)
+	defer proxyA.Close()
+	proxyB := newTestProxy(&relayedB, &auth)
+	defer proxyB.Close()
+
+	hostA := strings.TrimPrefix(serverA.URL, "http://")
+	hostB := strings.TrimPrefix(serverB.URL, "http://")
+	proxyAURL, _ := url.Parse(proxyA.URL)
+
+	t.Run("Direct", func(t *testing.T) {
+		relayedA.Store(0)
+
+		h := newTestHarvester(WithIgnoreRobots(true))
+		h.RequestDo(func(req *Request) {
+			if req.Host == hostA {
+				req.ProxyURL = proxyAURL
+			}
+		})
+
+		proxies := make(map[string]string)
+		h.ResponseDo(func(res *Response) {
+			proxies[res.Request.Host] = res.ProxyUsed()
+		})
+
+		assert.NoError(t, h.Visit(serverA.URL+"/html"))
+		assert.NoError(t, h.Visit(serverB.URL+"/html"))
+
+		assert.Equal(t, map[string]string{hostA: proxyA.URL, hostB: "direct"}, proxies)
+		assert.Equal(t, int32(1), relayedA.Load())
+	})
+
+	t.Run("OverridesProxy", func(t *testing.T) {
+		relayedA.Store(0)
+		relayedB.Store(0)
+
+		h := newTestHarvester(WithIgnoreRobots(true), WithProxy(proxyB.URL))
+		h.RequestDo(func(req *Request) {
+			if req.Host == hostA {
+				req.ProxyURL = proxyAURL
+			}
+		})
+
+		assert.NoError(t, h.Visit(serverA.URL+"/html"))
+		assert.NoError(t, h.Visit(serverB.URL+"/html"))
+
+		assert.Equal(t, int32(1), relayedA.Load())
+		assert.Equal(t, int32(1), relayedB.Load())
+	})
+
+	t.Run("KeepsClient", func(t *testing.T) {
+		relayedA.Store(0)
+
+		client := &http.Client{Timeout: 10 * time.Second}
+		h := NewHarvester(WithClient(client), WithIgnoreRobots(true))
+		h.RequestDo(func(req *Request) {
+			if req.Host == hostA {
+				req.ProxyURL = proxyAURL
+			}
+		})
+
+		assert.NoError(t, h.Visit(serverA.URL+"/html"))
+		assert.NoError(t, h.Visit(serverB.URL+"/html"))
+
+		assert.Same(t, client, h.Client, "the client is not replaced without proxy options")
+		assert.Nil(t, client.Transport)
+		assert.Equal(t, int32(1), relayedA.Load())
+		assert.Same(t, http.DefaultClient, NewHarvester().Client)
+	})
+}
+
+func TestWithProxyCredentials(t *testing.T) {
+	tests := []struct {
+		name      string
+		newServer func() *httptest.Server
+	}{
+		{"Plain request", newTestServer},
+		{"CONNECT tunnel", func() *httptest.Server {
+			server := newUnstartedTestServer()
+			server.StartTLS()
+			return server
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := tt.newServer()
+			defer server.Close()
+
+			var auths []string
+			var lock sync.Mutex
+			proxy := newTestAuthProxy(&auths, &lock)
+			defer proxy.Close()
+
+			d := &recordingDebugger{}
+			h := NewHarvester(
+				WithClient(server.Client()),
+				WithProxy(proxy.URL),
+				WithProxyCredentials("user", "secret"),
+				WithIgnoreRobots(true),
+				WithDebugger(d),
+			)
+
+			var statusCode int
+			h.ResponseDo(func(res *Response) {
+				statusCode = res.StatusCode
+			})
+
+			err := h.Visit(server.URL + "/html")
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, statusCode)
+			assert.Equal(t, []string{"Basic dXNlcjpzZWNyZXQ=", "Basic dXNlcjpzZWNyZXQ="}, auths)
+			for _, e := range d.events {
+				assert.NotContains(t, fmt.Sprint(e), "secret")
+			}
+		})
+	}
+
+	t.Run("Credentials are not echoed in errors", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		h := NewHarvester(WithProxy(closed.URL), WithProxyCredentials("user", "secret"), WithIgnoreRobots(true))
+
+		err := h.Visit("http://example.com/")
+
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "secret")
+	})
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ProxyRotation is the strategy a ProxyPool uses to pick the proxy of a request.
+type ProxyRotation int
+
+const (
+	// RoundRobinRotation picks the proxies of the pool in turn.
+	RoundRobinRotation ProxyRotation = iota
+	// WeightedRotation picks the proxies of the pool in proportion to their weights.
+	WeightedRotation
+	// StickyRotation picks a proxy for each host in turn and keeps using it for the host.
+	StickyRotation
+)
+
+const (
+	// defaultProxyMaxFailures is the default number of consecutive connection failures ejecting a proxy.
+	defaultProxyMaxFailures = 3
+	// defaultProxyCooldown is the default time an ejected proxy is not used.
+	defaultProxyCooldown = time.Minute
+)
+
+// ProxyPoolOption is a type for functional options configuring a ProxyPool.
+type ProxyPoolOption func(p *ProxyPool)
+
+// ProxyPool rotates requests over a list of proxies. A proxy failing to connect the given number of
+// times in a row is ejected from the rotation and re-admitted after a cooldown. If every proxy is
+// ejected, the proxy re-admitted first is used. A ProxyPool is safe for concurrent use.
+type ProxyPool struct {
+	proxies     []*poolProxy
+	rotation    ProxyRotation
+	maxFailures int
+	cooldown    time.Duration
+	next        int
+	hosts       map[string]*poolProxy
+	now         func() time.Time
+	lock        sync.Mutex
+}
+
+// poolProxy is a proxy of a ProxyPool with its rotation and failure state.
+type poolProxy struct {
+	url           *url.URL
+	weight        int
+	currentWeight int
+	failures      int
+	ejectedUntil  time.Time
+}
+
+// WithWeightedRotation is a ProxyPoolOption picking the proxies in proportion to the given weights,
+// in the order of the proxy URLs. Proxies without a positive weight have a weight of 1.
+func WithWeightedRotation(weights ...int) ProxyPoolOption {
+	return func(p *ProxyPool) {
+		p.rotation = WeightedRotation
+		for i, proxy := range p.proxies {
+			if i < len(weights) && weights[i] > 0 {
+				proxy.weight = weights[i]
+			}
+		}
+	}
+}
+
+// WithStickyRotation is a ProxyPoolOption using the same proxy for every request to a host.
+func WithStickyRotation() ProxyPoolOption {
+	return func(p *ProxyPool) {
+		p.rotation = StickyRotation
+	}
+}
+
+// WithProxyEjection is a ProxyPoolOption setting the number of consecutive connection failures
+// ejecting a proxy, and the cooldown after which it is re-admitted. The default is 3 failures and a
+// cooldown of one minute.
+func WithProxyEjection(maxFailures int, cooldown time.Duration) ProxyPoolOption {
+	return func(p *ProxyPool) {
+		p.maxFailures = maxFailures
+		p.cooldown = cooldown
+	}
+}
+
+// NewProxyPool creates a new ProxyPool over the given proxy URLs, rotating round-robin by default.
+func NewProxyPool(urls []string, options ...ProxyPoolOption) (*ProxyPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("proxy pool is empty")
+	}
+
+	p := &ProxyPool{
+		proxies:     make([]*poolProxy, 0, len(urls)),
+		maxFailures: defaultProxyMaxFailures,
+		cooldown:    defaultProxyCooldown,
+		hosts:       make(map[string]*poolProxy),
+		now:         time.Now,
+	}
+
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err == nil && u.Host == "" {
+			err = errors.New("missing host")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", raw, err)
+		}
+
+		p.proxies = append(p.proxies, &poolProxy{url: u, weight: 1})
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p, nil
+}
+
+// WithProxyPool is a functional option that rotates the requests over the proxies at the given URLs
+// with a ProxyPool. The proxy serving a request is recorded in Request.Proxy. An invalid proxy URL
+// fails every request.
+func WithProxyPool(urls []string, options ...ProxyPoolOption) Options {
+	return func(h *Harvester) {
+		pool, err := NewProxyPool(urls, options...)
+		if err != nil {
+			h.proxy = func(*http.Request) (*url.URL, error) {
+				return nil, err
+			}
+			h.proxyURL, h.proxyPool = nil, nil
+			return
+		}
+
+		h.proxy = pool.Proxy
+		h.proxyURL, h.proxyPool = nil, pool
+	}
+}
+
+// Proxy is a ProxyFunc returning the next proxy of the pool for the request.
+func (p *ProxyPool) Proxy(req *http.Request) (*url.URL, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+
+	switch p.rotation {
+	case WeightedRotation:
+		return p.nextWeighted(now).url, nil
+	case StickyRotation:
+		proxy, ok := p.hosts[req.URL.Host]
+		if !ok || proxy.ejected(now) {
+			proxy = p.nextRoundRobin(now)
+			p.hosts[req.URL.Host] = proxy
+		}
+		return proxy.url, nil
+	default:
+		return p.nextRoundRobin(now).url, nil
+	}
+}
+
+// Report records the outcome of a request sent through the proxy, ejecting the proxy
+// once it has failed to connect the configured number of times in a row.
+func (p *ProxyPool) Report(proxy *url.URL, err error) {
+	if proxy == nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, pp := range p.proxies {
+		if pp.url.String() != proxy.String() {
+			continue
+		}
+
+		if !isProxyConnectError(err) {
+			pp.failures = 0
+			return
+		}
+
+		pp.failures++
+		if p.maxFailures > 0 && pp.failures >= p.maxFailures {
+			pp.failures = 0
+			pp.ejectedUntil = p.now().Add(p.cooldown)
+		}
+		return
+	}
+}
+
+// nextRoundRobin returns the next admitted proxy in turn.
+func (p *ProxyPool) nextRoundRobin(now time.Time) *poolProxy {
+	for range p.proxies {
+		proxy := p.proxies[p.next%len(p.proxies)]
+		p.next++
+		if !proxy.ejected(now) {
+			return proxy
+		}
+	}
+
+	return p.firstReadmitted()
+}
+
+// nextWeighted returns the next admitted proxy with smooth weighted round-robin,
+// spreading the picks of a proxy evenly over the rotation.
+func (p *ProxyPool) nextWeighted(now time.Time) *poolProxy {
+	var best *poolProxy
+	total := 0
+	for _, proxy := range p.proxies {
+		if proxy.ejected(now) {
+			continue
+		}
+
+		proxy.currentWeight += proxy.weight
+		total += proxy.weight
+		if best == nil || proxy.currentWeight > best.currentWeight {
+			best = proxy
+		}
+	}
+
+	if best == nil {
+		return p.firstReadmitted()
+	}
+
+	best.currentWeight -= total
+	return best
+}
+
+// firstReadmitted returns the ejected proxy whose cooldown ends first.
+func (p *ProxyPool) firstReadmitted() *poolProxy {
+	first := p.proxies[0]
+	for _, proxy := range p.proxies[1:] {
+		if proxy.ejectedUntil.Before(first.ejectedUntil) {
+			first = proxy
+		}
+	}
+
+	return first
+}
+
+// ejected reports whether the proxy is ejected from the rotation at the given time.
+func (pp *poolProxy) ejected(now time.Time) bool {
+	return now.Before(pp.ejectedUntil)
+}
+
+// isProxyConnectError reports whether the error is a failure to connect to the proxy.
+func isProxyConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "proxyconnect"
+}
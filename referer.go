@@ -0,0 +1,87 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import "net/url"
+
+// Referer policies supported by the WithRefererPolicy functional option.
+// See https://www.w3.org/TR/referrer-policy/ for the semantics of each policy.
+const (
+	RefererPolicyNoReferrer                  = "no-referrer"
+	RefererPolicyNoReferrerWhenDowngrade     = "no-referrer-when-downgrade"
+	RefererPolicyOrigin                      = "origin"
+	RefererPolicyOriginWhenCrossOrigin       = "origin-when-cross-origin"
+	RefererPolicySameOrigin                  = "same-origin"
+	RefererPolicyStrictOrigin                = "strict-origin"
+	RefererPolicyStrictOriginWhenCrossOrigin = "strict-origin-when-cross-origin"
+	RefererPolicyUnsafeURL                   = "unsafe-url"
+)
+
+// refererFor returns the Referer header value to send when following a link from
+// the page at `from` to `to` according to the given policy. An empty string means
+// no Referer header should be sent.
+func refererFor(policy string, from, to *url.URL) string {
+	if from == nil || (from.Scheme != "http" && from.Scheme != "https") {
+		return ""
+	}
+
+	full := *from
+	full.User = nil
+	full.Fragment = ""
+	full.RawFragment = ""
+
+	origin := (&url.URL{Scheme: from.Scheme, Host: from.Host, Path: "/"}).String()
+
+	sameOrigin := from.Scheme == to.Scheme && from.Host == to.Host
+	downgrade := from.Scheme == "https" && to.Scheme != "https"
+
+	switch policy {
+	case RefererPolicyNoReferrer:
+		return ""
+	case RefererPolicyNoReferrerWhenDowngrade:
+		if downgrade {
+			return ""
+		}
+		return full.String()
+	case RefererPolicyOrigin:
+		return origin
+	case RefererPolicyOriginWhenCrossOrigin:
+		if sameOrigin {
+			return full.String()
+		}
+		return origin
+	case RefererPolicySameOrigin:
+		if sameOrigin {
+			return full.String()
+		}
+		return ""
+	case RefererPolicyStrictOrigin:
+		if downgrade {
+			return ""
+		}
+		return origin
+	case RefererPolicyUnsafeURL:
+		return full.String()
+	default: // RefererPolicyStrictOriginWhenCrossOrigin
+		if sameOrigin {
+			return full.String()
+		}
+		if downgrade {
+			return ""
+		}
+		return origin
+	}
+}
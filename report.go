@@ -0,0 +1,138 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"sort"
+)
+
+// BrokenLink is an entry of the broken link report: a link target that returned a 4xx or 5xx
+// status code or failed at the network level, with the pages that linked to it.
+type BrokenLink struct {
+	// URL is the URL of the broken link target.
+	URL string `json:"url"`
+	// StatusCode is the status code of the target, 0 if the request failed without a response.
+	StatusCode int `json:"status_code,omitempty"`
+	// Error is the error of the request, empty if the target responded.
+	Error string `json:"error,omitempty"`
+	// Referrers are the URLs of the pages linking to the target.
+	Referrers []string `json:"referrers"`
+	// AnchorTexts are the distinct non-empty anchor texts of the links to the target.
+	AnchorTexts []string `json:"anchor_texts,omitempty"`
+}
+
+// linkOutcome is the outcome of requesting a link target.
+type linkOutcome struct {
+	statusCode int
+	err        error
+}
+
+func (o linkOutcome) broken() bool {
+	return o.err != nil || o.statusCode >= http.StatusBadRequest
+}
+
+// recordOutcome records the outcome of requesting the URL for the broken link report.
+func (g *LinkGraph) recordOutcome(u string, statusCode int, err error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.outcomes[u] = linkOutcome{statusCode: statusCode, err: err}
+}
+
+func (g *LinkGraph) outcome(u string) (linkOutcome, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	o, ok := g.outcomes[u]
+	return o, ok
+}
+
+// BrokenLinkReport returns every link target in the link graph that returned a 4xx or 5xx status
+// code or failed at the network level, together with the pages that linked to it, sorted by URL.
+// If WithCheckExternalLinks is enabled, link targets that were not crawled, such as external links
+// filtered out by the allowed URLs, are checked with a HEAD request. Returns nil if the link graph
+// is not enabled with the WithLinkGraph functional option.
+func (h *Harvester) BrokenLinkReport() []BrokenLink {
+	if h.graph == nil {
+		return nil
+	}
+
+	report := make(map[string]*BrokenLink)
+
+	for e := range h.graph.All() {
+		o, ok := h.graph.outcome(e.To)
+		if !ok && h.checkExternalLinks {
+			o = h.checkLink(e.To)
+			h.graph.recordOutcome(e.To, o.statusCode, o.err)
+			ok = true
+		}
+
+		if !ok || !o.broken() {
+			continue
+		}
+
+		entry, exists := report[e.To]
+		if !exists {
+			entry = &BrokenLink{URL: e.To, StatusCode: o.statusCode}
+			if o.err != nil {
+				entry.Error = o.err.Error()
+			}
+			report[e.To] = entry
+		}
+
+		entry.Referrers = appendUnique(entry.Referrers, e.From)
+		if e.AnchorText != "" {
+			entry.AnchorTexts = appendUnique(entry.AnchorTexts, e.AnchorText)
+		}
+	}
+
+	links := make([]BrokenLink, 0, len(report))
+	for _, entry := range report {
+		links = append(links, *entry)
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].URL < links[j].URL
+	})
+
+	return links
+}
+
+// checkLink checks the link target with a HEAD request.
+func (h *Harvester) checkLink(u string) linkOutcome {
+	req, err := http.NewRequestWithContext(h.Context, http.MethodHead, u, http.NoBody)
+	if err != nil {
+		return linkOutcome{err: err}
+	}
+
+	res, err := h.Client.Do(req)
+	if err != nil {
+		return linkOutcome{err: err}
+	}
+	h.closeBody(res)
+
+	return linkOutcome{statusCode: res.StatusCode}
+}
+
+func appendUnique(s []string, v string) []string {
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
@@ -16,13 +16,19 @@ limitations under the License.
 package grawlr
 
 import (
-	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
+// Request is a representation of a request made by a Harvester. Referrer is the URL of the
+// page the request was followed from, nil for requests started with Harvester.Visit. ProxyURL
+// can be set by request middlewares to send the request through the given proxy instead of the
+// proxy options of the Harvester. Proxy is the proxy that served the request, nil if it was sent
+// directly. The Request keeps the URL of the page after redirects for the link graph and the
+// response body bytes it holds for WithMaxInFlightBytes.
 type Request struct {
 	URL       *url.URL
 	BaseURL   *url.URL
@@ -31,33 +37,125 @@ type Request struct {
 	Method    string
 	Body      io.Reader
 	Depth     int
+	Referrer  *url.URL
+	ProxyURL  *url.URL
+	Proxy     *url.URL
+	maxDepth  int
 	harvester *Harvester
+	finalURL  *url.URL
+	inFlight  *byteHold
 }
 
-// GetAbsoluteURL returns the absolute URL for a link found on the page.
+// nonNavigableSchemes is a list of URL schemes that do not point to a fetchable
+// web page and are skipped when resolving links found on a page.
+var nonNavigableSchemes = []string{"data:", "blob:", "javascript:", "mailto:", "tel:"}
+
+// GetAbsoluteURL returns the absolute URL for a link found on the page without its fragment.
+// The link is resolved against the BaseURL of the request, set from the <base href> of the page,
+// or the URL of the request if the page has no base URL.
+// Fragment-only links and links with a non-navigable scheme (data:, blob:,
+// javascript:, mailto:, tel:) resolve to an empty string.
 func (r *Request) GetAbsoluteURL(link string) string {
-	if strings.HasPrefix(link, "#") {
+	if isNonNavigableLink(link) {
 		return ""
 	}
 
-	base, err := url.Parse(r.URL.String())
+	baseURL := r.URL
+	if r.BaseURL != nil {
+		baseURL = r.BaseURL
+	}
+
+	base, err := url.Parse(baseURL.String())
 	if err != nil {
-		fmt.Printf("Error parsing base URL: %s", err)
+		r.logger().Warn("error parsing base URL", slog.String("url", baseURL.String()), slog.Any("error", err))
 		return ""
 	}
 
 	href, err := url.Parse(link)
 	if err != nil {
-		fmt.Printf("Error parsing href: %s", err)
+		r.logger().Warn("error parsing href", slog.String("url", r.URL.String()), slog.String("href", link), slog.Any("error", err))
 		return ""
 	}
 
-	absoluteURL := base.ResolveReference(href)
+	// A fragment-only link points to the current page.
+	if ref := withoutFragment(href); ref.String() == "" && strings.Contains(link, "#") {
+		return ""
+	}
+
+	absoluteURL := withoutFragment(base.ResolveReference(href))
 	return absoluteURL.String()
 }
 
 // Visit continues the crawling process by visiting a new URL
 // preserving the current request context.
 func (r *Request) Visit(u string) error {
-	return r.harvester.fetch(u, r.Method, r.Depth+1)
+	return r.follow(u, "", false)
+}
+
+// VisitRelative resolves the given link against the page of the request and visits it like Visit.
+// Empty links and links that resolve to an empty URL, such as fragment-only links, are ignored.
+func (r *Request) VisitRelative(href string) error {
+	if strings.TrimSpace(href) == "" {
+		return nil
+	}
+
+	absURL := r.GetAbsoluteURL(href)
+	if absURL == "" {
+		return nil
+	}
+
+	return r.Visit(absURL)
+}
+
+// follow visits the URL of a link found on the page of the request,
+// recording the link from the final URL of the page in the link graph if it is enabled.
+func (r *Request) follow(u, anchorText string, noFollow bool) error {
+	if g := r.harvester.graph; g != nil {
+		from := r.URL
+		if r.finalURL != nil {
+			from = r.finalURL
+		}
+
+		if target, err := r.URL.Parse(u); err == nil {
+			g.addEdge(Edge{
+				From:       from.String(),
+				To:         target.String(),
+				AnchorText: anchorText,
+				NoFollow:   noFollow,
+			})
+		}
+	}
+
+	// The page gives back its in-flight bytes before the link waits for them to be available,
+	// or a callback visiting a link would wait for the bytes of its own page.
+	r.inFlight.release()
+
+	return r.harvester.fetch(u, r.Method, r.Depth+1, r.maxDepth, r.URL)
+}
+
+// isNonNavigableLink reports whether the link uses a scheme that cannot be fetched.
+func isNonNavigableLink(link string) bool {
+	l := strings.ToLower(strings.TrimSpace(link))
+	for _, scheme := range nonNavigableSchemes {
+		if strings.HasPrefix(l, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutFragment returns a copy of the URL with the fragment removed.
+func withoutFragment(u *url.URL) *url.URL {
+	c := *u
+	c.Fragment = ""
+	c.RawFragment = ""
+	return &c
+}
+
+// logger returns the logger of the Harvester that created the request.
+func (r *Request) logger() *slog.Logger {
+	if r.harvester == nil {
+		return slog.Default()
+	}
+	return r.harvester.logger
 }
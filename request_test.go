@@ -0,0 +1,52 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequest_GetAbsoluteURL(t *testing.T) {
+	base, _ := url.Parse("https://example.com/path/index.html")
+	req := &Request{URL: base}
+
+	tests := []struct {
+		link     string
+		expected string
+	}{
+		{"/about", "https://example.com/about"},
+		{"page2", "https://example.com/path/page2"},
+		{"https://other.com/", "https://other.com/"},
+		{"#section", ""},
+		{"#", ""},
+		{"page2#section", "https://example.com/path/page2"},
+		{"/about?q=1#top", "https://example.com/about?q=1"},
+		{"", "https://example.com/path/index.html"},
+		{"data:image/png;base64,iVBORw0KGgo=", ""},
+		{"blob:https://example.com/550e8400-e29b-41d4-a716-446655440000", ""},
+		{"javascript:void(0)", ""},
+		{"JavaScript:alert(1)", ""},
+		{"mailto:someone@example.com", ""},
+		{"tel:+358401234567", ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, req.GetAbsoluteURL(tt.link), tt.link)
+	}
+}
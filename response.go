@@ -17,13 +17,130 @@ package grawlr
 
 import (
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// Response is a representation of the response from a Harvester.
+// Response is a representation of the response from a Harvester. Truncated is true if the body
+// was cut short because a download budget was used up.
 type Response struct {
 	StatusCode int
 	Headers    *http.Header
 	Request    *Request
 	Body       io.Reader
+	Trace      *Trace
+	Truncated  bool
+	content    []byte
+	hasher     ContentHasher
+	pool       *bufferPool
+}
+
+// ProxyUsed returns the URL of the proxy that served the response with its password redacted,
+// or "direct" if the request was sent without a proxy.
+func (r *Response) ProxyUsed() string {
+	if r.Request == nil || r.Request.Proxy == nil {
+		return "direct"
+	}
+
+	return r.Request.Proxy.Redacted()
+}
+
+// Visit continues the crawling process by visiting a new URL found on the page of the response.
+// It is a shorthand for Request.Visit.
+func (r *Response) Visit(u string) error {
+	return r.Request.Visit(u)
+}
+
+// ContentType returns the media type of the Content-Type header of the response in lowercase and
+// without parameters, e.g. "text/html". Returns an empty string if the header is missing or invalid.
+func (r *Response) ContentType() string {
+	mediaType, _, err := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+// IsHTML reports whether the response is an HTML document, text/html or application/xhtml+xml.
+func (r *Response) IsHTML() bool {
+	contentType := r.ContentType()
+	return contentType == "text/html" || contentType == "application/xhtml+xml"
+}
+
+// IsJSON reports whether the response is a JSON document, application/json or a +json media type
+// such as application/ld+json.
+func (r *Response) IsJSON() bool {
+	return isJSONContentType(r.Headers.Get("Content-Type"))
+}
+
+// Location returns the raw value of the Location header of the response.
+func (r *Response) Location() string {
+	return r.Headers.Get("Location")
+}
+
+// RedirectURL returns the absolute target URL of a redirect response, resolved
+// from the Location header against the request URL. Returns an empty string if
+// the response has no Location header.
+func (r *Response) RedirectURL() string {
+	location := r.Location()
+	if location == "" {
+		return ""
+	}
+
+	return r.Request.GetAbsoluteURL(location)
+}
+
+// Age returns how stale the response is relative to when it was generated by
+// the origin server, as described in RFC 7234 section 4.2.3. It is the larger of
+// the Age header value and the time elapsed since the Date header. Returns 0 if
+// neither header is present or valid.
+func (r *Response) Age() time.Duration {
+	var age time.Duration
+
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(r.Headers.Get("Age")), 10, 64); err == nil && seconds > 0 {
+		age = time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(r.Headers.Get("Date")); err == nil {
+		if apparentAge := time.Since(date); apparentAge > age {
+			age = apparentAge
+		}
+	}
+
+	return age
+}
+
+// MaxAge returns the max-age directive of the Cache-Control header of the response.
+// The boolean is false if the header does not contain a valid max-age directive.
+func (r *Response) MaxAge() (time.Duration, bool) {
+	for _, directive := range strings.Split(r.Headers.Get("Cache-Control"), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(directive), "=")
+		if !found || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+		if err != nil || seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	return 0, false
+}
+
+// ContentHash returns the hash of the response body computed with the ContentHasher of the
+// Harvester, which defaults to a 64-bit FNV-1a hash. See WithContentHasher.
+func (r *Response) ContentHash() string {
+	hasher := r.hasher
+	if hasher == nil {
+		hasher = FNVContentHasher
+	}
+
+	return hasher(r.content)
 }
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponse_Age(t *testing.T) {
+	headers := http.Header{}
+	res := &Response{Headers: &headers}
+
+	assert.Equal(t, time.Duration(0), res.Age())
+
+	headers.Set("Age", "120")
+	assert.Equal(t, 120*time.Second, res.Age())
+
+	headers.Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Hour, res.Age(), float64(5*time.Second))
+
+	headers.Set("Age", "7200")
+	assert.Equal(t, 2*time.Hour, res.Age())
+}
+
+func TestResponse_MaxAge(t *testing.T) {
+	headers := http.Header{}
+	res := &Response{Headers: &headers}
+
+	_, ok := res.MaxAge()
+	assert.False(t, ok)
+
+	headers.Set("Cache-Control", "public, max-age=3600, must-revalidate")
+	maxAge, ok := res.MaxAge()
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, maxAge)
+
+	headers.Set("Cache-Control", `Max-Age="60"`)
+	maxAge, ok = res.MaxAge()
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, maxAge)
+
+	headers.Set("Cache-Control", "no-store, max-age=abc")
+	_, ok = res.MaxAge()
+	assert.False(t, ok)
+}
+
+func TestResponse_ContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+		isHTML      bool
+		isJSON      bool
+	}{
+		{"text/html; charset=utf-8", "text/html", true, false},
+		{"Text/HTML", "text/html", true, false},
+		{"application/xhtml+xml", "application/xhtml+xml", true, false},
+		{"application/json", "application/json", false, true},
+		{"application/ld+json; charset=utf-8", "application/ld+json", false, true},
+		{"text/plain", "text/plain", false, false},
+		{"", "", false, false},
+		{"invalid;;", "", false, false},
+	}
+
+	for _, tt := range tests {
+		headers := http.Header{}
+		headers.Set("Content-Type", tt.contentType)
+		res := &Response{Headers: &headers}
+
+		assert.Equal(t, tt.want, res.ContentType(), tt.contentType)
+		assert.Equal(t, tt.isHTML, res.IsHTML(), tt.contentType)
+		assert.Equal(t, tt.isJSON, res.IsJSON(), tt.contentType)
+	}
+}
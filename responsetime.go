@@ -0,0 +1,95 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrResponseTooSlow is returned when the body of a response is not read within the maximum response time.
+var ErrResponseTooSlow = func(u string, d time.Duration) error {
+	return fmt.Errorf("response body of %s was not read within %s", u, d)
+}
+
+// WithMaxResponseTime is a functional option that aborts reading a response body that takes longer than
+// the given duration, failing the request with ErrResponseTooSlow, to protect the crawl from servers
+// that send the headers quickly and then stall the body. The duration is counted from the arrival of the
+// headers, unlike the Timeout of the client, which covers the whole exchange. The request is canceled
+// when the duration elapses, which closes its connection.
+func WithMaxResponseTime(d time.Duration) Options {
+	return func(h *Harvester) {
+		h.maxResponseTime = d
+	}
+}
+
+// responseTimer cancels a request with ErrResponseTooSlow if its body is not read in time.
+// A nil responseTimer does nothing.
+type responseTimer struct {
+	d      time.Duration
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	err    error
+	timer  *time.Timer
+}
+
+// responseTimer returns a copy of the request that is canceled by the returned timer, or the request
+// and a nil timer if the Harvester has no maximum response time.
+func (h *Harvester) responseTimer(req *http.Request) (*http.Request, *responseTimer) {
+	if h.maxResponseTime <= 0 {
+		return req, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	t := &responseTimer{
+		d:      h.maxResponseTime,
+		ctx:    ctx,
+		cancel: cancel,
+		err:    ErrResponseTooSlow(req.URL.String(), h.maxResponseTime),
+	}
+
+	return req.WithContext(ctx), t
+}
+
+// start starts the timer when the headers of the response have arrived.
+func (t *responseTimer) start() {
+	if t == nil {
+		return
+	}
+
+	t.timer = time.AfterFunc(t.d, func() {
+		t.cancel(t.err)
+	})
+}
+
+// stop stops the timer and releases the context of the request.
+func (t *responseTimer) stop() {
+	if t == nil {
+		return
+	}
+
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.cancel(nil)
+}
+
+// expired reports whether the request was canceled because its body was not read in time.
+func (t *responseTimer) expired() bool {
+	return t != nil && context.Cause(t.ctx) == t.err
+}
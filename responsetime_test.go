@@ -0,0 +1,58 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMaxResponseTime(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fast" {
+			w.Write(helloBytes)
+			return
+		}
+
+		// Send the headers at once and then dribble the body.
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 100; i++ {
+			w.Write([]byte("."))
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(20 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithMaxResponseTime(100*time.Millisecond))
+
+	start := time.Now()
+	err := h.Visit(ts.URL + "/slow")
+	assert.EqualError(t, err, fmt.Sprintf("response body of %s/slow was not read within 100ms", ts.URL))
+	assert.Less(t, time.Since(start), time.Second, "the read is aborted promptly")
+	assert.Equal(t, int64(1), h.Stats().RequestsFailed)
+
+	assert.NoError(t, h.Visit(ts.URL+"/fast"))
+}
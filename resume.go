@@ -0,0 +1,77 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxResumes is the maximum number of times a failed body read is resumed.
+const defaultMaxResumes = 3
+
+// resumeBody continues a body read of the response that failed with readErr after receiving
+// the bytes in b, by requesting the remaining bytes with a Range header. The read is only
+// resumed if the server advertises support for byte ranges. The range requests are sent like the
+// request itself, with the Backend of the Harvester if set, and their bodies are read like the first
+// one, counting against the download budget. Returns the full body, or the part of it that fits into
+// the download budget and whether it was cut short, or the bytes received so far and the last error
+// if the body could not be completed.
+func (h *Harvester) resumeBody(req *http.Request, res *http.Response, depth int, b []byte, readErr error) (_ []byte, truncated bool, _ error) {
+	if res.StatusCode != http.StatusOK || !strings.EqualFold(res.Header.Get("Accept-Ranges"), "bytes") {
+		return b, false, readErr
+	}
+
+	// If-Range makes sure the remaining bytes belong to the same version of the resource.
+	validator := res.Header.Get("ETag")
+	if validator == "" {
+		validator = res.Header.Get("Last-Modified")
+	}
+
+	for attempt := 0; attempt < defaultMaxResumes; attempt++ {
+		rangeReq := req.Clone(req.Context())
+		rangeReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(b)))
+		if validator != "" {
+			rangeReq.Header.Set("If-Range", validator)
+		}
+
+		rangeRes, err := h.send(rangeReq, depth)
+		if err != nil {
+			readErr = err
+			continue
+		}
+
+		if rangeRes.StatusCode != http.StatusPartialContent ||
+			!strings.HasPrefix(rangeRes.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", len(b))) {
+			h.closeBody(rangeRes)
+			return b, false, readErr
+		}
+
+		rest, truncated, err := h.readBody(rangeReq, rangeRes.Body)
+		h.closeBody(rangeRes)
+
+		b = append(b, rest...)
+		h.bufferPool.put(rest)
+		if err == nil {
+			return b, truncated, nil
+		}
+
+		readErr = err
+	}
+
+	return b, false, readErr
+}
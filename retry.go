@@ -0,0 +1,65 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// bodyRetry is the configuration for retrying a request when its response body matches a pattern.
+type bodyRetry struct {
+	pattern    *regexp.Regexp
+	maxRetries int
+	delay      time.Duration
+}
+
+// shouldRetry reports whether a response with the given body should be retried
+// after the given number of retries.
+func (r *bodyRetry) shouldRetry(body []byte, attempt int) bool {
+	return attempt < r.maxRetries && r.pattern.Match(body)
+}
+
+// wait blocks for the given duration or until the Harvester's context is done.
+func (h *Harvester) wait(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-h.Context.Done():
+		return h.Context.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryRequest returns a copy of the request to send it again, with a fresh body.
+func (h *Harvester) retryRequest(ctx context.Context, req *http.Request) (*http.Request, error) {
+	req = req.Clone(ctx)
+	if req.GetBody != nil {
+		var err error
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	if h.httpTrace {
+		req = withTrace(req)
+	}
+
+	return req, nil
+}
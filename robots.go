@@ -0,0 +1,173 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+const (
+	// robotsBackoffInitial is the delay before retrying a rate limited robots.txt for the first time.
+	robotsBackoffInitial = time.Second
+	// robotsBackoffMax caps the exponential delay between robots.txt retries, unless Retry-After asks for longer.
+	robotsBackoffMax = 5 * time.Minute
+)
+
+// robotsBackoff is the retry state of a host whose robots.txt responded with 429 Too Many Requests.
+type robotsBackoff struct {
+	next  time.Time
+	delay time.Duration
+}
+
+// defaultRobotsAgent is the user agent robots.txt groups are matched against by default.
+const defaultRobotsAgent = "Grawlr"
+
+// robotsAllowed reports whether robots.txt allows the path for the first agent of the chain with a
+// group of its own, or for all agents if none of them has one.
+func robotsAllowed(robot *robotstxt.RobotsData, path string, agents []string) bool {
+	return robot.TestAgent(path, robotsAgent(robot, agents))
+}
+
+// robotsAgent returns the first agent of the chain with a robots.txt group of its own,
+// or the last agent of the chain if none of them has one.
+func robotsAgent(robot *robotstxt.RobotsData, agents []string) string {
+	if len(agents) == 0 {
+		return defaultRobotsAgent
+	}
+
+	wildcard := robot.FindGroup("*")
+	for _, agent := range agents {
+		if agent == "*" {
+			break
+		}
+		if group := robot.FindGroup(agent); group != wildcard {
+			return agent
+		}
+	}
+
+	return agents[len(agents)-1]
+}
+
+// fetchRobots fetches and caches the robots.txt of the host of the URL, exchanging the request like
+// any other with send. While the robots.txt of the host is rate limited, it is retried with
+// exponential backoff on later checks and the rate limit fallback is used instead.
+func (h *Harvester) fetchRobots(parsedURL *url.URL, depth int) (*robotstxt.RobotsData, error) {
+	host := parsedURL.Host
+
+	h.mu.Lock()
+	backoff := h.robotsBackoffs[host]
+	h.mu.Unlock()
+
+	if backoff != nil && time.Now().Before(backoff.next) {
+		return h.robotsRateLimitFallback(), nil
+	}
+
+	robotURL := parsedURL.Scheme + "://" + host + "/robots.txt"
+	req, err := http.NewRequestWithContext(h.Context, http.MethodGet, robotURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := h.send(req, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	defer h.closeBody(res)
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		delay := robotsBackoffInitial
+		if backoff != nil {
+			delay = min(2*backoff.delay, robotsBackoffMax)
+		}
+		if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok && retryAfter > delay {
+			delay = retryAfter
+		}
+
+		h.mu.Lock()
+		h.robotsBackoffs[host] = &robotsBackoff{next: time.Now().Add(delay), delay: delay}
+		h.mu.Unlock()
+
+		h.logger.Warn("robots.txt is rate limited",
+			slog.String("url", robotURL),
+			slog.Duration("retry_in", delay),
+		)
+
+		return h.robotsRateLimitFallback(), nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	robot, err := robotstxt.FromStatusAndBytes(res.StatusCode, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var cleanParams []cleanParam
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		cleanParams = parseCleanParams(body)
+	}
+
+	h.mu.Lock()
+	h.robotsMap[host] = robot
+	h.cleanParams[host] = cleanParams
+	delete(h.robotsBackoffs, host)
+	h.mu.Unlock()
+
+	return robot, nil
+}
+
+// robotsRateLimitFallback returns the rules used for a host while its robots.txt is rate limited:
+// allow all, or disallow all if enabled with the WithDisallowOnRobotsRateLimit functional option.
+func (h *Harvester) robotsRateLimitFallback() *robotstxt.RobotsData {
+	status := http.StatusNotFound
+	if h.robotsRateLimitDeny {
+		status = http.StatusInternalServerError
+	}
+
+	// robotstxt allows all for a 4xx status and disallows all for a 5xx status.
+	robot, _ := robotstxt.FromStatusAndBytes(status, nil)
+	return robot
+}
+
+// parseRetryAfter parses the value of a Retry-After header, given in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// CrawlScope is a declarative set of rules deciding which URLs a Harvester fetches. Empty rules
+// do not restrict the scope. A URL is in scope if it matches every non-empty allow rule and
+// no deny rule.
+type CrawlScope struct {
+	// AllowedSchemes is a list of allowed URL schemes, e.g. "https".
+	AllowedSchemes []string
+	// AllowedDomains is a list of allowed hosts, matched case-insensitively without the port.
+	AllowedDomains []string
+	// IncludeSubdomains allows the subdomains of the AllowedDomains.
+	IncludeSubdomains bool
+	// AllowedPathPrefixes is a list of allowed URL path prefixes, e.g. "/docs/".
+	AllowedPathPrefixes []string
+	// DeniedPathPatterns is a list of patterns of disallowed URL paths.
+	DeniedPathPatterns []*regexp.Regexp
+	// AllowedURLs is a list of allowed URL prefixes, the AllowedURLs of the Harvester.
+	AllowedURLs []string
+	// DisallowedURLs is a list of disallowed URL prefixes, the DisallowedURLs of the Harvester.
+	DisallowedURLs []string
+}
+
+// WithScope is a functional option that sets the CrawlScope of the Harvester. The AllowedURLs and
+// DisallowedURLs of the Harvester are combined with the AllowedURLs and DisallowedURLs of the scope.
+func WithScope(scope CrawlScope) Options {
+	return func(h *Harvester) {
+		h.scope = scope
+	}
+}
+
+// Allows reports whether the URL is in the scope.
+func (s CrawlScope) Allows(u *url.URL) bool {
+	raw := u.String()
+
+	for _, disallowed := range s.DisallowedURLs {
+		if strings.HasPrefix(raw, disallowed) {
+			return false
+		}
+	}
+
+	for _, pattern := range s.DeniedPathPatterns {
+		if pattern.MatchString(u.Path) {
+			return false
+		}
+	}
+
+	if len(s.AllowedURLs) > 0 && !hasAnyPrefix(raw, s.AllowedURLs) {
+		return false
+	}
+
+	if len(s.AllowedSchemes) > 0 && !s.allowsScheme(u.Scheme) {
+		return false
+	}
+
+	if len(s.AllowedDomains) > 0 && !s.allowsHost(u.Hostname()) {
+		return false
+	}
+
+	if len(s.AllowedPathPrefixes) > 0 && !hasAnyPrefix(u.Path, s.AllowedPathPrefixes) {
+		return false
+	}
+
+	return true
+}
+
+// allowsScheme reports whether the scheme is one of the AllowedSchemes.
+func (s CrawlScope) allowsScheme(scheme string) bool {
+	for _, allowed := range s.AllowedSchemes {
+		if strings.EqualFold(scheme, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowsHost reports whether the host is one of the AllowedDomains, or one of their subdomains
+// if IncludeSubdomains is set.
+func (s CrawlScope) allowsHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range s.AllowedDomains {
+		domain = strings.ToLower(domain)
+		if host == domain || s.IncludeSubdomains && strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasAnyPrefix reports whether s starts with any of the prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
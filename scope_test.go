@@ -0,0 +1,127 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlScope_Allows(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   CrawlScope
+		allowed []string
+		denied  []string
+	}{
+		{
+			name:    "Empty scope",
+			scope:   CrawlScope{},
+			allowed: []string{"https://example.com/", "ftp://files.example.org/a"},
+		},
+		{
+			name:    "Schemes",
+			scope:   CrawlScope{AllowedSchemes: []string{"https"}},
+			allowed: []string{"https://example.com/", "HTTPS://example.com/"},
+			denied:  []string{"http://example.com/"},
+		},
+		{
+			name:    "Domains",
+			scope:   CrawlScope{AllowedDomains: []string{"Example.com"}},
+			allowed: []string{"https://example.com/", "http://EXAMPLE.com:8080/a"},
+			denied:  []string{"https://www.example.com/", "https://notexample.com/", "https://example.com.evil.org/"},
+		},
+		{
+			name:    "Subdomains",
+			scope:   CrawlScope{AllowedDomains: []string{"example.com"}, IncludeSubdomains: true},
+			allowed: []string{"https://example.com/", "https://www.example.com/", "https://a.b.example.com/"},
+			denied:  []string{"https://notexample.com/", "https://example.org/"},
+		},
+		{
+			name:    "Path prefixes",
+			scope:   CrawlScope{AllowedPathPrefixes: []string{"/docs/", "/blog"}},
+			allowed: []string{"https://example.com/docs/intro", "https://example.com/blog?page=2"},
+			denied:  []string{"https://example.com/", "https://example.com/api/docs/"},
+		},
+		{
+			name:    "Denied path patterns",
+			scope:   CrawlScope{DeniedPathPatterns: []*regexp.Regexp{regexp.MustCompile(`\.pdf$`), regexp.MustCompile(`^/admin`)}},
+			allowed: []string{"https://example.com/docs/intro", "https://example.com/pdf"},
+			denied:  []string{"https://example.com/report.pdf", "https://example.com/admin/users"},
+		},
+		{
+			name:    "URL prefixes",
+			scope:   CrawlScope{AllowedURLs: []string{"https://example.com/docs"}, DisallowedURLs: []string{"https://example.com/docs/private"}},
+			allowed: []string{"https://example.com/docs/intro"},
+			denied:  []string{"https://example.com/docs/private/keys", "https://example.com/blog"},
+		},
+		{
+			name: "Combined rules",
+			scope: CrawlScope{
+				AllowedSchemes:      []string{"https"},
+				AllowedDomains:      []string{"example.com"},
+				IncludeSubdomains:   true,
+				AllowedPathPrefixes: []string{"/docs/"},
+				DeniedPathPatterns:  []*regexp.Regexp{regexp.MustCompile(`/drafts/`)},
+			},
+			allowed: []string{"https://docs.example.com/docs/intro", "https://example.com/docs/"},
+			denied: []string{
+				"http://example.com/docs/intro",
+				"https://example.org/docs/intro",
+				"https://example.com/blog/",
+				"https://example.com/docs/drafts/new",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, raw := range tt.allowed {
+				u, err := url.Parse(raw)
+				assert.NoError(t, err)
+				assert.True(t, tt.scope.Allows(u), raw)
+			}
+			for _, raw := range tt.denied {
+				u, err := url.Parse(raw)
+				assert.NoError(t, err)
+				assert.False(t, tt.scope.Allows(u), raw)
+			}
+		})
+	}
+}
+
+func TestHarvester_WithScope(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	h := newTestHarvester(
+		WithScope(CrawlScope{
+			AllowedSchemes:     []string{"http"},
+			AllowedDomains:     []string{"127.0.0.1"},
+			DeniedPathPatterns: []*regexp.Regexp{regexp.MustCompile(`^/faq`)},
+		}),
+		WithDisallowedURLs([]string{server.URL + "/user_agent"}),
+		WithIgnoreRobots(true),
+	)
+
+	assert.NoError(t, h.Visit(server.URL+"/html"))
+	assert.ErrorContains(t, h.Visit(server.URL+"/faq"), "forbidden")
+	assert.ErrorContains(t, h.Visit(server.URL+"/user_agent"), "forbidden", "the individual options compose with the scope")
+	assert.ErrorContains(t, h.Visit("http://localhost/html"), "forbidden")
+}
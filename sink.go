@@ -0,0 +1,138 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Item is the envelope of a value emitted with Response.Emit and written to the sinks of a Harvester.
+type Item struct {
+	// URL is the URL of the page the item was emitted from.
+	URL string `json:"url"`
+	// Depth is the depth of the page the item was emitted from.
+	Depth int `json:"depth"`
+	// Timestamp is the time the item was emitted.
+	Timestamp time.Time `json:"timestamp"`
+	// Payload is the emitted value.
+	Payload any `json:"payload"`
+	// Response is the response of the page the item was emitted from.
+	Response *Response `json:"-"`
+}
+
+// Sink is an interface for the outputs of a crawl, such as the CSVExporter and the JSONLExporter.
+// Sinks must be safe for concurrent use.
+type Sink interface {
+	// Write writes an emitted item.
+	Write(item Item) error
+	// Close flushes and releases the sink, it is called by Harvester.CloseSinks.
+	Close() error
+}
+
+// AddSink adds a Sink to the Harvester that receives every item emitted with Response.Emit.
+func (h *Harvester) AddSink(s Sink) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sinks = append(h.sinks, s)
+}
+
+// CloseSinks closes every sink of the Harvester and returns the joined errors of the sinks.
+// It should be called when the crawl is done.
+func (h *Harvester) CloseSinks() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var errs []error
+	for _, s := range h.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Emit writes the payload as an Item to every sink of the Harvester. A sink that fails to write
+// the item is retried once, after which the error is logged and the crawl continues.
+func (r *Response) Emit(payload any) {
+	h := r.Request.harvester
+
+	item := Item{
+		URL:       r.Request.URL.String(),
+		Depth:     r.Request.Depth,
+		Timestamp: time.Now(),
+		Payload:   payload,
+		Response:  r,
+	}
+
+	h.mu.RLock()
+	sinks := h.sinks
+	h.mu.RUnlock()
+
+	for _, s := range sinks {
+		err := s.Write(item)
+		if err != nil {
+			err = s.Write(item)
+		}
+		if err != nil {
+			h.logger.Warn("error writing item to sink",
+				slog.String("url", item.URL),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// InMemorySink is a Sink that keeps the written items in memory, e.g. for tests.
+type InMemorySink struct {
+	items []Item
+	lock  *sync.RWMutex
+}
+
+// NewInMemorySink creates a new empty InMemorySink.
+func NewInMemorySink() *InMemorySink {
+	return &InMemorySink{
+		lock: &sync.RWMutex{},
+	}
+}
+
+// Write appends the item to the items of the sink.
+func (s *InMemorySink) Write(item Item) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.items = append(s.items, item)
+	return nil
+}
+
+// Close does nothing, the items stay available after closing.
+func (s *InMemorySink) Close() error {
+	return nil
+}
+
+// Items returns a copy of the written items in the order they were written.
+func (s *InMemorySink) Items() []Item {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	items := make([]Item, len(s.items))
+	copy(items, s.items)
+	return items
+}
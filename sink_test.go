@@ -0,0 +1,111 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingSink is a Sink failing the first failures writes.
+type failingSink struct {
+	*InMemorySink
+	failures int
+	closeErr error
+}
+
+func (s *failingSink) Write(item Item) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("write failed")
+	}
+	return s.InMemorySink.Write(item)
+}
+
+func (s *failingSink) Close() error {
+	return s.closeErr
+}
+
+func TestHarvester_AddSink(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	h := newTestHarvester(WithLogger(logger))
+
+	memory := NewInMemorySink()
+	retried := &failingSink{InMemorySink: NewInMemorySink(), failures: 1}
+	failed := &failingSink{InMemorySink: NewInMemorySink(), failures: 2, closeErr: errors.New("close failed")}
+	h.AddSink(memory)
+	h.AddSink(retried)
+	h.AddSink(failed)
+
+	h.HtmlDo("li a", func(el *HtmlElement) {
+		el.Response.Emit(el.Text)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+
+	items := memory.Items()
+	assert.Len(t, items, 5)
+	assert.Equal(t, server.URL+"/faq", items[0].URL)
+	assert.Equal(t, 0, items[0].Depth)
+	assert.Equal(t, "Home", items[0].Payload)
+	assert.False(t, items[0].Timestamp.IsZero())
+	assert.Equal(t, 200, items[0].Response.StatusCode)
+
+	assert.Equal(t, items, retried.Items())
+	assert.Len(t, failed.Items(), 4)
+	assert.Contains(t, buf.String(), `"msg":"error writing item to sink"`)
+
+	assert.EqualError(t, h.CloseSinks(), "close failed")
+}
+
+func TestHarvester_AddSink_Exporters(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var csvBuf, jsonlBuf bytes.Buffer
+	h := newTestHarvester()
+	h.AddSink(NewCSVExporter(&csvBuf, []Column{{Name: "title", Selector: "title"}}))
+	h.AddSink(NewJSONLExporter(&jsonlBuf))
+
+	h.HtmlDo("h1", func(el *HtmlElement) {
+		el.Response.Emit(map[string]string{"heading": el.Text})
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/faq"))
+	assert.NoError(t, h.CloseSinks())
+
+	assert.Equal(t, "title\nFAQ\n", csvBuf.String())
+
+	scanner := bufio.NewScanner(&jsonlBuf)
+	assert.True(t, scanner.Scan())
+
+	var item Item
+	assert.NoError(t, json.Unmarshal(scanner.Bytes(), &item))
+	assert.Equal(t, server.URL+"/faq", item.URL)
+	assert.Equal(t, map[string]any{"heading": "Frequently Asked Questions"}, item.Payload)
+	assert.False(t, scanner.Scan())
+}
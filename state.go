@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// stateVersion is the version of the state envelope written by SaveState.
+const stateVersion = 1
+
+var (
+	// ErrStateNotSaved is returned by SaveState when the state of some components was not saved,
+	// because they do not support export.
+	ErrStateNotSaved = func(components []string) error {
+		return fmt.Errorf("state of %s was not saved: export not supported", strings.Join(components, ", "))
+	}
+	// ErrStateVersion is returned by LoadState when the state has an unsupported version.
+	ErrStateVersion = func(version int) error {
+		return fmt.Errorf("unsupported state version %d", version)
+	}
+)
+
+// crawlState is the versioned envelope of the resumable state of a Harvester.
+type crawlState struct {
+	Version int                  `json:"version"`
+	Store   json.RawMessage      `json:"store,omitempty"`
+	Parents map[string]string    `json:"parents"`
+	Stats   Stats                `json:"stats"`
+	Hosts   map[string]hostState `json:"hosts,omitempty"`
+}
+
+// SaveState writes the resumable state of the Harvester to w as JSON: the visited URLs of the store,
+// the crawl tree, the crawl counters including the per-host counters, and the download budget used.
+// The store is saved if it implements json.Marshaler, as the InMemoryStore does. The state of the
+// components that do not support export, such as a custom store, the link graph, a cookie jar other
+// than the PersistentJar of WithPersistentCookies or the Crawl-delay gates of the hosts, is not saved
+// and the components are listed in the returned ErrStateNotSaved, after the rest of the state has been
+// written. Fetched robots.txt files are not saved and are fetched again after LoadState.
+func (h *Harvester) SaveState(w io.Writer) error {
+	state := crawlState{
+		Version: stateVersion,
+		Parents: h.CrawlTree(),
+		Stats:   h.Stats(),
+		Hosts:   h.stats.hostStates(),
+	}
+
+	var unsupported []string
+
+	if m, ok := h.store.(json.Marshaler); ok {
+		b, err := m.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		state.Store = b
+	} else {
+		unsupported = append(unsupported, fmt.Sprintf("store %T", h.store))
+	}
+
+	if h.graph != nil {
+		unsupported = append(unsupported, "link graph")
+	}
+
+	if _, ok := h.Client.Jar.(*PersistentJar); h.Client.Jar != nil && !ok {
+		unsupported = append(unsupported, fmt.Sprintf("cookie jar %T", h.Client.Jar))
+	}
+
+	h.mu.RLock()
+	gates := len(h.hostGates)
+	h.mu.RUnlock()
+	if gates > 0 {
+		unsupported = append(unsupported, "crawl-delay gates")
+	}
+
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		return err
+	}
+
+	if len(unsupported) > 0 {
+		return ErrStateNotSaved(unsupported)
+	}
+
+	return nil
+}
+
+// LoadState restores the state written by SaveState from r, so that a crawl can be resumed without
+// fetching the visited URLs again, and without exceeding the download budgets. The store must implement
+// json.Unmarshaler to restore the visited URLs.
+// LoadState should be called before the crawl is resumed.
+func (h *Harvester) LoadState(r io.Reader) error {
+	var state crawlState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+
+	if state.Version != stateVersion {
+		return ErrStateVersion(state.Version)
+	}
+
+	if state.Store != nil {
+		u, ok := h.store.(json.Unmarshaler)
+		if !ok {
+			return fmt.Errorf("store %T does not support loading state", h.store)
+		}
+		if err := u.UnmarshalJSON(state.Store); err != nil {
+			return err
+		}
+	}
+
+	h.mu.Lock()
+	for u, parent := range state.Parents {
+		h.parents[u] = parent
+	}
+	h.mu.Unlock()
+
+	h.stats.restore(state.Stats)
+	h.stats.restoreHosts(state.Hosts)
+
+	if h.budget != nil {
+		h.budget.restore(state.Stats.BudgetUsed, state.Stats.BudgetUsedByHost)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_SaveState(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fetches = make(map[string]int)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches[r.URL.Path]++
+		mu.Unlock()
+		w.Write(helloBytes)
+	}))
+	defer server.Close()
+
+	pages := []string{"/0", "/1", "/2", "/3"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := newTestHarvester(WithIgnoreRobots(true), WithContext(ctx))
+	h.ResponseDo(func(res *Response) {
+		// Kill the crawl halfway.
+		if res.Request.URL.Path == "/1" {
+			cancel()
+		}
+	})
+
+	for _, page := range pages {
+		h.Visit(server.URL + page)
+	}
+
+	var state bytes.Buffer
+	assert.NoError(t, h.SaveState(&state))
+
+	var envelope map[string]any
+	assert.NoError(t, json.Unmarshal(state.Bytes(), &envelope))
+	assert.Equal(t, float64(stateVersion), envelope["version"])
+
+	h = newTestHarvester(WithIgnoreRobots(true))
+	assert.NoError(t, h.LoadState(&state))
+	assert.Equal(t, int64(2), h.Stats().RequestsSucceeded)
+
+	for _, page := range pages {
+		h.Visit(server.URL + page)
+	}
+
+	assert.Equal(t, map[string]int{"/0": 1, "/1": 1, "/2": 1, "/3": 1}, fetches)
+	assert.Equal(t, int64(4), h.Stats().RequestsSucceeded)
+	assert.Equal(t, int64(2), h.Stats().SkippedVisited)
+}
+
+func TestHarvester_SaveState_Budgets(t *testing.T) {
+	serverA := newBudgetTestServer()
+	defer serverA.Close()
+	serverB := newBudgetTestServer()
+	defer serverB.Close()
+	hostA := strings.TrimPrefix(serverA.URL, "http://")
+
+	options := []Options{WithIgnoreRobots(true), WithHostStats(true), WithMaxTotalBytes(28000), WithMaxBytesPerHost(15000)}
+
+	h := newTestHarvester(options...)
+	assert.NoError(t, h.Visit(serverA.URL+"/1"))
+	assert.NoError(t, h.Visit(serverB.URL+"/1"))
+
+	var state bytes.Buffer
+	assert.NoError(t, h.SaveState(&state))
+
+	h = newTestHarvester(options...)
+	assert.NoError(t, h.LoadState(&state))
+
+	stats := h.Stats()
+	assert.Equal(t, int64(20000), stats.BudgetUsed)
+	assert.Equal(t, int64(10000), stats.BudgetUsedByHost[hostA])
+	assert.Equal(t, int64(1), stats.Hosts[hostA].Requests)
+	assert.Equal(t, int64(10000), stats.Hosts[hostA].Bytes)
+
+	// The budgets continue from the restored usage instead of starting over.
+	var sizes []int
+	h.ResponseDo(func(res *Response) {
+		sizes = append(sizes, len(res.content))
+	})
+
+	assert.NoError(t, h.Visit(serverA.URL+"/2"))
+	assert.EqualError(t, h.Visit(serverA.URL+"/3"), ErrHostBytesExceeded(hostA, 15000).Error())
+	assert.NoError(t, h.Visit(serverB.URL+"/2"))
+	assert.EqualError(t, h.Visit(serverB.URL+"/3"), ErrTotalBytesExceeded(28000).Error())
+
+	assert.Equal(t, []int{5000, 3000}, sizes)
+	assert.Equal(t, int64(2), h.Stats().Hosts[hostA].Requests)
+}
+
+// unexportableStore is a Storer that does not support saving its state.
+type unexportableStore struct {
+	Storer
+}
+
+func TestHarvester_SaveState_Unsupported(t *testing.T) {
+	h := newTestHarvester(WithStore(unexportableStore{NewInMemoryStore()}), WithLinkGraph(true))
+
+	var state bytes.Buffer
+	assert.EqualError(t, h.SaveState(&state),
+		"state of store grawlr.unexportableStore, link graph was not saved: export not supported")
+	assert.NoError(t, newTestHarvester().LoadState(&state))
+
+	assert.EqualError(t, h.LoadState(bytes.NewBufferString(`{"version": 2}`)), "unsupported state version 2")
+
+	t.Run("CookieJar", func(t *testing.T) {
+		jar, _ := cookiejar.New(nil)
+		h := newTestHarvester(WithCookieJar(jar))
+
+		assert.EqualError(t, h.SaveState(&bytes.Buffer{}),
+			"state of cookie jar *cookiejar.Jar was not saved: export not supported")
+		assert.NoError(t, newTestHarvester(WithPersistentCookies(true)).SaveState(&bytes.Buffer{}))
+	})
+
+	t.Run("CrawlDelay", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				w.Write([]byte("User-agent: *\nCrawl-delay: 0.01"))
+				return
+			}
+			w.Write(helloBytes)
+		}))
+		defer server.Close()
+
+		h := newTestHarvester()
+		assert.NoError(t, h.Visit(server.URL+"/"))
+
+		assert.EqualError(t, h.SaveState(&bytes.Buffer{}),
+			"state of crawl-delay gates was not saved: export not supported")
+	})
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the crawl counters of a Harvester.
+type Stats struct {
+	// RequestsAttempted is the number of requests that passed all checks and were sent.
+	RequestsAttempted int64
+	// RequestsSucceeded is the number of requests that received a response with a fully read body.
+	RequestsSucceeded int64
+	// RequestsFailed is the number of requests that failed due to a network or body read error.
+	RequestsFailed int64
+	// SkippedVisited is the number of URLs skipped because they had already been visited.
+	SkippedVisited int64
+	// SkippedFiltered is the number of URLs skipped by the allowed and disallowed URL filters.
+	SkippedFiltered int64
+	// SkippedRobots is the number of URLs skipped because robots.txt disallowed them.
+	SkippedRobots int64
+	// SkippedDepth is the number of URLs skipped because the depth limit was exceeded.
+	SkippedDepth int64
+	// PreflightRequests is the number of HEAD requests sent to decide whether to fetch a URL.
+	PreflightRequests int64
+	// SkippedPreflight is the number of URLs skipped because of the response to their HEAD request.
+	SkippedPreflight int64
+	// SkippedBudget is the number of URLs skipped because a download budget was used up.
+	SkippedBudget int64
+	// SkippedDeadline is the number of URLs skipped because the maximum duration of the crawl elapsed.
+	SkippedDeadline int64
+	// TruncatedBodies is the number of response bodies cut short because a download budget was used up.
+	TruncatedBodies int64
+	// BytesDownloaded is the total number of response body bytes read, including the bytes read before the
+	// state of the crawl was restored with LoadState.
+	BytesDownloaded int64
+	// BudgetUsed is the number of bytes counted against the download budget set with WithMaxTotalBytes or
+	// WithMaxBytesPerHost, 0 without a download budget.
+	BudgetUsed int64
+	// BudgetUsedByHost is the number of bytes counted against the download budgets by host, nil without
+	// a download budget.
+	BudgetUsedByHost map[string]int64 `json:",omitempty"`
+	// ResponsesByClass is the number of responses by status class, e.g. "2xx" or "4xx".
+	ResponsesByClass map[string]int64
+	// InFlight is the number of requests currently being fetched.
+	InFlight int64
+	// Hosts is the per-host statistics by host, nil unless enabled with the WithHostStats functional option.
+	Hosts map[string]HostStats `json:",omitempty"`
+	// Elapsed is the time since the first Visit of the Harvester.
+	Elapsed time.Duration
+}
+
+// stats holds the crawl counters of a Harvester. The counters are maintained
+// with atomics so that reading them does not contend with the crawl, except for
+// the per-host counters, which are guarded by hostsLock.
+type stats struct {
+	requestsAttempted atomic.Int64
+	requestsSucceeded atomic.Int64
+	requestsFailed    atomic.Int64
+	skippedVisited    atomic.Int64
+	skippedFiltered   atomic.Int64
+	skippedRobots     atomic.Int64
+	skippedDepth      atomic.Int64
+	preflightRequests atomic.Int64
+	skippedPreflight  atomic.Int64
+	skippedBudget     atomic.Int64
+	skippedDeadline   atomic.Int64
+	truncated         atomic.Int64
+	bytesDownloaded   atomic.Int64
+	statusClasses     [6]atomic.Int64
+	inFlight          atomic.Int64
+	startedAt         atomic.Int64
+	hosts             map[string]*hostCounters
+	hostsLock         sync.Mutex
+}
+
+func newStats() *stats {
+	return &stats{
+		hosts: make(map[string]*hostCounters),
+	}
+}
+
+// start records the start time of the crawl if it has not been recorded yet.
+func (s *stats) start() {
+	s.startedAt.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+// recordStatus increments the counter of the status class of the given status code.
+func (s *stats) recordStatus(code int) {
+	class := code / 100
+	if class < 1 || class >= len(s.statusClasses) {
+		class = 0
+	}
+	s.statusClasses[class].Add(1)
+}
+
+func (s *stats) snapshot() Stats {
+	snapshot := Stats{
+		RequestsAttempted: s.requestsAttempted.Load(),
+		RequestsSucceeded: s.requestsSucceeded.Load(),
+		RequestsFailed:    s.requestsFailed.Load(),
+		SkippedVisited:    s.skippedVisited.Load(),
+		SkippedFiltered:   s.skippedFiltered.Load(),
+		SkippedRobots:     s.skippedRobots.Load(),
+		SkippedDepth:      s.skippedDepth.Load(),
+		PreflightRequests: s.preflightRequests.Load(),
+		SkippedPreflight:  s.skippedPreflight.Load(),
+		SkippedBudget:     s.skippedBudget.Load(),
+		SkippedDeadline:   s.skippedDeadline.Load(),
+		TruncatedBodies:   s.truncated.Load(),
+		BytesDownloaded:   s.bytesDownloaded.Load(),
+		ResponsesByClass:  make(map[string]int64),
+		InFlight:          s.inFlight.Load(),
+	}
+
+	for class := 1; class < len(s.statusClasses); class++ {
+		if n := s.statusClasses[class].Load(); n > 0 {
+			snapshot.ResponsesByClass[strconv.Itoa(class)+"xx"] = n
+		}
+	}
+
+	if n := s.statusClasses[0].Load(); n > 0 {
+		snapshot.ResponsesByClass["other"] = n
+	}
+
+	snapshot.Elapsed = s.elapsed()
+
+	return snapshot
+}
+
+// elapsed returns the time since the start of the crawl, 0 if it has not started.
+func (s *stats) elapsed() time.Duration {
+	if startedAt := s.startedAt.Load(); startedAt != 0 {
+		return time.Since(time.Unix(0, startedAt))
+	}
+	return 0
+}
+
+// restore sets the counters to the given snapshot, e.g. one saved with Harvester.SaveState.
+// The number of requests in flight is not restored and the elapsed time continues from the snapshot.
+// The per-host counters are restored with restoreHosts, as the snapshot only summarizes their latencies.
+func (s *stats) restore(snapshot Stats) {
+	s.requestsAttempted.Store(snapshot.RequestsAttempted)
+	s.requestsSucceeded.Store(snapshot.RequestsSucceeded)
+	s.requestsFailed.Store(snapshot.RequestsFailed)
+	s.skippedVisited.Store(snapshot.SkippedVisited)
+	s.skippedFiltered.Store(snapshot.SkippedFiltered)
+	s.skippedRobots.Store(snapshot.SkippedRobots)
+	s.skippedDepth.Store(snapshot.SkippedDepth)
+	s.preflightRequests.Store(snapshot.PreflightRequests)
+	s.skippedPreflight.Store(snapshot.SkippedPreflight)
+	s.skippedBudget.Store(snapshot.SkippedBudget)
+	s.skippedDeadline.Store(snapshot.SkippedDeadline)
+	s.truncated.Store(snapshot.TruncatedBodies)
+	s.bytesDownloaded.Store(snapshot.BytesDownloaded)
+
+	for class := range s.statusClasses {
+		key := "other"
+		if class > 0 {
+			key = strconv.Itoa(class) + "xx"
+		}
+		s.statusClasses[class].Store(snapshot.ResponsesByClass[key])
+	}
+
+	if snapshot.Elapsed > 0 {
+		s.startedAt.Store(time.Now().Add(-snapshot.Elapsed).UnixNano())
+	}
+}
@@ -15,7 +15,10 @@ limitations under the License.
 */
 package grawlr
 
-import "sync"
+import (
+	"encoding/json"
+	"sync"
+)
 
 // Storer is an interface for a cache that storer
 // Harvester's internal data.
@@ -24,16 +27,25 @@ type Storer interface {
 	Visited(url string) bool
 	// Visit marks the URL as visited.
 	Visit(url string)
+	// VisitCount returns the number of times the URL has been visited.
+	VisitCount(url string) int
+	// VisitDepth returns the depth at which the URL was visited and true, or false if the depth is unknown.
+	VisitDepth(url string) (int, bool)
+	// SetVisitDepth records the depth at which the URL was visited.
+	SetVisitDepth(url string, depth int)
 }
 
 type InMemoryStore struct {
-	visited map[string]bool
+	visited map[string]int
+	depths  map[string]int
+	cookies []byte
 	lock    *sync.RWMutex
 }
 
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
-		visited: make(map[string]bool),
+		visited: make(map[string]int),
+		depths:  make(map[string]int),
 		lock:    &sync.RWMutex{},
 	}
 }
@@ -42,12 +54,89 @@ func (s *InMemoryStore) Visited(url string) bool {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
-	return s.visited[url]
+	return s.visited[url] > 0
 }
 
 func (s *InMemoryStore) Visit(url string) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	s.visited[url] = true
+	s.visited[url]++
+}
+
+func (s *InMemoryStore) VisitCount(url string) int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.visited[url]
+}
+
+func (s *InMemoryStore) VisitDepth(url string) (int, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	depth, ok := s.depths[url]
+	return depth, ok
+}
+
+func (s *InMemoryStore) SetVisitDepth(url string, depth int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.depths[url] = depth
+}
+
+// SaveCookies stores the encoded cookies of a PersistentJar.
+func (s *InMemoryStore) SaveCookies(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.cookies = data
+	return nil
+}
+
+// LoadCookies returns the encoded cookies of a PersistentJar, nil if none are stored.
+func (s *InMemoryStore) LoadCookies() ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.cookies, nil
+}
+
+// inMemoryStoreState is the JSON encoding of an InMemoryStore.
+type inMemoryStoreState struct {
+	Visited map[string]int  `json:"visited"`
+	Depths  map[string]int  `json:"depths"`
+	Cookies json.RawMessage `json:"cookies,omitempty"`
+}
+
+// MarshalJSON encodes the visited URLs of the store, so that it is saved by Harvester.SaveState.
+func (s *InMemoryStore) MarshalJSON() ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return json.Marshal(inMemoryStoreState{Visited: s.visited, Depths: s.depths, Cookies: s.cookies})
+}
+
+// UnmarshalJSON replaces the visited URLs of the store, so that it is restored by Harvester.LoadState.
+func (s *InMemoryStore) UnmarshalJSON(b []byte) error {
+	var state inMemoryStoreState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+
+	if state.Visited == nil {
+		state.Visited = make(map[string]int)
+	}
+	if state.Depths == nil {
+		state.Depths = make(map[string]int)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.visited = state.Visited
+	s.depths = state.Depths
+	s.cookies = state.Cookies
+	return nil
 }
@@ -0,0 +1,121 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// WithStreamingLinks is a functional option that follows the a[href] links of every page as they are
+// found in a single tokenizer pass over the body, without building the DOM of the page. The links are
+// followed after the HtmlDo callbacks of the page, resolved against the <base href> of the page if it
+// precedes them. Links are recorded in the link graph without their anchor text.
+func WithStreamingLinks(enabled bool) Options {
+	return func(h *Harvester) {
+		h.streamingLinks = enabled
+	}
+}
+
+// followStreamingLinks visits the a[href] links of the response in the order they appear in the body,
+// and the src of its frame elements if enabled with WithFollowFrames.
+func (h *Harvester) followStreamingLinks(res *Response) {
+	z := html.NewTokenizer(bytes.NewReader(res.content))
+	baseFound := false
+
+	for {
+		if z.Next() == html.ErrorToken {
+			if err := z.Err(); !errors.Is(err, io.EOF) {
+				h.logger.Warn("error tokenizing response body",
+					slog.String("url", res.Request.URL.String()),
+					slog.Any("error", err),
+				)
+			}
+			return
+		}
+
+		token := z.Token()
+		if token.Type != html.StartTagToken && token.Type != html.SelfClosingTagToken {
+			continue
+		}
+
+		switch token.DataAtom {
+		case atom.Base:
+			href, ok := tokenAttribute(token, "href")
+			if !ok || baseFound {
+				continue
+			}
+			baseFound = true
+			if base, err := res.Request.URL.Parse(strings.TrimSpace(href)); err == nil {
+				res.Request.BaseURL = base
+			}
+		case atom.A:
+			href, ok := tokenAttribute(token, "href")
+			if !ok {
+				continue
+			}
+			h.followStreamingLink(res.Request, href, token)
+		default:
+			if !h.followFrames || !isFrameAtom(token.DataAtom) {
+				continue
+			}
+			if src, ok := tokenAttribute(token, "src"); ok {
+				h.followFrameSource(res.Request, src)
+			}
+		}
+	}
+}
+
+// followStreamingLink visits a link found while tokenizing the page of the request.
+func (h *Harvester) followStreamingLink(r *Request, href string, token html.Token) {
+	absURL := r.GetAbsoluteURL(strings.TrimSpace(href))
+	if absURL == "" {
+		return
+	}
+
+	rel, _ := tokenAttribute(token, "rel")
+	noFollow := false
+	for _, v := range strings.Fields(rel) {
+		if strings.EqualFold(v, "nofollow") {
+			noFollow = true
+		}
+	}
+
+	if err := r.follow(absURL, "", noFollow); err != nil {
+		h.logger.Debug("error following streamed link",
+			slog.String("url", r.URL.String()),
+			slog.String("link", absURL),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// tokenAttribute returns the value of the attribute of the token with the given key.
+func tokenAttribute(token html.Token, key string) (string, bool) {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvester_WithStreamingLinks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>
+			<a href="/first">First</a>
+			<p>Text <a href=" /second ">Second</a></p>
+			<a href="#top">Top</a>
+			<a href="mailto:someone@example.com">Mail</a>
+			<a>No href</a>
+			<a href="/first">First again</a>
+		</body></html>`))
+	})
+	mux.HandleFunc("/first", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><base href="/docs/"></head><body><a href="intro">Intro</a></body></html>`))
+	})
+	for _, path := range []string{"/second", "/docs/intro"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(helloBytes)
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	h := newTestHarvester(WithStreamingLinks(true), WithIgnoreRobots(true))
+
+	var visited []string
+	depths := make(map[string]int)
+	h.ResponseDo(func(res *Response) {
+		visited = append(visited, res.Request.URL.Path)
+		depths[res.Request.URL.Path] = res.Request.Depth
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, []string{"/", "/first", "/docs/intro", "/second"}, visited)
+	assert.Equal(t, 2, depths["/docs/intro"])
+
+	t.Run("With HtmlDo callbacks", func(t *testing.T) {
+		h := newTestHarvester(WithStreamingLinks(true), WithIgnoreRobots(true))
+
+		var titles []string
+		h.HtmlDo("a[href]", func(el *HtmlElement) {
+			titles = append(titles, el.Text)
+		})
+
+		assert.NoError(t, h.Visit(server.URL+"/first"))
+		assert.Equal(t, []string{"Intro"}, titles)
+		assert.Equal(t, int64(2), h.Stats().RequestsSucceeded)
+	})
+}
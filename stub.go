@@ -0,0 +1,74 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// stub is a fake response returned for matching URLs instead of sending a request.
+type stub struct {
+	pattern string
+	status  int
+	body    []byte
+	headers http.Header
+}
+
+// stubFor returns the stub matching the URL, or nil if the URL is not stubbed.
+// Exact matches take precedence over pattern matches.
+func (h *Harvester) stubFor(u string) *stub {
+	if len(h.stubs) == 0 {
+		return nil
+	}
+
+	for _, s := range h.stubs {
+		if s.pattern == u {
+			return s
+		}
+	}
+
+	for _, s := range h.stubs {
+		if ok, _ := path.Match(s.pattern, u); ok {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// response synthesizes an http.Response for the request from the stub.
+func (s *stub) response(req *http.Request) *http.Response {
+	headers := s.headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(s.status) + " " + http.StatusText(s.status),
+		StatusCode:    s.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          io.NopCloser(bytes.NewReader(s.body)),
+		ContentLength: int64(len(s.body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package grawlrtesting provides a test server and a Harvester set up for testing code built on grawlr.
+//
+// The tests of the grawlr package itself cannot use this package, because it imports grawlr.
+package grawlrtesting
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	grawlr "github.com/HRemonen/Grawlr"
+)
+
+// Hello is the body returned by the "/" handler of StandardHandlers.
+var Hello = []byte("Hello, client\n")
+
+// StandardHandlers returns handlers for commonly tested cases:
+//
+//	/             200 with the Hello body
+//	/robots.txt   disallows /disallowed for all user agents
+//	/disallowed   200, disallowed by robots.txt
+//	/redirect     303 redirect to /
+//	/404          404 Not Found
+//	/error        500 Internal Server Error
+//	/user_agent   200 echoing the User-Agent header
+//	/slow         200 after two seconds, or when the request is canceled
+//
+// The returned map is a new copy and can be modified to add or replace handlers.
+func StandardHandlers() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write(Hello)
+		},
+		"/robots.txt": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("User-agent: *\nDisallow: /disallowed"))
+		},
+		"/disallowed": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Disallowed"))
+		},
+		"/redirect": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		},
+		"/404": http.NotFound,
+		"/error": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		},
+		"/user_agent": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(r.Header.Get("User-Agent")))
+		},
+		"/slow": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second * 2):
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("hello"))
+			case <-r.Context().Done():
+				http.Error(w, "Request canceled", http.StatusRequestTimeout)
+			}
+		},
+	}
+}
+
+// NewTestServer starts a new test server serving the given handlers by their path patterns.
+// The caller should call Close when finished, to shut it down.
+func NewTestServer(handlers map[string]http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	for pattern, handler := range handlers {
+		mux.HandleFunc(pattern, handler)
+	}
+
+	return httptest.NewServer(mux)
+}
+
+// NewTestHarvester creates a new Harvester with the given options and a client that times out
+// after ten seconds and does not follow redirects.
+func NewTestHarvester(options ...grawlr.Options) *grawlr.Harvester {
+	client := &http.Client{
+		Timeout: time.Second * 10,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return grawlr.NewHarvester(
+		append(options, grawlr.WithClient(client))...,
+	)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlrtesting
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	grawlr "github.com/HRemonen/Grawlr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTestServer(t *testing.T) {
+	handlers := StandardHandlers()
+	handlers["/custom"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("custom"))
+	}
+
+	server := NewTestServer(handlers)
+	defer server.Close()
+
+	h := NewTestHarvester()
+
+	bodies := make(map[string]string)
+	statuses := make(map[string]int)
+	h.ResponseDo(func(res *grawlr.Response) {
+		b, _ := io.ReadAll(res.Body)
+		bodies[res.Request.URL.Path] = string(b)
+		statuses[res.Request.URL.Path] = res.StatusCode
+	})
+
+	for _, path := range []string{"/", "/custom", "/redirect", "/404", "/error"} {
+		assert.NoError(t, h.Visit(server.URL+path))
+	}
+	assert.Error(t, h.Visit(server.URL+"/disallowed"))
+
+	assert.Equal(t, string(Hello), bodies["/"])
+	assert.Equal(t, "custom", bodies["/custom"])
+	assert.Equal(t, map[string]int{
+		"/":         http.StatusOK,
+		"/custom":   http.StatusOK,
+		"/redirect": http.StatusSeeOther,
+		"/404":      http.StatusNotFound,
+		"/error":    http.StatusInternalServerError,
+	}, statuses)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Trace holds the low-level network timings of a request, recorded when the
+// WithHTTPTrace functional option is enabled.
+type Trace struct {
+	// DNSDuration is the time taken to resolve the host name.
+	DNSDuration time.Duration
+	// ConnectDuration is the time taken to establish the TCP connection.
+	ConnectDuration time.Duration
+	// TLSDuration is the time taken by the TLS handshake.
+	TLSDuration time.Duration
+	// TimeToFirstByte is the time from starting the request to receiving the first response byte.
+	TimeToFirstByte time.Duration
+	// TotalDuration is the time from starting the request to reading the full response body.
+	TotalDuration time.Duration
+	// ConnReused reports whether the request reused a previously used connection.
+	ConnReused bool
+	// LocalAddr is the local address of the connection, e.g. the address set with WithLocalAddrs.
+	LocalAddr string
+}
+
+// traceRecorder records a Trace from httptrace hooks, which may be called concurrently.
+type traceRecorder struct {
+	trace Trace
+	start time.Time
+	dns   time.Time
+	conn  time.Time
+	tls   time.Time
+	lock  *sync.Mutex
+}
+
+// traceContextKey is the context key of the traceRecorder of a request.
+type traceContextKey struct{}
+
+// withTrace returns a copy of the request recording a Trace.
+func withTrace(req *http.Request) *http.Request {
+	r := &traceRecorder{
+		start: time.Now(),
+		lock:  &sync.Mutex{},
+	}
+
+	ctx := context.WithValue(req.Context(), traceContextKey{}, r)
+	ctx = httptrace.WithClientTrace(ctx, r.clientTrace())
+
+	return req.WithContext(ctx)
+}
+
+// traceOf returns the Trace recorded for the request, or nil if the request is not traced.
+func traceOf(req *http.Request) *Trace {
+	r, ok := req.Context().Value(traceContextKey{}).(*traceRecorder)
+	if !ok {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	t := r.trace
+	return &t
+}
+
+// endTrace records the total duration of the request when its response body has been read.
+func endTrace(req *http.Request) {
+	r, ok := req.Context().Value(traceContextKey{}).(*traceRecorder)
+	if !ok {
+		return
+	}
+
+	r.record(func() { r.trace.TotalDuration = time.Since(r.start) })
+}
+
+func (r *traceRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.record(func() { r.dns = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.record(func() { r.trace.DNSDuration = time.Since(r.dns) })
+		},
+		ConnectStart: func(_, _ string) {
+			r.record(func() { r.conn = time.Now() })
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			r.record(func() { r.trace.ConnectDuration = time.Since(r.conn) })
+		},
+		TLSHandshakeStart: func() {
+			r.record(func() { r.tls = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			r.record(func() { r.trace.TLSDuration = time.Since(r.tls) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.record(func() {
+				r.trace.ConnReused = info.Reused
+				r.trace.LocalAddr = info.Conn.LocalAddr().String()
+			})
+		},
+		GotFirstResponseByte: func() {
+			r.record(func() { r.trace.TimeToFirstByte = time.Since(r.start) })
+		},
+	}
+}
+
+func (r *traceRecorder) record(fn func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	fn()
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"path"
+	"strings"
+)
+
+// urlTemplate is a URL path template such as "/products/{id}", split into its path segments.
+type urlTemplate []string
+
+// WithURLTemplate is a functional option that only follows links whose path matches one of the given
+// templates. A template is a path of segments, where "{name}" matches any single segment, "**"
+// matches any number of segments and other segments are matched with path.Match, so "*.html" matches
+// any page with the .html extension. The URLs passed to Visit are not matched against the templates.
+func WithURLTemplate(templates ...string) Options {
+	return func(h *Harvester) {
+		h.urlTemplates = make([]urlTemplate, 0, len(templates))
+		for _, template := range templates {
+			h.urlTemplates = append(h.urlTemplates, splitPath(template))
+		}
+	}
+}
+
+// matchesURLTemplates reports whether the path matches any of the URL templates of the Harvester,
+// or true if there are none.
+func (h *Harvester) matchesURLTemplates(urlPath string) bool {
+	if len(h.urlTemplates) == 0 {
+		return true
+	}
+
+	segments := splitPath(urlPath)
+	for _, template := range h.urlTemplates {
+		if template.match(segments) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match reports whether the path segments match the template.
+func (t urlTemplate) match(segments []string) bool {
+	if len(t) == 0 {
+		return len(segments) == 0
+	}
+
+	if t[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if t[1:].match(segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if !matchSegment(t[0], segments[0]) {
+		return false
+	}
+
+	return t[1:].match(segments[1:])
+}
+
+// matchSegment reports whether a path segment matches a template segment.
+func matchSegment(pattern, segment string) bool {
+	if strings.HasPrefix(pattern, "{") && strings.HasSuffix(pattern, "}") {
+		return segment != ""
+	}
+
+	ok, err := path.Match(pattern, segment)
+	return err == nil && ok
+}
+
+// splitPath splits a URL path into its segments, ignoring leading and trailing slashes.
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
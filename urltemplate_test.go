@@ -0,0 +1,84 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLTemplate_Match(t *testing.T) {
+	tests := []struct {
+		template string
+		matches  []string
+		misses   []string
+	}{
+		{"/products/{id}", []string{"/products/42", "/products/42/"}, []string{"/products", "/products/42/reviews", "/blog/42"}},
+		{"/products/{id}/reviews", []string{"/products/a-b/reviews"}, []string{"/products/reviews"}},
+		{"/docs/**", []string{"/docs", "/docs/a", "/docs/a/b/c"}, []string{"/blog/a"}},
+		{"/**/*.html", []string{"/index.html", "/a/b/page.html"}, []string{"/a/b/page.htm", "/"}},
+		{"/blog/20??/{slug}", []string{"/blog/2024/hello"}, []string{"/blog/1999/hello", "/blog/2024"}},
+		{"/", []string{"/", ""}, []string{"/a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			template := urlTemplate(splitPath(tt.template))
+			for _, p := range tt.matches {
+				assert.True(t, template.match(splitPath(p)), p)
+			}
+			for _, p := range tt.misses {
+				assert.False(t, template.match(splitPath(p)), p)
+			}
+		})
+	}
+}
+
+func TestHarvester_WithURLTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="/products/1">1</a> <a href="/products/2/">2</a> <a href="/about">About</a> <a href="/products/1/reviews">Reviews</a>`))
+	}))
+	defer server.Close()
+
+	h := newTestHarvester(WithIgnoreRobots(true), WithURLTemplate("/products/{id}", "/help/**"))
+
+	var visited []string
+	h.ResponseDo(func(res *Response) {
+		visited = append(visited, res.Request.URL.Path)
+	})
+	h.HtmlDo("a[href]", func(el *HtmlElement) {
+		el.Visit(el.Attribute("href"))
+	})
+
+	var filtered []string
+	h.OnFiltered(func(u *url.URL, err error) {
+		assert.ErrorContains(t, err, "does not match any URL template")
+		filtered = append(filtered, u.Path)
+	})
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.Equal(t, []string{"/", "/products/1", "/products/2/"}, visited)
+	// Every page links to the URLs not matching a template.
+	assert.Equal(t, []string{
+		"/about", "/products/1/reviews",
+		"/about", "/products/1/reviews",
+		"/about", "/products/1/reviews",
+	}, filtered)
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookEvent is a crawl lifecycle event delivered by a WebhookNotifier.
+type WebhookEvent string
+
+const (
+	// WebhookFinished is delivered by Harvester.Wait when the crawl is done.
+	WebhookFinished WebhookEvent = "finished"
+	// WebhookErrorRateExceeded is delivered once when the error rate of the crawl reaches the threshold.
+	WebhookErrorRateExceeded WebhookEvent = "error_rate_exceeded"
+	// WebhookHostDropped is delivered once per host when its download budget set with WithMaxBytesPerHost
+	// is used up, so that the rest of its URLs are not visited.
+	WebhookHostDropped WebhookEvent = "host_dropped"
+)
+
+// WebhookSignatureHeader is the header carrying the hex encoded HMAC-SHA256 signature of the
+// webhook payload, in the form "sha256=<signature>".
+const WebhookSignatureHeader = "X-Grawlr-Signature"
+
+// WebhookPayload is the JSON body posted by a WebhookNotifier. Host and Reason are the dropped host
+// and the error it was dropped with, set for WebhookHostDropped only.
+type WebhookPayload struct {
+	Event     WebhookEvent `json:"event"`
+	Timestamp time.Time    `json:"timestamp"`
+	Stats     Stats        `json:"stats"`
+	Host      string       `json:"host,omitempty"`
+	Reason    string       `json:"reason,omitempty"`
+}
+
+// WebhookNotifier posts crawl lifecycle events as JSON to a URL. Deliveries are sent from a goroutine
+// and never block the crawl; a failed delivery is retried with exponential backoff up to MaxRetries
+// times and then logged. Set the exported fields before the crawl starts.
+//
+//	n := grawlr.NewWebhookNotifier("https://example.com/hooks/crawl", secret,
+//		grawlr.WebhookFinished, grawlr.WebhookErrorRateExceeded, grawlr.WebhookHostDropped)
+//	h := grawlr.NewHarvester(grawlr.WithWebhook(n))
+//	err := h.Visit("https://example.com")
+//	stats, err := h.Wait()
+//	n.Wait()
+type WebhookNotifier struct {
+	// URL is the URL the events are posted to.
+	URL string
+	// Secret is the key of the HMAC-SHA256 signature sent in the WebhookSignatureHeader, nil to not sign.
+	Secret []byte
+	// Events are the events of interest, the other events are not delivered.
+	Events []WebhookEvent
+	// ErrorRateThreshold is the ratio of failed requests and 5xx responses to attempted requests
+	// at which WebhookErrorRateExceeded is delivered. Defaults to 0.5.
+	ErrorRateThreshold float64
+	// ErrorRateMinRequests is the number of attempted requests before the error rate is checked. Defaults to 10.
+	ErrorRateMinRequests int64
+	// MaxRetries is the number of times a failed delivery is retried. Defaults to 3.
+	MaxRetries int
+	// RetryDelay is the delay before the first retry, doubled for every retry. Defaults to one second.
+	RetryDelay time.Duration
+	// Timeout is the timeout of a single delivery attempt. Defaults to ten seconds.
+	Timeout time.Duration
+	// Client is the http.Client used to deliver the events. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	logger            *slog.Logger
+	errorRateNotified atomic.Bool
+	droppedHosts      sync.Map
+	wg                sync.WaitGroup
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier posting the given events to url, signed with secret.
+func NewWebhookNotifier(url string, secret []byte, events ...WebhookEvent) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:                  url,
+		Secret:               secret,
+		Events:               events,
+		ErrorRateThreshold:   0.5,
+		ErrorRateMinRequests: 10,
+		MaxRetries:           3,
+		RetryDelay:           time.Second,
+		Timeout:              10 * time.Second,
+		Client:               http.DefaultClient,
+		logger:               slog.Default(),
+	}
+}
+
+// WithWebhook is a functional option that delivers the lifecycle events of the crawl with the
+// WebhookNotifier: WebhookFinished from every call to Wait, WebhookErrorRateExceeded when the error
+// rate checked after every request reaches the threshold, and WebhookHostDropped when the download
+// budget of a host is used up. Clones of the Harvester do not deliver events.
+func WithWebhook(n *WebhookNotifier) Options {
+	return func(h *Harvester) {
+		n.logger = h.logger
+		h.webhook = n
+		h.metricsCallbacks = append(h.metricsCallbacks, func(FetchMetric) {
+			n.checkErrorRate(h)
+		})
+	}
+}
+
+// Wait blocks until all pending deliveries have succeeded or given up.
+func (n *WebhookNotifier) Wait() {
+	n.wg.Wait()
+}
+
+// Sign returns the signature of the payload sent in the WebhookSignatureHeader, for verifying deliveries.
+func (n *WebhookNotifier) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, n.Secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkErrorRate delivers WebhookErrorRateExceeded if the error rate of the Harvester has reached the
+// threshold. The rate is computed from the counters of the Harvester, which are only snapshotted for
+// the payload.
+func (n *WebhookNotifier) checkErrorRate(h *Harvester) {
+	if n.errorRateNotified.Load() {
+		return
+	}
+
+	attempted := h.stats.requestsAttempted.Load()
+	if attempted < n.ErrorRateMinRequests || attempted == 0 {
+		return
+	}
+
+	errorRate := float64(h.stats.requestsFailed.Load()+h.stats.statusClasses[5].Load()) / float64(attempted)
+	if errorRate >= n.ErrorRateThreshold && n.errorRateNotified.CompareAndSwap(false, true) {
+		n.notify(WebhookPayload{Event: WebhookErrorRateExceeded, Stats: h.Stats()})
+	}
+}
+
+// hostDropped delivers WebhookHostDropped the first time the host is dropped for the given reason.
+func (n *WebhookNotifier) hostDropped(h *Harvester, host string, reason error) {
+	if _, dropped := n.droppedHosts.LoadOrStore(host, true); dropped {
+		return
+	}
+
+	n.notify(WebhookPayload{Event: WebhookHostDropped, Stats: h.Stats(), Host: host, Reason: reason.Error()})
+}
+
+// notify delivers the payload from a goroutine if its event is an event of interest.
+func (n *WebhookNotifier) notify(p WebhookPayload) {
+	event := p.Event
+	if !slices.Contains(n.Events, event) {
+		return
+	}
+
+	p.Timestamp = time.Now()
+	payload, err := json.Marshal(p)
+	if err != nil {
+		n.logger.Warn("error encoding webhook payload", slog.String("event", string(event)), slog.Any("error", err))
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		delay := n.RetryDelay
+		for attempt := 0; ; attempt++ {
+			err := n.deliver(payload)
+			if err == nil {
+				return
+			}
+
+			if attempt >= n.MaxRetries {
+				n.logger.Warn("error delivering webhook",
+					slog.String("url", n.URL),
+					slog.String("event", string(event)),
+					slog.Any("error", err),
+				)
+				return
+			}
+
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}()
+}
+
+// deliver posts the payload once.
+func (n *WebhookNotifier) deliver(payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if n.Secret != nil {
+		req.Header.Set(WebhookSignatureHeader, n.Sign(payload))
+	}
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
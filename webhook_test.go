@@ -0,0 +1,173 @@
+/*
+Copyright 2024 Henri Remonen
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grawlr
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	secret := []byte("secret")
+
+	var (
+		mu       sync.Mutex
+		attempts int
+		payloads []WebhookPayload
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, NewWebhookNotifier("", secret).Sign(body), r.Header.Get(WebhookSignatureHeader))
+
+		var payload WebhookPayload
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		payloads = append(payloads, payload)
+	}))
+	defer receiver.Close()
+
+	n := NewWebhookNotifier(receiver.URL, secret, WebhookFinished, WebhookErrorRateExceeded)
+	n.ErrorRateMinRequests = 2
+	n.RetryDelay = time.Millisecond
+
+	h := newTestHarvester(WithWebhook(n), WithAllowRevisit(true))
+
+	assert.NoError(t, h.Visit(server.URL+"/"))
+	assert.NoError(t, h.Visit(server.URL+"/error"))
+	assert.NoError(t, h.Visit(server.URL+"/error"))
+
+	n.Wait()
+	_, err := h.Wait()
+	assert.NoError(t, err)
+	n.Wait()
+
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, payloads, 2)
+	assert.Equal(t, WebhookErrorRateExceeded, payloads[0].Event)
+	assert.Equal(t, int64(2), payloads[0].Stats.RequestsAttempted)
+	assert.Equal(t, WebhookFinished, payloads[1].Event)
+	assert.Equal(t, int64(3), payloads[1].Stats.RequestsAttempted)
+	assert.Equal(t, int64(2), payloads[1].Stats.ResponsesByClass["5xx"])
+	assert.False(t, payloads[1].Timestamp.IsZero())
+}
+
+func TestWebhookNotifier_GivesUp(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	n := NewWebhookNotifier(receiver.URL, nil, WebhookFinished)
+	n.MaxRetries = 2
+	n.RetryDelay = time.Millisecond
+
+	n.notify(WebhookPayload{Event: WebhookFinished})
+	n.notify(WebhookPayload{Event: WebhookErrorRateExceeded})
+	n.Wait()
+
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWebhookNotifier_HostDropped(t *testing.T) {
+	server := newBudgetTestServer()
+	defer server.Close()
+
+	var (
+		mu       sync.Mutex
+		payloads []WebhookPayload
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var payload WebhookPayload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+	}))
+	defer receiver.Close()
+
+	n := NewWebhookNotifier(receiver.URL, nil, WebhookHostDropped)
+	h := newTestHarvester(WithWebhook(n), WithIgnoreRobots(true), WithMaxBytesPerHost(15000))
+
+	assert.NoError(t, h.Visit(server.URL+"/1"))
+	assert.NoError(t, h.Visit(server.URL+"/2"))
+	assert.Error(t, h.Visit(server.URL+"/3"))
+	assert.Error(t, h.Visit(server.URL+"/4"))
+	n.Wait()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	if assert.Len(t, payloads, 1) {
+		assert.Equal(t, WebhookHostDropped, payloads[0].Event)
+		assert.Equal(t, host, payloads[0].Host)
+		assert.Equal(t, ErrHostBytesExceeded(host, 15000).Error(), payloads[0].Reason)
+		assert.Equal(t, int64(2), payloads[0].Stats.RequestsAttempted)
+	}
+}
+
+func TestWebhookNotifier_CheckErrorRate(t *testing.T) {
+	n := NewWebhookNotifier("", nil)
+	n.ErrorRateMinRequests = 4
+	h := newTestHarvester(WithWebhook(n))
+
+	h.stats.requestsAttempted.Add(3)
+	h.stats.requestsFailed.Add(3)
+	n.checkErrorRate(h)
+	assert.False(t, n.errorRateNotified.Load(), "too few requests")
+
+	h.stats.requestsAttempted.Add(1)
+	n.checkErrorRate(h)
+	assert.True(t, n.errorRateNotified.Load())
+
+	n = NewWebhookNotifier("", nil)
+	h = newTestHarvester(WithWebhook(n))
+	h.stats.requestsAttempted.Add(10)
+	h.stats.requestsFailed.Add(2)
+	h.stats.statusClasses[5].Add(2)
+	n.checkErrorRate(h)
+	assert.False(t, n.errorRateNotified.Load(), "below the threshold")
+
+	h.stats.statusClasses[5].Add(1)
+	n.checkErrorRate(h)
+	assert.True(t, n.errorRateNotified.Load())
+}